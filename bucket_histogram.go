@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// BucketHistograms count values in buckets with fixed upper bounds, along
+// with their sum.  Unlike the percentiles of a Histogram, bucket counts from
+// several hosts can be added together to describe them all.
+type BucketHistogram interface {
+	Buckets() []Bucket
+	Clear()
+	Count() int64
+	Snapshot() BucketHistogram
+	SnapshotAndClear() BucketHistogram
+	Sum() float64
+	Update(float64)
+}
+
+// Bucket is the cumulative count of values less than or equal to an upper
+// bound.  The last bucket of every BucketHistogram has an upper bound of
+// +Inf and counts every value.
+type Bucket struct {
+	UpperBound float64
+	Count      int64
+}
+
+// LinearBuckets returns count upper bounds, the first being start and each
+// of the others width greater than the last.
+func LinearBuckets(start, width float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// ExponentialBuckets returns count upper bounds, the first being start and
+// each of the others factor times the last.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// bucketBound formats an upper bound as exporters key buckets by it.
+func bucketBound(b float64) string {
+	if math.IsInf(b, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(b, 'g', -1, 64)
+}
+
+// GetOrRegisterBucketHistogram returns an existing BucketHistogram or
+// constructs and registers a new StandardBucketHistogram.
+func GetOrRegisterBucketHistogram(name string, r Registry, bounds []float64) BucketHistogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() BucketHistogram { return NewBucketHistogram(bounds) }).(BucketHistogram)
+}
+
+// NewBucketHistogram constructs a new StandardBucketHistogram with the given
+// upper bounds, to which +Inf is added.
+func NewBucketHistogram(bounds []float64) BucketHistogram {
+	if UseNilMetrics {
+		return NilBucketHistogram{}
+	}
+	sorted := make([]float64, 0, len(bounds))
+	for _, b := range bounds {
+		if !math.IsInf(b, 1) && !math.IsNaN(b) {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Float64s(sorted)
+	unique := sorted[:0]
+	for i, b := range sorted {
+		if 0 == i || b != sorted[i-1] {
+			unique = append(unique, b)
+		}
+	}
+	return &StandardBucketHistogram{
+		bounds: unique,
+		counts: make([]int64, len(unique)+1),
+	}
+}
+
+// NewRegisteredBucketHistogram constructs and registers a new
+// StandardBucketHistogram.
+func NewRegisteredBucketHistogram(name string, r Registry, bounds []float64) BucketHistogram {
+	c := NewBucketHistogram(bounds)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// BucketHistogramSnapshot is a read-only copy of another BucketHistogram.
+type BucketHistogramSnapshot struct {
+	buckets []Bucket
+	sum     float64
+}
+
+// Buckets returns the cumulative bucket counts at the time the snapshot was
+// taken.
+func (h *BucketHistogramSnapshot) Buckets() []Bucket {
+	buckets := make([]Bucket, len(h.buckets))
+	copy(buckets, h.buckets)
+	return buckets
+}
+
+// Clear panics.
+func (*BucketHistogramSnapshot) Clear() {
+	panic("Clear called on a BucketHistogramSnapshot")
+}
+
+// Count returns the number of values recorded at the time the snapshot was
+// taken.
+func (h *BucketHistogramSnapshot) Count() int64 {
+	return h.buckets[len(h.buckets)-1].Count
+}
+
+// Merge returns a snapshot whose counts and sum are the sums of this
+// snapshot's and another BucketHistogram's.  Only the buckets whose upper
+// bounds both have are kept, since counts can't be split between buckets.
+func (h *BucketHistogramSnapshot) Merge(o BucketHistogram) *BucketHistogramSnapshot {
+	o = o.Snapshot()
+	ob := o.Buckets()
+	buckets := make([]Bucket, 0, len(h.buckets))
+	i := 0
+	for _, b := range h.buckets {
+		for i < len(ob) && ob[i].UpperBound < b.UpperBound {
+			i++
+		}
+		if i < len(ob) && ob[i].UpperBound == b.UpperBound {
+			buckets = append(buckets, Bucket{b.UpperBound, b.Count + ob[i].Count})
+		}
+	}
+	return &BucketHistogramSnapshot{buckets: buckets, sum: h.sum + o.Sum()}
+}
+
+// Snapshot returns the snapshot.
+func (h *BucketHistogramSnapshot) Snapshot() BucketHistogram { return h }
+
+// SnapshotAndClear panics.
+func (*BucketHistogramSnapshot) SnapshotAndClear() BucketHistogram {
+	panic("SnapshotAndClear called on a BucketHistogramSnapshot")
+}
+
+// Sum returns the sum of the values recorded at the time the snapshot was
+// taken.
+func (h *BucketHistogramSnapshot) Sum() float64 { return h.sum }
+
+// Update panics.
+func (*BucketHistogramSnapshot) Update(float64) {
+	panic("Update called on a BucketHistogramSnapshot")
+}
+
+// NilBucketHistogram is a no-op BucketHistogram.
+type NilBucketHistogram struct{}
+
+// Buckets is a no-op.
+func (NilBucketHistogram) Buckets() []Bucket {
+	return []Bucket{{math.Inf(1), 0}}
+}
+
+// Clear is a no-op.
+func (NilBucketHistogram) Clear() {}
+
+// Count is a no-op.
+func (NilBucketHistogram) Count() int64 { return 0 }
+
+// Snapshot is a no-op.
+func (NilBucketHistogram) Snapshot() BucketHistogram { return NilBucketHistogram{} }
+
+// SnapshotAndClear is a no-op.
+func (NilBucketHistogram) SnapshotAndClear() BucketHistogram { return NilBucketHistogram{} }
+
+// Sum is a no-op.
+func (NilBucketHistogram) Sum() float64 { return 0.0 }
+
+// Update is a no-op.
+func (NilBucketHistogram) Update(v float64) {}
+
+// StandardBucketHistogram is the standard implementation of a
+// BucketHistogram and uses atomic operations on the count of each bucket and
+// on the sum.  Updates share a read lock which snapshots take exclusively, so
+// that every snapshot's counts and sum agree.
+type StandardBucketHistogram struct {
+	sum    uint64 // first to keep it 64-bit aligned for atomic operations
+	bounds []float64
+	counts []int64
+	mutex  sync.RWMutex
+}
+
+// Buckets returns the cumulative bucket counts.
+func (h *StandardBucketHistogram) Buckets() []Bucket {
+	return h.Snapshot().(*BucketHistogramSnapshot).buckets
+}
+
+// Clear sets every bucket count and the sum to zero.
+func (h *StandardBucketHistogram) Clear() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+	atomic.StoreUint64(&h.sum, 0)
+}
+
+// Count returns the number of values recorded.
+func (h *StandardBucketHistogram) Count() int64 {
+	var count int64
+	for i := range h.counts {
+		count += atomic.LoadInt64(&h.counts[i])
+	}
+	return count
+}
+
+// Snapshot returns a read-only copy of the histogram.
+func (h *StandardBucketHistogram) Snapshot() BucketHistogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	buckets := make([]Bucket, len(h.counts))
+	var count int64
+	for i := range h.counts {
+		count += atomic.LoadInt64(&h.counts[i])
+		buckets[i].Count = count
+		if i < len(h.bounds) {
+			buckets[i].UpperBound = h.bounds[i]
+		} else {
+			buckets[i].UpperBound = math.Inf(1)
+		}
+	}
+	sum := math.Float64frombits(atomic.LoadUint64(&h.sum))
+	return &BucketHistogramSnapshot{buckets: buckets, sum: sum}
+}
+
+// SnapshotAndClear returns a read-only copy of the histogram and clears it
+// under a single lock, so that every value is counted and summed by exactly
+// one snapshot.
+func (h *StandardBucketHistogram) SnapshotAndClear() BucketHistogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	buckets := make([]Bucket, len(h.counts))
+	var count int64
+	for i := range h.counts {
+		count += atomic.SwapInt64(&h.counts[i], 0)
+		buckets[i].Count = count
+		if i < len(h.bounds) {
+			buckets[i].UpperBound = h.bounds[i]
+		} else {
+			buckets[i].UpperBound = math.Inf(1)
+		}
+	}
+	sum := math.Float64frombits(atomic.SwapUint64(&h.sum, 0))
+	return &BucketHistogramSnapshot{buckets: buckets, sum: sum}
+}
+
+// Sum returns the sum of the values recorded.
+func (h *StandardBucketHistogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.sum))
+}
+
+// Update counts a value in the first bucket whose upper bound is not less
+// than it.
+func (h *StandardBucketHistogram) Update(v float64) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	atomic.AddInt64(&h.counts[sort.SearchFloat64s(h.bounds, v)], 1)
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sum, old, sum) {
+			return
+		}
+	}
+}
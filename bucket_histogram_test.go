@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func BenchmarkBucketHistogram(b *testing.B) {
+	h := NewBucketHistogram(ExponentialBuckets(1, 2, 16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Update(float64(i % 65536))
+	}
+}
+
+func TestBucketHistogram(t *testing.T) {
+	h := NewBucketHistogram([]float64{10, 1, 5, 5, math.Inf(1)})
+	for _, v := range []float64{0.5, 1, 3, 7, 10, 100} {
+		h.Update(v)
+	}
+	if count := h.Count(); 6 != count {
+		t.Errorf("h.Count(): 6 != %v\n", count)
+	}
+	if sum := h.Sum(); 121.5 != sum {
+		t.Errorf("h.Sum(): 121.5 != %v\n", sum)
+	}
+	expected := []Bucket{{1, 2}, {5, 3}, {10, 5}, {math.Inf(1), 6}}
+	buckets := h.Buckets()
+	if len(expected) != len(buckets) {
+		t.Fatalf("h.Buckets(): %v\n", buckets)
+	}
+	for i, b := range buckets {
+		if expected[i] != b {
+			t.Errorf("buckets[%v]: %v != %v\n", i, expected[i], b)
+		}
+	}
+}
+
+func TestBucketHistogramClear(t *testing.T) {
+	h := NewBucketHistogram([]float64{1})
+	h.Update(2)
+	h.Clear()
+	if count, sum := h.Count(), h.Sum(); 0 != count || 0 != sum {
+		t.Errorf("h.Count(), h.Sum(): %v, %v\n", count, sum)
+	}
+}
+
+func TestBucketHistogramSnapshot(t *testing.T) {
+	h := NewBucketHistogram([]float64{1})
+	h.Update(1)
+	snapshot := h.Snapshot()
+	h.Update(2)
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+	if sum := snapshot.Sum(); 1 != sum {
+		t.Errorf("snapshot.Sum(): 1 != %v\n", sum)
+	}
+}
+
+func TestBucketHistogramSnapshotAndClearConcurrent(t *testing.T) {
+	h := NewBucketHistogram(LinearBuckets(1, 1, 1000))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				h.Update(1)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var count int64
+	check := func(s BucketHistogram) {
+		buckets := s.Buckets()
+		if float64(s.Count()) != s.Sum() || buckets[0].Count != s.Count() {
+			t.Fatalf("inconsistent snapshot: count %v, first bucket %v, sum %v", s.Count(), buckets[0].Count, s.Sum())
+		}
+		count += s.Count()
+	}
+	for {
+		select {
+		case <-done:
+			check(h.SnapshotAndClear())
+			if 40000 != count {
+				t.Errorf("count: 40000 != %v\n", count)
+			}
+			return
+		default:
+			check(h.SnapshotAndClear())
+		}
+	}
+}
+
+func TestGetOrRegisterBucketHistogram(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredBucketHistogram("foo", r, []float64{1}).Update(1)
+	if h := GetOrRegisterBucketHistogram("foo", r, nil); 1 != h.Count() {
+		t.Fatal(h)
+	}
+}
+
+func TestLinearBuckets(t *testing.T) {
+	bounds := LinearBuckets(1, 2, 3)
+	if 3 != len(bounds) || 1 != bounds[0] || 3 != bounds[1] || 5 != bounds[2] {
+		t.Fatal(bounds)
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	bounds := ExponentialBuckets(1, 10, 3)
+	if 3 != len(bounds) || 1 != bounds[0] || 10 != bounds[1] || 100 != bounds[2] {
+		t.Fatal(bounds)
+	}
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and calls functions periodically.  Constructors of
+// time-dependent metrics, such as meters, timers and exponentially-decaying
+// samples, have a WithClock variant so that tests can substitute a
+// ManualClock for the SystemClock.
+type Clock interface {
+	Now() time.Time
+
+	// Tick calls f every d until the returned Ticker is stopped.
+	Tick(d time.Duration, f func()) Ticker
+}
+
+// A Ticker is the handle on a periodic function started by Clock.Tick.
+type Ticker interface {
+	Stop()
+}
+
+// SystemClock is the Clock backed by the time package, used by every
+// constructor which doesn't take a Clock.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Tick calls f every d from a goroutine of its own.
+func (systemClock) Tick(d time.Duration, f func()) Ticker {
+	t := &systemTicker{ticker: time.NewTicker(d), stop: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case <-t.ticker.C:
+				f()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+type systemTicker struct {
+	once   sync.Once
+	ticker *time.Ticker
+	stop   chan struct{}
+}
+
+func (t *systemTicker) Stop() {
+	t.once.Do(func() {
+		t.ticker.Stop()
+		close(t.stop)
+	})
+}
+
+// ManualClock is a Clock whose time only moves when Add is called.  Ticks
+// are delivered from the goroutine calling Add, so that once it returns
+// every function which came due has run.
+type ManualClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+}
+
+// NewManualClock constructs a new ManualClock set to the given time.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Add advances the clock by d, calling the function of each ticker every
+// time it comes due, in order.
+func (c *ManualClock) Add(d time.Duration) {
+	c.mutex.Lock()
+	end := c.now.Add(d)
+	for {
+		var next *manualTicker
+		for _, t := range c.tickers {
+			if !t.next.After(end) && (nil == next || t.next.Before(next.next)) {
+				next = t
+			}
+		}
+		if nil == next {
+			break
+		}
+		c.now = next.next
+		next.next = next.next.Add(next.d)
+		c.mutex.Unlock()
+		next.f()
+		c.mutex.Lock()
+	}
+	c.now = end
+	c.mutex.Unlock()
+}
+
+// Now returns the clock's current time.
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Tick calls f every d of the time added to the clock.
+func (c *ManualClock) Tick(d time.Duration, f func()) Ticker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := &manualTicker{clock: c, d: d, next: c.now.Add(d), f: f}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+type manualTicker struct {
+	clock *ManualClock
+	d     time.Duration
+	next  time.Time
+	f     func()
+}
+
+func (t *manualTicker) Stop() {
+	c := t.clock
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, ticker := range c.tickers {
+		if t == ticker {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
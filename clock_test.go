@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockTick(t *testing.T) {
+	t0 := time.Unix(0, 0)
+	c := NewManualClock(t0)
+	var ticks []time.Duration
+	ticker := c.Tick(2*time.Second, func() {
+		ticks = append(ticks, c.Now().Sub(t0))
+	})
+	c.Add(time.Second)
+	if 0 != len(ticks) {
+		t.Fatalf("ticks: %v\n", ticks)
+	}
+	c.Add(4 * time.Second)
+	if 2 != len(ticks) || 2*time.Second != ticks[0] || 4*time.Second != ticks[1] {
+		t.Fatalf("ticks: %v\n", ticks)
+	}
+	if d := c.Now().Sub(t0); 5*time.Second != d {
+		t.Errorf("c.Now(): 5s != %v\n", d)
+	}
+	ticker.Stop()
+	c.Add(time.Minute)
+	if 2 != len(ticks) {
+		t.Errorf("ticks after Stop: %v\n", ticks)
+	}
+}
+
+func TestSystemClockTick(t *testing.T) {
+	ch := make(chan struct{}, 1)
+	ticker := SystemClock.Tick(time.Millisecond, func() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	})
+	defer ticker.Stop()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no tick within a second")
+	}
+	ticker.Stop()
+}
+
+func TestTimerWithClock(t *testing.T) {
+	c := NewManualClock(time.Now())
+	tm := NewTimerWithClock(c)
+	defer tm.Stop()
+	tm.Time(func() { c.Add(250 * time.Millisecond) })
+	tm.UpdateSince(c.Now().Add(-time.Second))
+	if min, max := tm.Min(), tm.Max(); int64(250*time.Millisecond) != min || int64(time.Second) != max {
+		t.Errorf("tm.Min(), tm.Max(): %v, %v\n", min, max)
+	}
+	c.Add(5 * time.Second)
+	if rate1 := tm.Rate1(); 0.4 != rate1 {
+		t.Errorf("tm.Rate1(): 0.4 != %v\n", rate1)
+	}
+}
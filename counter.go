@@ -1,6 +1,9 @@
 package metrics
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 // Counters hold an int64 value that can be incremented and decremented.
 type Counter interface {
@@ -9,6 +12,20 @@ type Counter interface {
 	Dec(int64)
 	Inc(int64)
 	Snapshot() Counter
+	SnapshotAndClear() Counter
+}
+
+// createdOf returns the time a counter or meter which records it was
+// constructed or last cleared, or the zero time.  It isn't part of the
+// Counter and Meter interfaces so that other implementations of them need not
+// record it.
+func createdOf(i interface{}) time.Time {
+	if c, ok := i.(interface {
+		Created() time.Time
+	}); ok {
+		return c.Created()
+	}
+	return time.Time{}
 }
 
 // GetOrRegisterCounter returns an existing Counter or constructs and registers
@@ -25,7 +42,7 @@ func NewCounter() Counter {
 	if UseNilMetrics {
 		return NilCounter{}
 	}
-	return &StandardCounter{0}
+	return &StandardCounter{created: time.Now().UnixNano()}
 }
 
 // NewRegisteredCounter constructs and registers a new StandardCounter.
@@ -49,6 +66,10 @@ func (CounterSnapshot) Clear() {
 // Count returns the count at the time the snapshot was taken.
 func (c CounterSnapshot) Count() int64 { return int64(c) }
 
+// Created returns the zero time since a snapshot doesn't record when its
+// counter was created.
+func (CounterSnapshot) Created() time.Time { return time.Time{} }
+
 // Dec panics.
 func (CounterSnapshot) Dec(int64) {
 	panic("Dec called on a CounterSnapshot")
@@ -59,9 +80,20 @@ func (CounterSnapshot) Inc(int64) {
 	panic("Inc called on a CounterSnapshot")
 }
 
+// Merge returns a snapshot whose count is the sum of this snapshot's and
+// another Counter's.
+func (c CounterSnapshot) Merge(o Counter) CounterSnapshot {
+	return c + CounterSnapshot(o.Count())
+}
+
 // Snapshot returns the snapshot.
 func (c CounterSnapshot) Snapshot() Counter { return c }
 
+// SnapshotAndClear panics.
+func (CounterSnapshot) SnapshotAndClear() Counter {
+	panic("SnapshotAndClear called on a CounterSnapshot")
+}
+
 // NilCounter is a no-op Counter.
 type NilCounter struct{}
 
@@ -71,6 +103,9 @@ func (NilCounter) Clear() {}
 // Count is a no-op.
 func (NilCounter) Count() int64 { return 0 }
 
+// Created is a no-op.
+func (NilCounter) Created() time.Time { return time.Time{} }
+
 // Dec is a no-op.
 func (NilCounter) Dec(i int64) {}
 
@@ -80,15 +115,20 @@ func (NilCounter) Inc(i int64) {}
 // Snapshot is a no-op.
 func (NilCounter) Snapshot() Counter { return NilCounter{} }
 
+// SnapshotAndClear is a no-op.
+func (NilCounter) SnapshotAndClear() Counter { return NilCounter{} }
+
 // StandardCounter is the standard implementation of a Counter and uses the
 // sync/atomic package to manage a single int64 value.
 type StandardCounter struct {
-	count int64
+	count   int64
+	created int64
 }
 
 // Clear sets the counter to zero.
 func (c *StandardCounter) Clear() {
 	atomic.StoreInt64(&c.count, 0)
+	atomic.StoreInt64(&c.created, time.Now().UnixNano())
 }
 
 // Count returns the current count.
@@ -96,6 +136,11 @@ func (c *StandardCounter) Count() int64 {
 	return atomic.LoadInt64(&c.count)
 }
 
+// Created returns the time the counter was constructed or last cleared.
+func (c *StandardCounter) Created() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.created))
+}
+
 // Dec decrements the counter by the given amount.
 func (c *StandardCounter) Dec(i int64) {
 	atomic.AddInt64(&c.count, -i)
@@ -110,3 +155,24 @@ func (c *StandardCounter) Inc(i int64) {
 func (c *StandardCounter) Snapshot() Counter {
 	return CounterSnapshot(c.Count())
 }
+
+// SnapshotAndClear returns a read-only copy of the counter and sets it to
+// zero in one atomic operation.
+func (c *StandardCounter) SnapshotAndClear() Counter {
+	defer atomic.StoreInt64(&c.created, time.Now().UnixNano())
+	return CounterSnapshot(atomic.SwapInt64(&c.count, 0))
+}
+
+// checkpoint returns the count and creation time of the counter.
+func (c *StandardCounter) checkpoint() *persistedState {
+	return &persistedState{Count: c.Count(), Start: c.Created()}
+}
+
+// restore adds a checkpointed count to the counter and takes the
+// checkpointed creation time if it is earlier.
+func (c *StandardCounter) restore(s *persistedState) {
+	atomic.AddInt64(&c.count, s.Count)
+	if !s.Start.IsZero() && s.Start.UnixNano() < atomic.LoadInt64(&c.created) {
+		atomic.StoreInt64(&c.created, s.Start.UnixNano())
+	}
+}
@@ -1,6 +1,9 @@
 package metrics
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func BenchmarkCounter(b *testing.B) {
 	c := NewCounter()
@@ -75,3 +78,40 @@ func TestGetOrRegisterCounter(t *testing.T) {
 		t.Fatal(c)
 	}
 }
+
+func TestCounterSnapshotMerge(t *testing.T) {
+	c := NewCounter()
+	c.Inc(47)
+	if count := CounterSnapshot(3).Merge(c).Count(); 50 != count {
+		t.Errorf("c.Count(): 50 != %v\n", count)
+	}
+}
+
+func TestCounterSnapshotAndClear(t *testing.T) {
+	c := NewCounter()
+	c.Inc(47)
+	snapshot := c.SnapshotAndClear()
+	c.Inc(1)
+	if count := snapshot.Count(); 47 != count {
+		t.Errorf("snapshot.Count(): 47 != %v\n", count)
+	}
+	if count := c.Count(); 1 != count {
+		t.Errorf("c.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestCounterCreated(t *testing.T) {
+	before := time.Now()
+	c := NewCounter().(*StandardCounter)
+	if created := c.Created(); created.Before(before) || created.After(time.Now()) {
+		t.Errorf("c.Created(): %v\n", created)
+	}
+	time.Sleep(time.Millisecond)
+	c.Clear()
+	if created := c.Created(); !created.After(before.Add(time.Millisecond)) {
+		t.Errorf("c.Created() after Clear: %v\n", created)
+	}
+	if created := c.Snapshot().(CounterSnapshot).Created(); !created.IsZero() {
+		t.Errorf("c.Snapshot().Created(): %v\n", created)
+	}
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"runtime/debug"
 	"time"
 )
@@ -22,9 +23,16 @@ var (
 // Capture new values for the Go garbage collector statistics exported in
 // debug.GCStats.  This is designed to be called as a goroutine.
 func CaptureDebugGCStats(r Registry, d time.Duration) {
-	for _ = range time.Tick(d) {
+	CaptureDebugGCStatsContext(context.Background(), r, d)
+}
+
+// CaptureDebugGCStatsContext is just like CaptureDebugGCStats, but it
+// returns after capturing one final time once ctx is done.
+func CaptureDebugGCStatsContext(ctx context.Context, r Registry, d time.Duration) {
+	RunReporter(ctx, d, func() error {
 		CaptureDebugGCStatsOnce(r)
-	}
+		return nil
+	}, nil)
 }
 
 // Capture new values for the Go garbage collector statistics exported in
@@ -0,0 +1,119 @@
+package metrics
+
+import "sync"
+
+// DeltaRegistry wraps a Registry so that exporters reading from it see the
+// change in each metric since their last flush rather than its cumulative
+// value, as backends such as StatsD, Librato counters and CloudWatch want.
+//
+// Counters and the counts of meters are reported as the difference from the
+// count seen by the previous flush.  Histograms, bucket histograms and timers
+// are snapshotted and cleared at once, so that no value recorded between the
+// two is lost.  Gauges, healthchecks and read-only snapshots, such as those
+// registered by ReadJSON and MergeRegistries, are passed through unchanged.
+//
+// Every call to Each or EachTagged consumes the change it reports, so each
+// exporter needs a DeltaRegistry of its own.  The last counts are kept by
+// each DeltaRegistry, but histograms and timers are cleared in the wrapped
+// registry itself: if they are read by more than one DeltaRegistry, or by
+// any other exporter, each reader only sees the values recorded since the
+// last read by any of them.
+type DeltaRegistry struct {
+	Registry
+	counts map[string]int64
+	mutex  sync.Mutex
+}
+
+// NewDeltaRegistry constructs a new DeltaRegistry which reports the changes
+// to the metrics in r.
+func NewDeltaRegistry(r Registry) Registry {
+	return &DeltaRegistry{
+		Registry: r,
+		counts:   make(map[string]int64),
+	}
+}
+
+// Call the given function with the change in each registered metric since
+// the last call.
+func (r *DeltaRegistry) Each(f func(string, interface{})) {
+	r.EachTagged(func(name string, tags Tags, i interface{}) {
+		f(eachName(MetricID{name, tags}), i)
+	})
+}
+
+// Call the given function with the name, tags and change in each registered
+// metric since the last call.
+func (r *DeltaRegistry) EachTagged(f func(string, Tags, interface{})) {
+	r.Registry.EachTagged(func(name string, tags Tags, i interface{}) {
+		f(name, tags, r.delta(MetricID{name, tags}.String(), i))
+	})
+}
+
+// MarshalJSON returns a byte slice containing a JSON representation of the
+// change in each metric since the last flush.
+func (r *DeltaRegistry) MarshalJSON() ([]byte, error) {
+	return marshalJSON(r, OutputOptions{})
+}
+
+// Unregister the metric with the given name and forget its last count.
+func (r *DeltaRegistry) Unregister(name string) {
+	r.Registry.Unregister(name)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key := MetricID{Name: name}.String()
+	if _, ok := r.counts[key]; !ok {
+		key = name
+	}
+	delete(r.counts, key)
+}
+
+// Unregister the metric with the given name and tags and forget its last
+// count.
+func (r *DeltaRegistry) UnregisterTagged(name string, tags Tags) {
+	r.Registry.UnregisterTagged(name, tags)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.counts, MetricID{name, tags}.String())
+}
+
+// Unregister all metrics and forget their last counts.
+func (r *DeltaRegistry) UnregisterAll() {
+	r.Registry.UnregisterAll()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.counts = make(map[string]int64)
+}
+
+// delta returns the change in a metric since the last flush.
+func (r *DeltaRegistry) delta(name string, i interface{}) interface{} {
+	switch metric := i.(type) {
+	case CounterSnapshot, *BucketHistogramSnapshot, *HistogramSnapshot, *HistogramSnapshotFloat64, *MeterSnapshot, *TimerSnapshot:
+		return i
+	case Counter:
+		count := metric.Count()
+		return CounterSnapshot(count - r.swap(name, count))
+	case BucketHistogram:
+		return metric.SnapshotAndClear()
+	case Histogram:
+		return metric.SnapshotAndClear()
+	case HistogramFloat64:
+		return metric.SnapshotAndClear()
+	case Meter:
+		snapshot := (&MeterSnapshot{}).Merge(metric)
+		snapshot.count -= r.swap(name, snapshot.count)
+		return snapshot
+	case Timer:
+		return metric.SnapshotAndClear()
+	}
+	return i
+}
+
+// swap records the count of the named metric and returns the one recorded
+// by the last flush.
+func (r *DeltaRegistry) swap(name string, count int64) int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	last := r.counts[name]
+	r.counts[name] = count
+	return last
+}
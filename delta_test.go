@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeltaRegistry(t *testing.T) {
+	r := NewRegistry()
+	defer r.UnregisterAll()
+	c := NewRegisteredCounter("counter", r)
+	g := NewRegisteredGauge("gauge", r)
+	h := NewRegisteredHistogram("histogram", r, NewUniformSample(100))
+	m := NewRegisteredMeter("meter", r)
+	tm := NewRegisteredTimer("timer", r)
+	b := NewRegisteredBucketHistogram("buckets", r, []float64{1})
+	d := NewDeltaRegistry(r)
+
+	c.Inc(3)
+	g.Update(47)
+	h.Update(1)
+	m.Mark(2)
+	tm.Update(time.Second)
+	b.Update(0.5)
+	if count := d.Get("counter").(Counter).Count(); 3 != count {
+		t.Errorf("d.Get(\"counter\"): 3 != %v\n", count)
+	}
+	deltas := func() map[string]interface{} {
+		metrics := make(map[string]interface{})
+		d.Each(func(name string, i interface{}) { metrics[name] = i })
+		return metrics
+	}
+	metrics := deltas()
+	if count := metrics["counter"].(Counter).Count(); 3 != count {
+		t.Errorf("counter: 3 != %v\n", count)
+	}
+	if count := metrics["histogram"].(Histogram).Count(); 1 != count {
+		t.Errorf("histogram: 1 != %v\n", count)
+	}
+	if count := metrics["meter"].(Meter).Count(); 2 != count {
+		t.Errorf("meter: 2 != %v\n", count)
+	}
+	if count := metrics["timer"].(Timer).Count(); 1 != count {
+		t.Errorf("timer: 1 != %v\n", count)
+	}
+	if count := metrics["buckets"].(BucketHistogram).Count(); 1 != count {
+		t.Errorf("buckets: 1 != %v\n", count)
+	}
+
+	c.Inc(1)
+	m.Mark(1)
+	metrics = deltas()
+	if count := metrics["counter"].(Counter).Count(); 1 != count {
+		t.Errorf("counter: 1 != %v\n", count)
+	}
+	if count := metrics["histogram"].(Histogram).Count(); 0 != count {
+		t.Errorf("histogram: 0 != %v\n", count)
+	}
+	if count := metrics["meter"].(Meter).Count(); 1 != count {
+		t.Errorf("meter: 1 != %v\n", count)
+	}
+	if count := metrics["timer"].(Timer).Count(); 0 != count {
+		t.Errorf("timer: 0 != %v\n", count)
+	}
+	if value := metrics["gauge"].(Gauge).Value(); 47 != value {
+		t.Errorf("gauge: 47 != %v\n", value)
+	}
+	if count := c.Count(); 4 != count {
+		t.Errorf("c.Count(): 4 != %v\n", count)
+	}
+}
+
+func TestDeltaRegistryUnregister(t *testing.T) {
+	d := NewDeltaRegistry(NewRegistry())
+	NewRegisteredCounter("counter", d).Inc(3)
+	d.Each(func(string, interface{}) {})
+	d.Unregister("counter")
+	NewRegisteredCounter("counter", d).Inc(2)
+	d.Each(func(name string, i interface{}) {
+		if count := i.(Counter).Count(); 2 != count {
+			t.Errorf("counter: 2 != %v\n", count)
+		}
+	})
+}
+
+func TestDeltaRegistrySnapshots(t *testing.T) {
+	src := NewRegistry()
+	NewRegisteredHistogram("histogram", src, NewUniformSample(100)).Update(1)
+	NewRegisteredHistogramFloat64("float64", src, NewUniformSampleFloat64(100)).Update(1)
+	NewRegisteredBucketHistogram("buckets", src, []float64{1}).Update(1)
+	tm := NewRegisteredTimer("timer", src)
+	defer tm.Stop()
+	tm.Update(1)
+	dst := NewRegistry()
+	MergeRegistries(dst, src)
+	d := NewDeltaRegistry(dst)
+	for i := 0; i < 2; i++ {
+		n := 0
+		d.Each(func(name string, i interface{}) {
+			n++
+			if count := i.(interface {
+				Count() int64
+			}).Count(); 1 != count {
+				t.Errorf("%s: 1 != %v\n", name, count)
+			}
+		})
+		if 4 != n {
+			t.Errorf("metrics: 4 != %v\n", n)
+		}
+	}
+}
+
+func TestDeltaRegistryReadJSON(t *testing.T) {
+	r := NewRegistry()
+	err := ReadJSON(r, strings.NewReader(`{"counter":{"count":3},"meter":{"count":5,"1m.rate":1,"5m.rate":1,"15m.rate":1,"mean.rate":1}}`))
+	if nil != err {
+		t.Fatal(err)
+	}
+	d := NewDeltaRegistry(r)
+	for i := 0; i < 2; i++ {
+		d.Each(func(name string, i interface{}) {
+			if count := i.(interface {
+				Count() int64
+			}).Count(); "counter" == name && 3 != count || "meter" == name && 5 != count {
+				t.Errorf("%s: %v\n", name, count)
+			}
+		})
+	}
+}
+
+func TestDeltaRegistryConcurrent(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredHistogram("histogram", r, NewUniformSample(100000))
+	d := NewDeltaRegistry(r)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				h.Update(1)
+			}
+		}()
+	}
+	var total int64
+	flush := func() {
+		d.Each(func(name string, i interface{}) { total += i.(Histogram).Count() })
+	}
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	for {
+		select {
+		case <-done:
+			flush()
+			if 40000 != total {
+				t.Errorf("total: 40000 != %v\n", total)
+			}
+			return
+		default:
+			flush()
+		}
+	}
+}
+
+func TestDeltaRegistryMarshalJSON(t *testing.T) {
+	d := NewDeltaRegistry(NewRegistry())
+	NewRegisteredCounter("counter", d).Inc(1)
+	json.Marshal(d)
+	b, err := json.Marshal(d)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s := string(b); "{\"counter\":{\"count\":0}}" != s {
+		t.Fatal(s)
+	}
+}
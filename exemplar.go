@@ -0,0 +1,41 @@
+package metrics
+
+import "time"
+
+// Exemplar is a single value recorded along with labels, such as a trace ID,
+// which identify the event it was recorded for.
+type Exemplar struct {
+	Labels    Tags
+	Value     float64
+	Timestamp time.Time
+}
+
+// newExemplar copies the labels so that the caller remains free to modify
+// them.
+func newExemplar(v float64, labels Tags) *Exemplar {
+	e := &Exemplar{Labels: make(Tags, len(labels)), Value: v, Timestamp: time.Now()}
+	for k, l := range labels {
+		e.Labels[k] = l
+	}
+	return e
+}
+
+// exemplarOf returns the last exemplar of a histogram or timer which records
+// them, or nil.  Exemplars aren't part of the Histogram and Timer interfaces
+// so that other implementations of them need not record any.
+func exemplarOf(i interface{}) *Exemplar {
+	if e, ok := i.(interface {
+		Exemplar() *Exemplar
+	}); ok {
+		return e.Exemplar()
+	}
+	return nil
+}
+
+// laterExemplar returns whichever of two exemplars was recorded last.
+func laterExemplar(a, b *Exemplar) *Exemplar {
+	if nil == a || nil != b && b.Timestamp.After(a.Timestamp) {
+		return b
+	}
+	return a
+}
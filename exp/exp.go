@@ -14,6 +14,7 @@ import (
 type exp struct {
 	expvarLock sync.Mutex // expvar panics if you try to register the same var twice, so we must probe it safely
 	registry   metrics.Registry
+	options    metrics.OutputOptions
 }
 
 func (exp *exp) expHandler(w http.ResponseWriter, r *http.Request) {
@@ -46,7 +47,14 @@ func Exp(r metrics.Registry) {
 
 // ExpHandler will return an expvar powered metrics handler.
 func ExpHandler(r metrics.Registry) http.Handler {
-	e := exp{sync.Mutex{}, r}
+	return ExpHandlerWithOptions(r, metrics.OutputOptions{})
+}
+
+// ExpHandlerWithOptions is just like ExpHandler, but the handler publishes
+// the percentiles and fields chosen by o, under names such as
+// "latency.999-percentile", and timings in o.DurationUnit.
+func ExpHandlerWithOptions(r metrics.Registry, o metrics.OutputOptions) http.Handler {
+	e := exp{sync.Mutex{}, r, o.WithDefaults()}
 	return http.HandlerFunc(e.expHandler)
 }
 
@@ -91,47 +99,71 @@ func (exp *exp) publishGaugeFloat64(name string, metric metrics.GaugeFloat64) {
 	exp.getFloat(name).Set(metric.Value())
 }
 
+// setFloat publishes a statistic if the field is included.
+func (exp *exp) setFloat(f metrics.Fields, name string, v float64) {
+	if exp.options.Has(f) {
+		exp.getFloat(name).Set(v)
+	}
+}
+
+func (exp *exp) publishPercentiles(name string, s interface{ Percentiles([]float64) []float64 }, div float64) {
+	if exp.options.Has(metrics.FieldPercentiles) {
+		for i, p := range s.Percentiles(exp.options.Percentiles) {
+			exp.getFloat(name + "." + metrics.PercentileKey(exp.options.Percentiles[i]) + "-percentile").Set(p / div)
+		}
+	}
+}
+
 func (exp *exp) publishHistogram(name string, metric metrics.Histogram) {
 	h := metric.Snapshot()
-	ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-	exp.getInt(name + ".count").Set(h.Count())
-	exp.getFloat(name + ".min").Set(float64(h.Min()))
-	exp.getFloat(name + ".max").Set(float64(h.Max()))
-	exp.getFloat(name + ".mean").Set(float64(h.Mean()))
-	exp.getFloat(name + ".std-dev").Set(float64(h.StdDev()))
-	exp.getFloat(name + ".50-percentile").Set(float64(ps[0]))
-	exp.getFloat(name + ".75-percentile").Set(float64(ps[1]))
-	exp.getFloat(name + ".95-percentile").Set(float64(ps[2]))
-	exp.getFloat(name + ".99-percentile").Set(float64(ps[3]))
-	exp.getFloat(name + ".999-percentile").Set(float64(ps[4]))
+	if exp.options.Has(metrics.FieldCount) {
+		exp.getInt(name + ".count").Set(h.Count())
+	}
+	exp.setFloat(metrics.FieldMin, name+".min", float64(h.Min()))
+	exp.setFloat(metrics.FieldMax, name+".max", float64(h.Max()))
+	exp.setFloat(metrics.FieldMean, name+".mean", h.Mean())
+	exp.setFloat(metrics.FieldStdDev, name+".std-dev", h.StdDev())
+	exp.publishPercentiles(name, h, 1)
+}
+
+func (exp *exp) publishHistogramFloat64(name string, metric metrics.HistogramFloat64) {
+	h := metric.Snapshot()
+	if exp.options.Has(metrics.FieldCount) {
+		exp.getInt(name + ".count").Set(h.Count())
+	}
+	exp.setFloat(metrics.FieldMin, name+".min", h.Min())
+	exp.setFloat(metrics.FieldMax, name+".max", h.Max())
+	exp.setFloat(metrics.FieldMean, name+".mean", h.Mean())
+	exp.setFloat(metrics.FieldStdDev, name+".std-dev", h.StdDev())
+	exp.publishPercentiles(name, h, 1)
 }
 
 func (exp *exp) publishMeter(name string, metric metrics.Meter) {
 	m := metric.Snapshot()
-	exp.getInt(name + ".count").Set(m.Count())
-	exp.getFloat(name + ".one-minute").Set(float64(m.Rate1()))
-	exp.getFloat(name + ".five-minute").Set(float64(m.Rate5()))
-	exp.getFloat(name + ".fifteen-minute").Set(float64((m.Rate15())))
-	exp.getFloat(name + ".mean").Set(float64(m.RateMean()))
+	if exp.options.Has(metrics.FieldCount) {
+		exp.getInt(name + ".count").Set(m.Count())
+	}
+	exp.setFloat(metrics.FieldRates, name+".one-minute", m.Rate1())
+	exp.setFloat(metrics.FieldRates, name+".five-minute", m.Rate5())
+	exp.setFloat(metrics.FieldRates, name+".fifteen-minute", m.Rate15())
+	exp.setFloat(metrics.FieldRates, name+".mean", m.RateMean())
 }
 
 func (exp *exp) publishTimer(name string, metric metrics.Timer) {
 	t := metric.Snapshot()
-	ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-	exp.getInt(name + ".count").Set(t.Count())
-	exp.getFloat(name + ".min").Set(float64(t.Min()))
-	exp.getFloat(name + ".max").Set(float64(t.Max()))
-	exp.getFloat(name + ".mean").Set(float64(t.Mean()))
-	exp.getFloat(name + ".std-dev").Set(float64(t.StdDev()))
-	exp.getFloat(name + ".50-percentile").Set(float64(ps[0]))
-	exp.getFloat(name + ".75-percentile").Set(float64(ps[1]))
-	exp.getFloat(name + ".95-percentile").Set(float64(ps[2]))
-	exp.getFloat(name + ".99-percentile").Set(float64(ps[3]))
-	exp.getFloat(name + ".999-percentile").Set(float64(ps[4]))
-	exp.getFloat(name + ".one-minute").Set(float64(t.Rate1()))
-	exp.getFloat(name + ".five-minute").Set(float64(t.Rate5()))
-	exp.getFloat(name + ".fifteen-minute").Set(float64((t.Rate15())))
-	exp.getFloat(name + ".mean-rate").Set(float64(t.RateMean()))
+	du := float64(exp.options.DurationUnit)
+	if exp.options.Has(metrics.FieldCount) {
+		exp.getInt(name + ".count").Set(t.Count())
+	}
+	exp.setFloat(metrics.FieldMin, name+".min", float64(t.Min())/du)
+	exp.setFloat(metrics.FieldMax, name+".max", float64(t.Max())/du)
+	exp.setFloat(metrics.FieldMean, name+".mean", t.Mean()/du)
+	exp.setFloat(metrics.FieldStdDev, name+".std-dev", t.StdDev()/du)
+	exp.publishPercentiles(name, t, du)
+	exp.setFloat(metrics.FieldRates, name+".one-minute", t.Rate1())
+	exp.setFloat(metrics.FieldRates, name+".five-minute", t.Rate5())
+	exp.setFloat(metrics.FieldRates, name+".fifteen-minute", t.Rate15())
+	exp.setFloat(metrics.FieldRates, name+".mean-rate", t.RateMean())
 }
 
 func (exp *exp) syncToExpvar() {
@@ -145,6 +177,8 @@ func (exp *exp) syncToExpvar() {
 			exp.publishGaugeFloat64(name, i.(metrics.GaugeFloat64))
 		case metrics.Histogram:
 			exp.publishHistogram(name, i.(metrics.Histogram))
+		case metrics.HistogramFloat64:
+			exp.publishHistogramFloat64(name, i.(metrics.HistogramFloat64))
 		case metrics.Meter:
 			exp.publishMeter(name, i.(metrics.Meter))
 		case metrics.Timer:
@@ -57,6 +57,12 @@ func NewRegisteredFunctionalGauge(name string, r Registry, f func() int64) Gauge
 // GaugeSnapshot is a read-only copy of another Gauge.
 type GaugeSnapshot int64
 
+// Merge returns a snapshot whose value is the sum of this snapshot's and
+// another Gauge's.
+func (g GaugeSnapshot) Merge(o Gauge) GaugeSnapshot {
+	return g + GaugeSnapshot(o.Value())
+}
+
 // Snapshot returns the snapshot.
 func (g GaugeSnapshot) Snapshot() Gauge { return g }
 
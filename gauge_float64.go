@@ -59,6 +59,12 @@ func NewRegisteredFunctionalGaugeFloat64(name string, r Registry, f func() float
 // GaugeFloat64Snapshot is a read-only copy of another GaugeFloat64.
 type GaugeFloat64Snapshot float64
 
+// Merge returns a snapshot whose value is the sum of this snapshot's and
+// another GaugeFloat64's.
+func (g GaugeFloat64Snapshot) Merge(o GaugeFloat64) GaugeFloat64Snapshot {
+	return g + GaugeFloat64Snapshot(o.Value())
+}
+
 // Snapshot returns the snapshot.
 func (g GaugeFloat64Snapshot) Snapshot() GaugeFloat64 { return g }
 
@@ -2,25 +2,45 @@ package metrics
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // GraphiteConfig provides a container with configuration parameters for
 // the Graphite exporter
 type GraphiteConfig struct {
-	Addr          *net.TCPAddr  // Network address to connect to
-	Registry      Registry      // Registry to be exported
-	FlushInterval time.Duration // Flush interval
-	DurationUnit  time.Duration // Time conversion unit for durations
-	Prefix        string        // Prefix to be prepended to metric names
-	Percentiles   []float64     // Percentiles to export from timers and histograms
+	Addr            *net.TCPAddr         // Network address to connect to
+	UDPAddr         *net.UDPAddr         // Network address to send datagrams to instead of Addr
+	Registry        Registry             // Registry to be exported
+	FlushInterval   time.Duration        // Flush interval
+	DurationUnit    time.Duration        // Time conversion unit for durations
+	Prefix          string               // Prefix to be prepended to metric names
+	Percentiles     []float64            // Percentiles to export from timers and histograms
+	Pickle          bool                 // Send batches with the pickle protocol, usually on port 2004
+	PickleBatchSize int                  // Datapoints per pickle message, 500 if not positive
+	MaxPacketSize   int                  // Largest datagram to send, 1432 bytes if not positive
+	RetryBackoff    time.Duration        // Delay before reconnecting, doubled after each failure, 1s if not positive
+	MaxRetryBackoff time.Duration        // Longest delay before reconnecting, 1m if not positive
+	TaggedSeries    bool                 // Send tags as Carbon 1.1 tags rather than path components
+	Tags            Tags                 // Tags to be added to every series, implies TaggedSeries
+	TagExtractor    GraphiteTagExtractor // Derives each series' name and tags from a metric's, implies TaggedSeries
 }
 
+// GraphiteTagExtractor derives the name and tags of a Graphite series from
+// those of a metric, for example to move part of a dotted name into a tag.
+// It's passed a copy of the metric's tags, merged with the static ones, which
+// it may modify and return.
+type GraphiteTagExtractor func(name string, tags Tags) (string, Tags)
+
 // Graphite is a blocking exporter function which reports metrics in r
 // to a graphite server located at addr, flushing them every d duration
 // and prepending metric names with prefix.
@@ -38,12 +58,17 @@ func Graphite(r Registry, d time.Duration, prefix string, addr *net.TCPAddr) {
 // GraphiteWithConfig is a blocking exporter function just like Graphite,
 // but it takes a GraphiteConfig instead.
 func GraphiteWithConfig(c GraphiteConfig) {
+	GraphiteContext(context.Background(), c, nil)
+}
+
+// GraphiteContext is a blocking exporter function just like
+// GraphiteWithConfig, but it returns after a final flush once ctx is done
+// and passes each failed flush to onError instead of logging it.
+func GraphiteContext(ctx context.Context, c GraphiteConfig, onError func(error)) {
 	log.Printf("WARNING: This go-metrics client has been DEPRECATED! It has been moved to https://github.com/cyberdelia/go-metrics-graphite and will be removed from rcrowley/go-metrics on August 12th 2015")
-	for _ = range time.Tick(c.FlushInterval) {
-		if err := graphite(&c); nil != err {
-			log.Println(err)
-		}
-	}
+	g := NewGraphiteReporter(c)
+	defer g.Close()
+	RunReporter(ctx, c.FlushInterval, g.Flush, onError)
 }
 
 // GraphiteOnce performs a single submission to Graphite, returning a
@@ -51,63 +76,345 @@ func GraphiteWithConfig(c GraphiteConfig) {
 // similar to GraphiteWithConfig for custom error handling.
 func GraphiteOnce(c GraphiteConfig) error {
 	log.Printf("WARNING: This go-metrics client has been DEPRECATED! It has been moved to https://github.com/cyberdelia/go-metrics-graphite and will be removed from rcrowley/go-metrics on August 12th 2015")
-	return graphite(&c)
+	g := NewGraphiteReporter(c)
+	defer g.Close()
+	return g.Flush()
+}
+
+// GraphiteReporter sends the metrics in a registry to Graphite over a
+// connection it keeps open between flushes.  When the connection fails it
+// is closed and not dialed again until RetryBackoff has passed, a delay
+// which doubles with each further failure up to MaxRetryBackoff.
+//
+// Datapoints are sent with the plaintext protocol over TCP or UDP, or in
+// batches with the pickle protocol over TCP.
+//
+// Tags are appended to series names as path components, unless tagged series
+// are configured, in which case they're sent as Carbon 1.1 tags in the form
+// name;tag1=value1;tag2=value2.  Tag names and values are escaped following
+// Graphite's rules and tags left empty, or named "name", are dropped.
+type GraphiteReporter struct {
+	c       GraphiteConfig
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// NewGraphiteReporter constructs a new GraphiteReporter, replacing any
+// configured size or duration which isn't positive with its default.
+func NewGraphiteReporter(c GraphiteConfig) *GraphiteReporter {
+	if c.DurationUnit <= 0 {
+		c.DurationUnit = time.Nanosecond
+	}
+	if c.PickleBatchSize <= 0 {
+		c.PickleBatchSize = 500
+	}
+	if c.MaxPacketSize <= 0 {
+		c.MaxPacketSize = 1432
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = time.Second
+	}
+	if c.MaxRetryBackoff <= 0 {
+		c.MaxRetryBackoff = time.Minute
+	}
+	if c.MaxRetryBackoff < c.RetryBackoff {
+		c.MaxRetryBackoff = c.RetryBackoff
+	}
+	return &GraphiteReporter{c: c}
 }
 
-func graphite(c *GraphiteConfig) error {
+// Flush sends every metric in the registry, dialing Graphite first if the
+// reporter isn't connected.  It returns the first error encountered, after
+// which the connection is closed.
+func (g *GraphiteReporter) Flush() error {
+	points := graphitePoints(&g.c)
 	now := time.Now().Unix()
-	du := float64(c.DurationUnit)
-	conn, err := net.DialTCP("tcp", nil, c.Addr)
+	reused := nil != g.conn
+	sent, err := g.send(points, now)
+	if nil != err && reused && !sent {
+		// The server may have closed a connection left idle since the
+		// last flush, so reconnect once straight away.  Datapoints are
+		// only sent again if none of them reached the old connection, so
+		// that none is sent twice.
+		_, err = g.send(points, now)
+	}
 	if nil != err {
+		if 0 == g.backoff {
+			g.backoff = g.c.RetryBackoff
+		} else if g.backoff *= 2; g.backoff > g.c.MaxRetryBackoff {
+			g.backoff = g.c.MaxRetryBackoff
+		}
+		g.retryAt = time.Now().Add(g.backoff)
 		return err
 	}
-	defer conn.Close()
-	w := bufio.NewWriter(conn)
-	c.Registry.Each(func(name string, i interface{}) {
+	g.backoff = 0
+	return nil
+}
+
+// Close closes the reporter's connection.
+func (g *GraphiteReporter) Close() error {
+	if nil == g.conn {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
+
+// send writes the datapoints to the connection, dialing it first if need be,
+// and reports whether any bytes were written.
+func (g *GraphiteReporter) send(points []graphitePoint, now int64) (bool, error) {
+	if nil == g.conn {
+		if err := g.dial(); nil != err {
+			return false, err
+		}
+	}
+	if 0 < g.c.FlushInterval {
+		g.conn.SetWriteDeadline(time.Now().Add(g.c.FlushInterval))
+	}
+	conn := &countingConn{Conn: g.conn}
+	var err error
+	switch {
+	case nil != g.c.UDPAddr:
+		w := &packetWriter{conn: conn, size: g.c.MaxPacketSize}
+		for _, p := range points {
+			w.add(p.line(now))
+		}
+		w.flush()
+		err = w.err
+	case g.c.Pickle:
+		for i := 0; i < len(points) && nil == err; i += g.c.PickleBatchSize {
+			end := i + g.c.PickleBatchSize
+			if end > len(points) {
+				end = len(points)
+			}
+			_, err = conn.Write(graphitePickle(points[i:end], now))
+		}
+	default:
+		w := bufio.NewWriter(conn)
+		for _, p := range points {
+			w.WriteString(p.line(now))
+			w.WriteByte('\n')
+		}
+		err = w.Flush()
+	}
+	if nil != err {
+		g.Close()
+	}
+	return 0 < conn.n, err
+}
+
+// countingConn counts the bytes written to a connection.
+type countingConn struct {
+	net.Conn
+	n int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.n += n
+	return n, err
+}
+
+func (g *GraphiteReporter) dial() error {
+	if now := time.Now(); now.Before(g.retryAt) {
+		return fmt.Errorf("graphite: not reconnecting for another %v", g.retryAt.Sub(now))
+	}
+	var err error
+	switch {
+	case nil != g.c.UDPAddr && g.c.Pickle:
+		return fmt.Errorf("graphite: the pickle protocol needs TCP")
+	case nil != g.c.UDPAddr:
+		g.conn, err = net.DialUDP("udp", nil, g.c.UDPAddr)
+	default:
+		g.conn, err = net.DialTCP("tcp", nil, g.c.Addr)
+	}
+	if nil != err {
+		g.conn = nil
+	}
+	return err
+}
+
+// graphitePoint is a single datapoint.  Its value is written to the
+// plaintext protocol with prec digits after the decimal point.
+type graphitePoint struct {
+	path  string
+	value float64
+	prec  int
+}
+
+func (p graphitePoint) line(now int64) string {
+	return p.path + " " + strconv.FormatFloat(p.value, 'f', p.prec, 64) + " " + strconv.FormatInt(now, 10)
+}
+
+// graphitePoints returns a datapoint for each field of each metric in the
+// registry.
+func graphitePoints(c *GraphiteConfig) []graphitePoint {
+	var points []graphitePoint
+	du := float64(c.DurationUnit)
+	tagged := c.TaggedSeries || 0 < len(c.Tags) || nil != c.TagExtractor
+	c.Registry.EachTagged(func(name string, tags Tags, i interface{}) {
+		var suffix string
+		if tagged {
+			all := make(Tags, len(c.Tags)+len(tags))
+			for k, v := range c.Tags {
+				all[k] = v
+			}
+			for k, v := range tags {
+				all[k] = v
+			}
+			tags = all
+			if nil != c.TagExtractor {
+				name, tags = c.TagExtractor(name, tags)
+			}
+			name = graphiteSeriesReplacer.Replace(name)
+			suffix = graphiteTags(tags)
+		} else {
+			name = graphiteName(name, tags)
+		}
+		if "" != c.Prefix {
+			name = c.Prefix + "." + name
+		}
+		point := func(field string, value float64, prec int) {
+			points = append(points, graphitePoint{name + "." + field + suffix, value, prec})
+		}
+		percentiles := func(ps []float64, div float64) {
+			for psIdx, psKey := range c.Percentiles {
+				key := PercentileKey(psKey)
+				point(key+"-percentile", ps[psIdx]/div, 2)
+			}
+		}
 		switch metric := i.(type) {
 		case Counter:
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, metric.Count(), now)
+			point("count", float64(metric.Count()), 0)
 		case Gauge:
-			fmt.Fprintf(w, "%s.%s.value %d %d\n", c.Prefix, name, metric.Value(), now)
+			point("value", float64(metric.Value()), 0)
 		case GaugeFloat64:
-			fmt.Fprintf(w, "%s.%s.value %f %d\n", c.Prefix, name, metric.Value(), now)
-		case Histogram:
+			point("value", metric.Value(), 6)
+		case BucketHistogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles(c.Percentiles)
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, h.Count(), now)
-			fmt.Fprintf(w, "%s.%s.min %d %d\n", c.Prefix, name, h.Min(), now)
-			fmt.Fprintf(w, "%s.%s.max %d %d\n", c.Prefix, name, h.Max(), now)
-			fmt.Fprintf(w, "%s.%s.mean %.2f %d\n", c.Prefix, name, h.Mean(), now)
-			fmt.Fprintf(w, "%s.%s.std-dev %.2f %d\n", c.Prefix, name, h.StdDev(), now)
-			for psIdx, psKey := range c.Percentiles {
-				key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-				fmt.Fprintf(w, "%s.%s.%s-percentile %.2f %d\n", c.Prefix, name, key, ps[psIdx], now)
+			point("count", float64(h.Count()), 0)
+			point("sum", h.Sum(), 6)
+			for _, b := range h.Buckets() {
+				bound := "inf"
+				if !math.IsInf(b.UpperBound, 1) {
+					bound = graphiteReplacer.Replace(bucketBound(b.UpperBound))
+				}
+				point("le_"+bound, float64(b.Count), 0)
 			}
+		case Histogram:
+			h := metric.Snapshot()
+			point("count", float64(h.Count()), 0)
+			point("min", float64(h.Min()), 0)
+			point("max", float64(h.Max()), 0)
+			point("mean", h.Mean(), 2)
+			point("std-dev", h.StdDev(), 2)
+			percentiles(h.Percentiles(c.Percentiles), 1)
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			point("count", float64(h.Count()), 0)
+			point("min", h.Min(), 6)
+			point("max", h.Max(), 6)
+			point("mean", h.Mean(), 2)
+			point("std-dev", h.StdDev(), 2)
+			percentiles(h.Percentiles(c.Percentiles), 1)
 		case Meter:
 			m := metric.Snapshot()
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, m.Count(), now)
-			fmt.Fprintf(w, "%s.%s.one-minute %.2f %d\n", c.Prefix, name, m.Rate1(), now)
-			fmt.Fprintf(w, "%s.%s.five-minute %.2f %d\n", c.Prefix, name, m.Rate5(), now)
-			fmt.Fprintf(w, "%s.%s.fifteen-minute %.2f %d\n", c.Prefix, name, m.Rate15(), now)
-			fmt.Fprintf(w, "%s.%s.mean %.2f %d\n", c.Prefix, name, m.RateMean(), now)
+			point("count", float64(m.Count()), 0)
+			point("one-minute", m.Rate1(), 2)
+			point("five-minute", m.Rate5(), 2)
+			point("fifteen-minute", m.Rate15(), 2)
+			point("mean", m.RateMean(), 2)
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles(c.Percentiles)
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, t.Count(), now)
-			fmt.Fprintf(w, "%s.%s.min %d %d\n", c.Prefix, name, t.Min()/int64(du), now)
-			fmt.Fprintf(w, "%s.%s.max %d %d\n", c.Prefix, name, t.Max()/int64(du), now)
-			fmt.Fprintf(w, "%s.%s.mean %.2f %d\n", c.Prefix, name, t.Mean()/du, now)
-			fmt.Fprintf(w, "%s.%s.std-dev %.2f %d\n", c.Prefix, name, t.StdDev()/du, now)
-			for psIdx, psKey := range c.Percentiles {
-				key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-				fmt.Fprintf(w, "%s.%s.%s-percentile %.2f %d\n", c.Prefix, name, key, ps[psIdx], now)
-			}
-			fmt.Fprintf(w, "%s.%s.one-minute %.2f %d\n", c.Prefix, name, t.Rate1(), now)
-			fmt.Fprintf(w, "%s.%s.five-minute %.2f %d\n", c.Prefix, name, t.Rate5(), now)
-			fmt.Fprintf(w, "%s.%s.fifteen-minute %.2f %d\n", c.Prefix, name, t.Rate15(), now)
-			fmt.Fprintf(w, "%s.%s.mean-rate %.2f %d\n", c.Prefix, name, t.RateMean(), now)
+			point("count", float64(t.Count()), 0)
+			point("min", float64(t.Min()/int64(du)), 0)
+			point("max", float64(t.Max()/int64(du)), 0)
+			point("mean", t.Mean()/du, 2)
+			point("std-dev", t.StdDev()/du, 2)
+			percentiles(t.Percentiles(c.Percentiles), du)
+			point("one-minute", t.Rate1(), 2)
+			point("five-minute", t.Rate5(), 2)
+			point("fifteen-minute", t.Rate15(), 2)
+			point("mean-rate", t.RateMean(), 2)
 		}
-		w.Flush()
 	})
-	return nil
+	return points
+}
+
+// graphitePickle encodes datapoints as a message for Graphite's pickle
+// receiver: a list of (path, (timestamp, value)) tuples in pickle protocol 2,
+// preceded by its length as a 32-bit big-endian integer.
+func graphitePickle(points []graphitePoint, now int64) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0, 0, 0, 0})
+	b.Write([]byte{0x80, 2, ']', '('}) // PROTO 2, EMPTY_LIST, MARK
+	var buf [8]byte
+	for _, p := range points {
+		b.WriteByte('X') // BINUNICODE
+		binary.LittleEndian.PutUint32(buf[:4], uint32(len(p.path)))
+		b.Write(buf[:4])
+		b.WriteString(p.path)
+		if now >= math.MinInt32 && now <= math.MaxInt32 {
+			b.WriteByte('J') // BININT
+			binary.LittleEndian.PutUint32(buf[:4], uint32(now))
+			b.Write(buf[:4])
+		} else {
+			b.Write([]byte{0x8a, 8}) // LONG1
+			binary.LittleEndian.PutUint64(buf[:], uint64(now))
+			b.Write(buf[:])
+		}
+		b.WriteByte('G') // BINFLOAT
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(p.value))
+		b.Write(buf[:])
+		b.Write([]byte{0x86, 0x86}) // TUPLE2, TUPLE2
+	}
+	b.Write([]byte{'e', '.'}) // APPENDS, STOP
+	msg := b.Bytes()
+	binary.BigEndian.PutUint32(msg, uint32(len(msg)-4))
+	return msg
+}
+
+// graphiteName appends each tag to the metric name as a pair of path
+// components, in sorted key order, since the plaintext protocol has no other
+// way to carry them.
+func graphiteName(name string, tags Tags) string {
+	for _, k := range tags.Keys() {
+		name += "." + graphiteReplacer.Replace(k) + "." + graphiteReplacer.Replace(tags[k])
+	}
+	return name
 }
+
+// graphiteTags renders tags as Carbon 1.1 tags, in sorted key order.  Tag
+// names may contain any ASCII character except ;!^= and values any character
+// except ; and may not begin with ~, so these are replaced, as are the
+// whitespace characters which would break the plaintext protocol.
+func graphiteTags(tags Tags) string {
+	var b bytes.Buffer
+	for _, k := range tags.Keys() {
+		key := strings.Map(func(r rune) rune {
+			if r > unicode.MaxASCII {
+				return '_'
+			}
+			return r
+		}, graphiteTagKeyReplacer.Replace(k))
+		value := graphiteTagValueReplacer.Replace(tags[k])
+		if "" == key || "" == value || "name" == key {
+			continue
+		}
+		if '~' == value[0] {
+			value = "_" + value[1:]
+		}
+		b.WriteString(";" + key + "=" + value)
+	}
+	return b.String()
+}
+
+var graphiteReplacer = strings.NewReplacer(".", "_", " ", "_")
+
+var graphiteSeriesReplacer = strings.NewReplacer(";", "_", " ", "_", "\n", "_", "\t", "_")
+
+var graphiteTagKeyReplacer = strings.NewReplacer(";", "_", "!", "_", "^", "_", "=", "_", " ", "_", "\n", "_", "\t", "_")
+
+var graphiteTagValueReplacer = strings.NewReplacer(";", "_", " ", "_", "\n", "_", "\t", "_")
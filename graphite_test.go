@@ -1,7 +1,14 @@
 package metrics
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
 	"net"
+	"strings"
+	"testing"
 	"time"
 )
 
@@ -20,3 +27,268 @@ func ExampleGraphiteWithConfig() {
 		Percentiles:   []float64{0.5, 0.75, 0.99, 0.999},
 	})
 }
+
+func TestGraphiteName(t *testing.T) {
+	if name := graphiteName("requests", Tags{"status": "200", "host": "a.example.com"}); "requests.host.a_example_com.status.200" != name {
+		t.Fatal(name)
+	}
+	if name := graphiteName("requests", nil); "requests" != name {
+		t.Fatal(name)
+	}
+}
+
+func graphiteServer(t *testing.T) (*net.TCPListener, <-chan string, func() int) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	lines := make(chan string, 1000)
+	accepted := make(chan struct{}, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if nil != err {
+				return
+			}
+			accepted <- struct{}{}
+			go func() {
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					lines <- s.Text()
+				}
+			}()
+		}
+	}()
+	return l, lines, func() int { return len(accepted) }
+}
+
+func TestGraphiteReporter(t *testing.T) {
+	l, lines, accepted := graphiteServer(t)
+	defer l.Close()
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	tm := NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(2 * time.Second)
+	g := NewGraphiteReporter(GraphiteConfig{
+		Addr:         l.Addr().(*net.TCPAddr),
+		Registry:     r,
+		DurationUnit: time.Millisecond,
+		Prefix:       "app",
+		Percentiles:  []float64{0.5},
+	})
+	defer g.Close()
+	for i := 0; i < 2; i++ {
+		if err := g.Flush(); nil != err {
+			t.Fatal(err)
+		}
+	}
+	got := make(map[string]int)
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 || got["app.requests.count 47"] < 2 || got["app.latency.50-percentile 2000.00"] < 2 {
+		select {
+		case line := <-lines:
+			fields := strings.Fields(line)
+			got[fields[0]+" "+fields[1]]++
+		case <-timeout:
+			t.Fatal(got)
+		}
+	}
+	if n := accepted(); 1 != n {
+		t.Errorf("connections: 1 != %v\n", n)
+	}
+}
+
+func TestGraphiteReporterBackoff(t *testing.T) {
+	l, _, _ := graphiteServer(t)
+	defer l.Close()
+	addr := l.Addr().(*net.TCPAddr)
+	g := NewGraphiteReporter(GraphiteConfig{
+		Addr:         addr,
+		Registry:     NewRegistry(),
+		RetryBackoff: time.Hour,
+	})
+	defer g.Close()
+	if err := g.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	g.Close()
+	g.c.Addr = &net.TCPAddr{IP: addr.IP, Port: 1}
+	if err := g.Flush(); nil == err {
+		t.Fatal("Flush to a closed port succeeded")
+	}
+	g.c.Addr = addr
+	if err := g.Flush(); nil == err || !strings.Contains(err.Error(), "not reconnecting") {
+		t.Fatal(err)
+	}
+}
+
+func TestGraphiteReporterPartialWrite(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		NewRegisteredCounter(name, r)
+	}
+	g := NewGraphiteReporter(GraphiteConfig{
+		Registry:        r,
+		Pickle:          true,
+		PickleBatchSize: 2,
+	})
+	conn := &failingConn{}
+	g.conn = conn
+	if err := g.Flush(); errFailingConn != err {
+		t.Fatal(err)
+	}
+	if 2 != conn.writes {
+		t.Errorf("writes: 2 != %v\n", conn.writes)
+	}
+}
+
+func TestGraphiteReporterDefaults(t *testing.T) {
+	g := NewGraphiteReporter(GraphiteConfig{PickleBatchSize: -1, MaxPacketSize: -1, RetryBackoff: -1, MaxRetryBackoff: -1})
+	if 500 != g.c.PickleBatchSize || 1432 != g.c.MaxPacketSize || time.Second != g.c.RetryBackoff || time.Minute != g.c.MaxRetryBackoff {
+		t.Errorf("g.c: %+v\n", g.c)
+	}
+}
+
+var errFailingConn = errors.New("connection reset")
+
+// failingConn accepts its first write and fails every one after.
+type failingConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *failingConn) Close() error { return nil }
+
+func (c *failingConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if c.writes++; 1 < c.writes {
+		return 0, errFailingConn
+	}
+	return len(b), nil
+}
+
+func TestGraphiteReporterUDP(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := NewRegistry()
+	NewRegisteredGauge("queue", r).Update(3)
+	g := NewGraphiteReporter(GraphiteConfig{
+		UDPAddr:  conn.LocalAddr().(*net.UDPAddr),
+		Registry: r,
+	})
+	defer g.Close()
+	if err := g.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if line := string(buf[:n]); !strings.HasPrefix(line, "queue.value 3 ") {
+		t.Fatal(line)
+	}
+}
+
+func TestGraphitePickle(t *testing.T) {
+	msg := graphitePickle([]graphitePoint{{"a.b", 1.5, 2}}, 1000)
+	expected := []byte{
+		0, 0, 0, 30,
+		0x80, 2, ']', '(',
+		'X', 3, 0, 0, 0, 'a', '.', 'b',
+		'J', 0xe8, 3, 0, 0,
+		'G', 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x86, 0x86,
+		'e', '.',
+	}
+	if !bytes.Equal(expected, msg) {
+		t.Fatalf("% x\n", msg)
+	}
+}
+
+func TestGraphiteReporterPickle(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		NewRegisteredCounter(name, r)
+	}
+	g := NewGraphiteReporter(GraphiteConfig{
+		Addr:            l.Addr().(*net.TCPAddr),
+		Registry:        r,
+		Pickle:          true,
+		PickleBatchSize: 2,
+	})
+	defer g.Close()
+	if err := g.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	conn, err := l.Accept()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, points := range []int{2, 1} {
+		var header [4]byte
+		if _, err := io.ReadFull(conn, header[:]); nil != err {
+			t.Fatal(err)
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(conn, body); nil != err {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(body, []byte{0x86, 0x86}); points != n {
+			t.Errorf("points: %v != %v\n", points, n)
+		}
+	}
+}
+
+func TestGraphiteTags(t *testing.T) {
+	tags := Tags{"host": "a b", "bad;key!": "~v;1", "empty": "", "name": "x", "ünï": "ünï"}
+	if s := graphiteTags(tags); ";bad_key_=_v_1;host=a_b;_n_=ünï" != s {
+		t.Fatal(s)
+	}
+}
+
+func TestGraphiteTaggedSeries(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("api.users.get", r).Inc(1)
+	r.RegisterTagged("requests", Tags{"status": "500"}, NewCounter())
+	c := GraphiteConfig{
+		Registry: r,
+		Prefix:   "app",
+		Tags:     Tags{"dc": "east", "status": "unknown"},
+		TagExtractor: func(name string, tags Tags) (string, Tags) {
+			if parts := strings.Split(name, "."); 3 == len(parts) {
+				tags["resource"] = parts[1]
+				return parts[0] + "." + parts[2], tags
+			}
+			return name, tags
+		},
+	}
+	paths := make(map[string]bool)
+	for _, p := range graphitePoints(&c) {
+		paths[p.path] = true
+	}
+	for _, path := range []string{
+		"app.api.get.count;dc=east;resource=users;status=unknown",
+		"app.requests.count;dc=east;status=500",
+	} {
+		if !paths[path] {
+			t.Error(path, paths)
+		}
+	}
+	if status := r.GetTagged("requests", Tags{"status": "500"}); nil == status {
+		t.Error("registry tags were modified")
+	}
+}
@@ -0,0 +1,557 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// HDRSample is a sample backed by a High Dynamic Range histogram.  Rather
+// than keeping a reservoir of values it counts every update in one of a fixed
+// number of buckets whose width grows with the values they hold, so it uses
+// constant memory and its percentiles are accurate to the configured number
+// of significant figures no matter how many values have been recorded.
+//
+// <http://hdrhistogram.org/>
+type HDRSample struct {
+	mutex sync.Mutex
+	h     *hdrHistogram
+}
+
+// NewHDRSample constructs a new HDR histogram sample which distinguishes
+// values from lowest up to highest to the given number of significant
+// figures, which must be between 1 and 5.  Lowest must be at least 1 and
+// highest at least twice lowest.  Values beyond highest are counted as
+// highest and negative values as zero when computing percentiles, but Min,
+// Max, Mean and Sum remain exact.
+func NewHDRSample(lowest, highest int64, sigfigs int) Sample {
+	if UseNilMetrics {
+		return NilSample{}
+	}
+	return &HDRSample{h: newHDRHistogram(lowest, highest, sigfigs)}
+}
+
+// Clear clears all samples.
+func (s *HDRSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.h.clear()
+}
+
+// Count returns the number of samples recorded.
+func (s *HDRSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.count
+}
+
+// ExponentialCounts returns the counts of the sample's values divided by
+// unit in the narrowest exponential buckets which are still wider than the
+// sample's own.
+func (s *HDRSample) ExponentialCounts(unit float64) ExponentialCounts {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.exponentialCounts(unit)
+}
+
+// Max returns the maximum value in the sample.
+func (s *HDRSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.max
+}
+
+// Mean returns the mean of the values in the sample.
+func (s *HDRSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.mean()
+}
+
+// Min returns the minimum value in the sample.
+func (s *HDRSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.min
+}
+
+// Percentile returns an arbitrary percentile of values in the sample.
+func (s *HDRSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// sample.
+func (s *HDRSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.percentiles(ps)
+}
+
+// Size returns the number of buckets holding at least one value.
+func (s *HDRSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.size()
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *HDRSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &HDRSampleSnapshot{h: s.h.copy()}
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *HDRSample) SnapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &HDRSampleSnapshot{h: s.h.copy()}
+	s.h.clear()
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (s *HDRSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return math.Sqrt(s.h.variance())
+}
+
+// Sum returns the sum of the values in the sample.
+func (s *HDRSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.sum
+}
+
+// Update samples a new value.
+func (s *HDRSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.h.update(v)
+}
+
+// Values returns one representative value from each bucket holding at least
+// one value, in ascending order.
+func (s *HDRSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.values()
+}
+
+// Variance returns the variance of the values in the sample.
+func (s *HDRSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.h.variance()
+}
+
+// checkpoint returns the non-empty buckets and the statistics of the sample.
+func (s *HDRSample) checkpoint() *persistedState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	h := s.h
+	p := &persistedHDR{Layout: h.layout(), Sum: h.sum, Min: h.min, Max: h.max, Mean: h.runningMean, M2: h.m2}
+	for i, count := range h.counts {
+		if 0 != count {
+			p.Indexes = append(p.Indexes, i)
+			p.Counts = append(p.Counts, count)
+		}
+	}
+	return &persistedState{Count: h.count, HDR: p}
+}
+
+// restore adds the buckets of a checkpoint to the sample, unless it was taken
+// of a sample with other bounds or precision.
+func (s *HDRSample) restore(st *persistedState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p := st.HDR
+	if nil == p || s.h.layout() != p.Layout || len(p.Indexes) != len(p.Counts) {
+		return
+	}
+	h := s.h.copy()
+	h.clear()
+	for i, index := range p.Indexes {
+		if index < 0 || len(h.counts) <= index {
+			return
+		}
+		h.counts[index] = p.Counts[i]
+	}
+	h.count, h.sum, h.min, h.max, h.runningMean, h.m2 = st.Count, p.Sum, p.Min, p.Max, p.Mean, p.M2
+	s.h.merge(h)
+}
+
+// HDRSampleSnapshot is a read-only copy of an HDRSample.
+type HDRSampleSnapshot struct {
+	h *hdrHistogram
+}
+
+// Clear panics.
+func (*HDRSampleSnapshot) Clear() {
+	panic("Clear called on an HDRSampleSnapshot")
+}
+
+// Count returns the count of inputs at the time the snapshot was taken.
+func (s *HDRSampleSnapshot) Count() int64 { return s.h.count }
+
+// ExponentialCounts returns the counts of values divided by unit in
+// exponential buckets at the time the snapshot was taken.
+func (s *HDRSampleSnapshot) ExponentialCounts(unit float64) ExponentialCounts {
+	return s.h.exponentialCounts(unit)
+}
+
+// Max returns the maximal value at the time the snapshot was taken.
+func (s *HDRSampleSnapshot) Max() int64 { return s.h.max }
+
+// Mean returns the mean value at the time the snapshot was taken.
+func (s *HDRSampleSnapshot) Mean() float64 { return s.h.mean() }
+
+// Min returns the minimal value at the time the snapshot was taken.
+func (s *HDRSampleSnapshot) Min() int64 { return s.h.min }
+
+// Percentile returns an arbitrary percentile of values at the time the
+// snapshot was taken.
+func (s *HDRSampleSnapshot) Percentile(p float64) float64 {
+	return s.h.percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values at the time
+// the snapshot was taken.
+func (s *HDRSampleSnapshot) Percentiles(ps []float64) []float64 {
+	return s.h.percentiles(ps)
+}
+
+// Size returns the number of non-empty buckets at the time the snapshot was
+// taken.
+func (s *HDRSampleSnapshot) Size() int { return s.h.size() }
+
+// Snapshot returns the snapshot.
+func (s *HDRSampleSnapshot) Snapshot() Sample { return s }
+
+// SnapshotAndClear panics.
+func (*HDRSampleSnapshot) SnapshotAndClear() Sample {
+	panic("SnapshotAndClear called on an HDRSampleSnapshot")
+}
+
+// StdDev returns the standard deviation of values at the time the snapshot
+// was taken.
+func (s *HDRSampleSnapshot) StdDev() float64 { return math.Sqrt(s.h.variance()) }
+
+// Sum returns the sum of values at the time the snapshot was taken.
+func (s *HDRSampleSnapshot) Sum() int64 { return s.h.sum }
+
+// Update panics.
+func (*HDRSampleSnapshot) Update(int64) {
+	panic("Update called on an HDRSampleSnapshot")
+}
+
+// Values returns one representative value from each non-empty bucket at the
+// time the snapshot was taken.
+func (s *HDRSampleSnapshot) Values() []int64 { return s.h.values() }
+
+// Variance returns the variance of values at the time the snapshot was taken.
+func (s *HDRSampleSnapshot) Variance() float64 { return s.h.variance() }
+
+// hdrHistogram is the unsynchronized histogram behind HDRSample.  Its counts
+// are laid out as in Gil Tene's HdrHistogram: bucket i covers values up to
+// subBucketCount << (i + unitMagnitude) in sub-buckets 1 << (i +
+// unitMagnitude) wide, and every bucket after the first shares its lower
+// half with the one before it, so only the upper half is stored.
+type hdrHistogram struct {
+	highest                     int64
+	unitMagnitude               uint
+	subBucketHalfCountMagnitude uint
+	subBucketCount              int
+	subBucketHalfCount          int
+	subBucketMask               int64
+	counts                      []int64
+	count, sum, min, max        int64
+	runningMean, m2             float64
+}
+
+func newHDRHistogram(lowest, highest int64, sigfigs int) *hdrHistogram {
+	if lowest < 1 {
+		panic(fmt.Sprintf("metrics: HDR sample lowest value %d is less than 1", lowest))
+	}
+	if highest < 2*lowest {
+		panic(fmt.Sprintf("metrics: HDR sample highest value %d is less than twice lowest value %d", highest, lowest))
+	}
+	if sigfigs < 1 || 5 < sigfigs {
+		panic(fmt.Sprintf("metrics: HDR sample significant figures %d not between 1 and 5", sigfigs))
+	}
+	largestSingleUnit := 2 * math.Pow10(sigfigs)
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestSingleUnit)))
+	h := &hdrHistogram{
+		highest:                     highest,
+		unitMagnitude:               uint(bitLen(uint64(lowest)) - 1),
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketCount:              1 << subBucketCountMagnitude,
+		subBucketHalfCount:          1 << (subBucketCountMagnitude - 1),
+	}
+	h.subBucketMask = int64(h.subBucketCount-1) << h.unitMagnitude
+
+	smallestUntrackable := int64(h.subBucketCount) << h.unitMagnitude
+	buckets := 1
+	for smallestUntrackable <= highest {
+		if smallestUntrackable > math.MaxInt64/2 {
+			buckets++
+			break
+		}
+		smallestUntrackable <<= 1
+		buckets++
+	}
+	h.counts = make([]int64, (buckets+1)*h.subBucketHalfCount)
+	return h
+}
+
+// layout identifies the bounds and precision of the histogram, which must
+// be the same for two histograms' counts to line up.
+func (h *hdrHistogram) layout() [3]int {
+	return [3]int{int(h.unitMagnitude), int(h.subBucketHalfCountMagnitude), len(h.counts)}
+}
+
+func (h *hdrHistogram) clear() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.count, h.sum, h.min, h.max = 0, 0, 0, 0
+	h.runningMean, h.m2 = 0, 0
+}
+
+func (h *hdrHistogram) copy() *hdrHistogram {
+	c := *h
+	c.counts = make([]int64, len(h.counts))
+	copy(c.counts, h.counts)
+	return &c
+}
+
+func (h *hdrHistogram) update(v int64) {
+	if 0 == h.count || v < h.min {
+		h.min = v
+	}
+	if 0 == h.count || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	// Welford's method keeps the variance exact without storing values.
+	delta := float64(v) - h.runningMean
+	h.runningMean += delta / float64(h.count)
+	h.m2 += delta * (float64(v) - h.runningMean)
+	if v < 0 {
+		v = 0
+	} else if v > h.highest {
+		v = h.highest
+	}
+	h.counts[h.countsIndexFor(v)]++
+}
+
+// merge adds the counts of another histogram, recounting them into this
+// one's sub-buckets if the two were made with different bounds or precision.
+func (h *hdrHistogram) merge(o *hdrHistogram) {
+	if 0 == o.count {
+		return
+	}
+	if 0 == h.count || o.min < h.min {
+		h.min = o.min
+	}
+	if 0 == h.count || o.max > h.max {
+		h.max = o.max
+	}
+	// Chan et al.'s parallel form of Welford's method combines the variances.
+	n := float64(h.count + o.count)
+	delta := o.runningMean - h.runningMean
+	h.m2 += o.m2 + delta*delta*float64(h.count)*float64(o.count)/n
+	h.runningMean += delta * float64(o.count) / n
+	h.count += o.count
+	h.sum += o.sum
+	same := len(h.counts) == len(o.counts) && h.unitMagnitude == o.unitMagnitude && h.subBucketHalfCountMagnitude == o.subBucketHalfCountMagnitude
+	for i, count := range o.counts {
+		if 0 == count {
+			continue
+		}
+		if same {
+			h.counts[i] += count
+			continue
+		}
+		v := o.valueFromIndex(i)
+		v += o.sizeOfEquivalentValueRange(v) >> 1
+		if v > h.highest {
+			v = h.highest
+		}
+		h.counts[h.countsIndexFor(v)] += count
+	}
+}
+
+// exponentialCounts recounts the histogram at the largest scale whose
+// buckets, about ln 2 / 2^scale of their values wide, are no narrower than
+// the sub-buckets of 1 / subBucketHalfCount.  Each sub-bucket's count goes to
+// the exponential bucket holding its middle value.
+func (h *hdrHistogram) exponentialCounts(unit float64) ExponentialCounts {
+	scale := int32(math.Floor(math.Log2(math.Ln2 * float64(h.subBucketHalfCount))))
+	if 20 < scale {
+		scale = 20
+	}
+	b := ExponentialCounts{Scale: scale}
+	factor := math.Ldexp(1, int(scale))
+	for i, count := range h.counts {
+		if 0 == count {
+			continue
+		}
+		v := h.valueFromIndex(i)
+		v += h.sizeOfEquivalentValueRange(v) >> 1
+		if v < h.min {
+			v = h.min
+		} else if v > h.max {
+			v = h.max
+		}
+		if v <= 0 {
+			b.ZeroCount += count
+			continue
+		}
+		index := int32(math.Ceil(math.Log2(float64(v)/unit)*factor)) - 1
+		if 0 == len(b.Counts) {
+			b.Offset = index
+		}
+		for int32(len(b.Counts)) <= index-b.Offset {
+			b.Counts = append(b.Counts, 0)
+		}
+		b.Counts[index-b.Offset] += count
+	}
+	return b
+}
+
+func (h *hdrHistogram) mean() float64 {
+	if 0 == h.count {
+		return 0.0
+	}
+	return float64(h.sum) / float64(h.count)
+}
+
+func (h *hdrHistogram) variance() float64 {
+	if 0 == h.count {
+		return 0.0
+	}
+	return h.m2 / float64(h.count)
+}
+
+// percentile returns the highest value equivalent to the one at which the
+// cumulative count reaches p of the total, bounded by the exact minimum and
+// maximum.
+func (h *hdrHistogram) percentile(p float64) float64 {
+	if 0 == h.count {
+		return 0.0
+	}
+	target := int64(p*float64(h.count) + 0.5)
+	if target < 1 {
+		target = 1
+	} else if target > h.count {
+		target = h.count
+	}
+	var total int64
+	for i, n := range h.counts {
+		total += n
+		if total >= target {
+			v := h.highestEquivalentValue(h.valueFromIndex(i))
+			if v < h.min {
+				v = h.min
+			} else if v > h.max {
+				v = h.max
+			}
+			return float64(v)
+		}
+	}
+	return float64(h.max)
+}
+
+func (h *hdrHistogram) percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	for i, p := range ps {
+		scores[i] = h.percentile(p)
+	}
+	return scores
+}
+
+func (h *hdrHistogram) size() int {
+	n := 0
+	for _, count := range h.counts {
+		if 0 != count {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *hdrHistogram) values() []int64 {
+	values := make([]int64, 0, h.size())
+	for i, count := range h.counts {
+		if 0 == count {
+			continue
+		}
+		v := h.valueFromIndex(i)
+		v += h.sizeOfEquivalentValueRange(v) >> 1
+		if v < h.min {
+			v = h.min
+		} else if v > h.max {
+			v = h.max
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func (h *hdrHistogram) bucketIndex(v int64) int {
+	return bitLen(uint64(v|h.subBucketMask)) - int(h.unitMagnitude) - int(h.subBucketHalfCountMagnitude+1)
+}
+
+func (h *hdrHistogram) subBucketIndex(v int64, bucketIdx int) int {
+	return int(v >> (uint(bucketIdx) + h.unitMagnitude))
+}
+
+func (h *hdrHistogram) countsIndexFor(v int64) int {
+	bucketIdx := h.bucketIndex(v)
+	subBucketIdx := h.subBucketIndex(v, bucketIdx)
+	return (bucketIdx+1)<<h.subBucketHalfCountMagnitude + subBucketIdx - h.subBucketHalfCount
+}
+
+// valueFromIndex returns the lowest value counted at index i of counts.
+func (h *hdrHistogram) valueFromIndex(i int) int64 {
+	bucketIdx := i>>h.subBucketHalfCountMagnitude - 1
+	subBucketIdx := i&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= h.subBucketHalfCount
+		bucketIdx = 0
+	}
+	return int64(subBucketIdx) << (uint(bucketIdx) + h.unitMagnitude)
+}
+
+func (h *hdrHistogram) sizeOfEquivalentValueRange(v int64) int64 {
+	bucketIdx := h.bucketIndex(v)
+	if h.subBucketIndex(v, bucketIdx) >= h.subBucketCount {
+		bucketIdx++
+	}
+	return 1 << (h.unitMagnitude + uint(bucketIdx))
+}
+
+func (h *hdrHistogram) highestEquivalentValue(v int64) int64 {
+	bucketIdx := h.bucketIndex(v)
+	lowest := int64(h.subBucketIndex(v, bucketIdx)) << (uint(bucketIdx) + h.unitMagnitude)
+	return lowest + h.sizeOfEquivalentValueRange(v) - 1
+}
+
+// bitLen returns the number of bits needed to represent x.
+func bitLen(x uint64) int {
+	n := 0
+	for ; x >= 0x100; x >>= 8 {
+		n += 8
+	}
+	for ; 0 != x; x >>= 1 {
+		n++
+	}
+	return n
+}
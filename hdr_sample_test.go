@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func BenchmarkHDRSample(b *testing.B) {
+	benchmarkSample(b, NewHDRSample(1, int64(time.Hour), 3))
+}
+
+func TestHDRSample(t *testing.T) {
+	s := NewHDRSample(1, 10000000, 3)
+	for i := 1; i <= 1000000; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 1000000 != count {
+		t.Errorf("s.Count(): 1000000 != %v\n", count)
+	}
+	if min := s.Min(); 1 != min {
+		t.Errorf("s.Min(): 1 != %v\n", min)
+	}
+	if max := s.Max(); 1000000 != max {
+		t.Errorf("s.Max(): 1000000 != %v\n", max)
+	}
+	if mean := s.Mean(); 500000.5 != mean {
+		t.Errorf("s.Mean(): 500000.5 != %v\n", mean)
+	}
+	if stdDev := s.StdDev(); 1e-6 < math.Abs(288675.13459466-stdDev)/stdDev {
+		t.Errorf("s.StdDev(): 288675.13459466 != %v\n", stdDev)
+	}
+	ps := s.Percentiles([]float64{0.5, 0.99, 0.999, 1.0})
+	for i, want := range []float64{500000, 990000, 999000, 1000000} {
+		if 1e-3 < math.Abs(ps[i]-want)/want {
+			t.Errorf("ps[%v]: %v not within 0.1%% of %v\n", i, ps[i], want)
+		}
+	}
+}
+
+func TestHDRSampleConstantMemory(t *testing.T) {
+	s := NewHDRSample(1, int64(time.Hour), 2).(*HDRSample)
+	n := len(s.h.counts)
+	for i := 0; i < 100000; i++ {
+		s.Update(int64(i) * int64(time.Millisecond))
+	}
+	s.Update(-1)
+	s.Update(2 * int64(time.Hour))
+	if len(s.h.counts) != n {
+		t.Errorf("len(counts): %v != %v\n", len(s.h.counts), n)
+	}
+	if min, max := s.Min(), s.Max(); -1 != min || 2*int64(time.Hour) != max {
+		t.Errorf("s.Min(), s.Max(): %v, %v\n", min, max)
+	}
+	if size := s.Size(); size != len(s.Values()) || size >= n {
+		t.Errorf("s.Size(): %v\n", size)
+	}
+}
+
+func TestHDRSampleSnapshot(t *testing.T) {
+	h := NewHistogram(NewHDRSample(1, 1000000, 3))
+	for i := 1; i <= 100; i++ {
+		h.Update(int64(i))
+	}
+	snapshot := h.Snapshot()
+	h.Update(1000)
+	if count := snapshot.Count(); 100 != count {
+		t.Errorf("snapshot.Count(): 100 != %v\n", count)
+	}
+	if max := snapshot.Max(); 100 != max {
+		t.Errorf("snapshot.Max(): 100 != %v\n", max)
+	}
+	if p99 := snapshot.Percentile(0.99); 99 != p99 {
+		t.Errorf("snapshot.Percentile(0.99): 99 != %v\n", p99)
+	}
+	h.Clear()
+	if count := h.Count(); 0 != count {
+		t.Errorf("h.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestHDRSampleTimer(t *testing.T) {
+	tm := NewCustomTimer(NewHistogram(NewHDRSample(1, int64(time.Minute), 3)), NewMeter())
+	defer tm.Stop()
+	tm.Update(time.Millisecond)
+	tm.Update(time.Second)
+	if p := tm.Snapshot().Percentile(1.0); float64(time.Second) != p {
+		t.Errorf("tm.Percentile(1.0): %v != %v\n", float64(time.Second), p)
+	}
+}
+
+func TestHDRSampleExponentialCounts(t *testing.T) {
+	s := NewHDRSample(1, 1000000, 3)
+	for _, v := range []int64{0, 1, 2, 4, 1000} {
+		s.Update(v)
+	}
+	b := s.(ExponentialSample).ExponentialCounts(1)
+	if 9 != b.Scale || 1 != b.ZeroCount || -1 != b.Offset {
+		t.Fatalf("b.Scale, b.ZeroCount, b.Offset: %v, %v, %v\n", b.Scale, b.ZeroCount, b.Offset)
+	}
+	base := math.Pow(2, math.Pow(2, -float64(b.Scale)))
+	var values []float64
+	for i, count := range b.Counts {
+		if 1 < count {
+			t.Errorf("b.Counts[%d]: %v\n", i, count)
+		} else if 1 == count {
+			values = append(values, math.Pow(base, float64(b.Offset)+float64(i)+1))
+		}
+	}
+	for i, v := range []float64{1, 2, 4, 1000} {
+		if i >= len(values) || v > values[i]*(1+1e-9) || v <= values[i]/base*(1+1e-9) {
+			t.Fatalf("bucket upper bounds %v don't hold %v\n", values, v)
+		}
+	}
+	if h := s.Snapshot().(ExponentialSample).ExponentialCounts(2); b.Offset-512 != h.Offset {
+		t.Errorf("offset in units of 2: %v != %v\n", b.Offset-512, h.Offset)
+	}
+}
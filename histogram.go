@@ -1,5 +1,7 @@
 package metrics
 
+import "sync"
+
 // Histograms calculate distribution statistics from a series of int64 values.
 type Histogram interface {
 	Clear()
@@ -11,6 +13,7 @@ type Histogram interface {
 	Percentiles([]float64) []float64
 	Sample() Sample
 	Snapshot() Histogram
+	SnapshotAndClear() Histogram
 	StdDev() float64
 	Sum() int64
 	Update(int64)
@@ -47,7 +50,8 @@ func NewRegisteredHistogram(name string, r Registry, s Sample) Histogram {
 
 // HistogramSnapshot is a read-only copy of another Histogram.
 type HistogramSnapshot struct {
-	sample *SampleSnapshot
+	sample   Sample
+	exemplar *Exemplar
 }
 
 // Clear panics.
@@ -59,6 +63,10 @@ func (*HistogramSnapshot) Clear() {
 // taken.
 func (h *HistogramSnapshot) Count() int64 { return h.sample.Count() }
 
+// Exemplar returns the last exemplar recorded at the time the snapshot was
+// taken, or nil.
+func (h *HistogramSnapshot) Exemplar() *Exemplar { return h.exemplar }
+
 // Max returns the maximum value in the sample at the time the snapshot was
 // taken.
 func (h *HistogramSnapshot) Max() int64 { return h.sample.Max() }
@@ -67,6 +75,16 @@ func (h *HistogramSnapshot) Max() int64 { return h.sample.Max() }
 // was taken.
 func (h *HistogramSnapshot) Mean() float64 { return h.sample.Mean() }
 
+// Merge returns a snapshot of the values of both this snapshot and another
+// Histogram, keeping whichever exemplar was recorded last.
+func (h *HistogramSnapshot) Merge(o Histogram) *HistogramSnapshot {
+	o = o.Snapshot()
+	return &HistogramSnapshot{
+		sample:   mergeSamples(h.sample, o.Sample()),
+		exemplar: laterExemplar(h.exemplar, exemplarOf(o)),
+	}
+}
+
 // Min returns the minimum value in the sample at the time the snapshot was
 // taken.
 func (h *HistogramSnapshot) Min() int64 { return h.sample.Min() }
@@ -89,6 +107,11 @@ func (h *HistogramSnapshot) Sample() Sample { return h.sample }
 // Snapshot returns the snapshot.
 func (h *HistogramSnapshot) Snapshot() Histogram { return h }
 
+// SnapshotAndClear panics.
+func (*HistogramSnapshot) SnapshotAndClear() Histogram {
+	panic("SnapshotAndClear called on a HistogramSnapshot")
+}
+
 // StdDev returns the standard deviation of the values in the sample at the
 // time the snapshot was taken.
 func (h *HistogramSnapshot) StdDev() float64 { return h.sample.StdDev() }
@@ -101,6 +124,11 @@ func (*HistogramSnapshot) Update(int64) {
 	panic("Update called on a HistogramSnapshot")
 }
 
+// UpdateWithExemplar panics.
+func (*HistogramSnapshot) UpdateWithExemplar(int64, Tags) {
+	panic("UpdateWithExemplar called on a HistogramSnapshot")
+}
+
 // Variance returns the variance of inputs at the time the snapshot was taken.
 func (h *HistogramSnapshot) Variance() float64 { return h.sample.Variance() }
 
@@ -113,6 +141,9 @@ func (NilHistogram) Clear() {}
 // Count is a no-op.
 func (NilHistogram) Count() int64 { return 0 }
 
+// Exemplar is a no-op.
+func (NilHistogram) Exemplar() *Exemplar { return nil }
+
 // Max is a no-op.
 func (NilHistogram) Max() int64 { return 0 }
 
@@ -136,6 +167,9 @@ func (NilHistogram) Sample() Sample { return NilSample{} }
 // Snapshot is a no-op.
 func (NilHistogram) Snapshot() Histogram { return NilHistogram{} }
 
+// SnapshotAndClear is a no-op.
+func (NilHistogram) SnapshotAndClear() Histogram { return NilHistogram{} }
+
 // StdDev is a no-op.
 func (NilHistogram) StdDev() float64 { return 0.0 }
 
@@ -145,22 +179,40 @@ func (NilHistogram) Sum() int64 { return 0 }
 // Update is a no-op.
 func (NilHistogram) Update(v int64) {}
 
+// UpdateWithExemplar is a no-op.
+func (NilHistogram) UpdateWithExemplar(v int64, labels Tags) {}
+
 // Variance is a no-op.
 func (NilHistogram) Variance() float64 { return 0.0 }
 
 // StandardHistogram is the standard implementation of a Histogram and uses a
 // Sample to bound its memory use.
 type StandardHistogram struct {
-	sample Sample
+	sample   Sample
+	exemplar *Exemplar
+	mutex    sync.Mutex
 }
 
-// Clear clears the histogram and its sample.
-func (h *StandardHistogram) Clear() { h.sample.Clear() }
+// Clear clears the histogram, its sample and its exemplar.
+func (h *StandardHistogram) Clear() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.sample.Clear()
+	h.exemplar = nil
+}
 
 // Count returns the number of samples recorded since the histogram was last
 // cleared.
 func (h *StandardHistogram) Count() int64 { return h.sample.Count() }
 
+// Exemplar returns the exemplar recorded by the last call to
+// UpdateWithExemplar since the histogram was last cleared, or nil.
+func (h *StandardHistogram) Exemplar() *Exemplar {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.exemplar
+}
+
 // Max returns the maximum value in the sample.
 func (h *StandardHistogram) Max() int64 { return h.sample.Max() }
 
@@ -186,7 +238,19 @@ func (h *StandardHistogram) Sample() Sample { return h.sample }
 
 // Snapshot returns a read-only copy of the histogram.
 func (h *StandardHistogram) Snapshot() Histogram {
-	return &HistogramSnapshot{sample: h.sample.Snapshot().(*SampleSnapshot)}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return &HistogramSnapshot{sample: h.sample.Snapshot(), exemplar: h.exemplar}
+}
+
+// SnapshotAndClear returns a read-only copy of the histogram and clears it,
+// without losing the values recorded in between.
+func (h *StandardHistogram) SnapshotAndClear() Histogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	exemplar := h.exemplar
+	h.exemplar = nil
+	return &HistogramSnapshot{sample: h.sample.SnapshotAndClear(), exemplar: exemplar}
 }
 
 // StdDev returns the standard deviation of the values in the sample.
@@ -198,5 +262,32 @@ func (h *StandardHistogram) Sum() int64 { return h.sample.Sum() }
 // Update samples a new value.
 func (h *StandardHistogram) Update(v int64) { h.sample.Update(v) }
 
+// UpdateWithExemplar samples a new value and records it as the histogram's
+// exemplar along with the given labels, such as a trace ID.
+func (h *StandardHistogram) UpdateWithExemplar(v int64, labels Tags) {
+	e := newExemplar(float64(v), labels)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.sample.Update(v)
+	h.exemplar = e
+}
+
 // Variance returns the variance of the values in the sample.
 func (h *StandardHistogram) Variance() float64 { return h.sample.Variance() }
+
+// checkpoint returns the state of the histogram's sample, or nil if it isn't
+// persisted.
+func (h *StandardHistogram) checkpoint() *persistedState {
+	s, ok := h.sample.(persistent)
+	if !ok {
+		return nil
+	}
+	return &persistedState{Sample: s.checkpoint()}
+}
+
+// restore restores the histogram's sample.
+func (h *StandardHistogram) restore(s *persistedState) {
+	if p, ok := h.sample.(persistent); ok && nil != s.Sample {
+		p.restore(s.Sample)
+	}
+}
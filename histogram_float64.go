@@ -1,5 +1,7 @@
 package metrics
 
+// HistogramFloat64s calculate distribution statistics from a series of
+// float64 values.
 type HistogramFloat64 interface {
 	Clear()
 	Count() int64
@@ -10,19 +12,45 @@ type HistogramFloat64 interface {
 	Percentiles([]float64) []float64
 	Sample() SampleFloat64
 	Snapshot() HistogramFloat64
+	SnapshotAndClear() HistogramFloat64
 	StdDev() float64
 	Sum() float64
 	Update(float64)
 	Variance() float64
 }
 
+// GetOrRegisterHistogramFloat64 returns an existing HistogramFloat64 or
+// constructs and registers a new StandardHistogramFloat64.
+func GetOrRegisterHistogramFloat64(name string, r Registry, s SampleFloat64) HistogramFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() HistogramFloat64 { return NewHistogramFloat64(s) }).(HistogramFloat64)
+}
+
+// NewHistogramFloat64 constructs a new StandardHistogramFloat64 from a
+// SampleFloat64.
 func NewHistogramFloat64(s SampleFloat64) HistogramFloat64 {
+	if UseNilMetrics {
+		return NilHistogramFloat64{}
+	}
 	return &StandardHistogramFloat64{sample: s}
 }
 
-// HistogramSnapshot is a read-only copy of another Histogram.
+// NewRegisteredHistogramFloat64 constructs and registers a new
+// StandardHistogramFloat64 from a SampleFloat64.
+func NewRegisteredHistogramFloat64(name string, r Registry, s SampleFloat64) HistogramFloat64 {
+	c := NewHistogramFloat64(s)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// HistogramSnapshotFloat64 is a read-only copy of another HistogramFloat64.
 type HistogramSnapshotFloat64 struct {
-	sample *SampleSnapshotFloat64
+	sample SampleFloat64
 }
 
 // Clear panics.
@@ -42,6 +70,12 @@ func (h *HistogramSnapshotFloat64) Max() float64 { return h.sample.Max() }
 // was taken.
 func (h *HistogramSnapshotFloat64) Mean() float64 { return h.sample.Mean() }
 
+// Merge returns a snapshot of the values of both this snapshot and another
+// HistogramFloat64.
+func (h *HistogramSnapshotFloat64) Merge(o HistogramFloat64) *HistogramSnapshotFloat64 {
+	return &HistogramSnapshotFloat64{sample: mergeSamplesFloat64(h.sample, o.Snapshot().Sample())}
+}
+
 // Min returns the minimum value in the sample at the time the snapshot was
 // taken.
 func (h *HistogramSnapshotFloat64) Min() float64 { return h.sample.Min() }
@@ -64,6 +98,11 @@ func (h *HistogramSnapshotFloat64) Sample() SampleFloat64 { return h.sample }
 // Snapshot returns the snapshot.
 func (h *HistogramSnapshotFloat64) Snapshot() HistogramFloat64 { return h }
 
+// SnapshotAndClear panics.
+func (*HistogramSnapshotFloat64) SnapshotAndClear() HistogramFloat64 {
+	panic("SnapshotAndClear called on a HistogramSnapshotFloat64")
+}
+
 // StdDev returns the standard deviation of the values in the sample at the
 // time the snapshot was taken.
 func (h *HistogramSnapshotFloat64) StdDev() float64 { return h.sample.StdDev() }
@@ -79,6 +118,53 @@ func (*HistogramSnapshotFloat64) Update(float64) {
 // Variance returns the variance of inputs at the time the snapshot was taken.
 func (h *HistogramSnapshotFloat64) Variance() float64 { return h.sample.Variance() }
 
+// NilHistogramFloat64 is a no-op HistogramFloat64.
+type NilHistogramFloat64 struct{}
+
+// Clear is a no-op.
+func (NilHistogramFloat64) Clear() {}
+
+// Count is a no-op.
+func (NilHistogramFloat64) Count() int64 { return 0 }
+
+// Max is a no-op.
+func (NilHistogramFloat64) Max() float64 { return 0.0 }
+
+// Mean is a no-op.
+func (NilHistogramFloat64) Mean() float64 { return 0.0 }
+
+// Min is a no-op.
+func (NilHistogramFloat64) Min() float64 { return 0.0 }
+
+// Percentile is a no-op.
+func (NilHistogramFloat64) Percentile(p float64) float64 { return 0.0 }
+
+// Percentiles is a no-op.
+func (NilHistogramFloat64) Percentiles(ps []float64) []float64 {
+	return make([]float64, len(ps))
+}
+
+// Sample is a no-op.
+func (NilHistogramFloat64) Sample() SampleFloat64 { return NilSampleFloat64{} }
+
+// Snapshot is a no-op.
+func (NilHistogramFloat64) Snapshot() HistogramFloat64 { return NilHistogramFloat64{} }
+
+// SnapshotAndClear is a no-op.
+func (NilHistogramFloat64) SnapshotAndClear() HistogramFloat64 { return NilHistogramFloat64{} }
+
+// StdDev is a no-op.
+func (NilHistogramFloat64) StdDev() float64 { return 0.0 }
+
+// Sum is a no-op.
+func (NilHistogramFloat64) Sum() float64 { return 0.0 }
+
+// Update is a no-op.
+func (NilHistogramFloat64) Update(v float64) {}
+
+// Variance is a no-op.
+func (NilHistogramFloat64) Variance() float64 { return 0.0 }
+
 // StandardHistogramFloat64 is the standard implementation of a HistogramFloat64
 // and uses a SampleFloat64 to bound its memory use.
 type StandardHistogramFloat64 struct {
@@ -117,7 +203,13 @@ func (h *StandardHistogramFloat64) Sample() SampleFloat64 { return h.sample }
 
 // Snapshot returns a read-only copy of the histogram.
 func (h *StandardHistogramFloat64) Snapshot() HistogramFloat64 {
-	return &HistogramSnapshotFloat64{sample: h.sample.Snapshot().(*SampleSnapshotFloat64)}
+	return &HistogramSnapshotFloat64{sample: h.sample.Snapshot()}
+}
+
+// SnapshotAndClear returns a read-only copy of the histogram and clears it,
+// without losing the values recorded in between.
+func (h *StandardHistogramFloat64) SnapshotAndClear() HistogramFloat64 {
+	return &HistogramSnapshotFloat64{sample: h.sample.SnapshotAndClear()}
 }
 
 // StdDev returns the standard deviation of the values in the sample.
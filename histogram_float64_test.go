@@ -0,0 +1,65 @@
+package metrics
+
+import "testing"
+
+func BenchmarkHistogramFloat64(b *testing.B) {
+	h := NewHistogramFloat64(NewUniformSampleFloat64(100))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Update(float64(i))
+	}
+}
+
+func TestGetOrRegisterHistogramFloat64(t *testing.T) {
+	r := NewRegistry()
+	s := NewUniformSampleFloat64(100)
+	NewRegisteredHistogramFloat64("foo", r, s).Update(4.7)
+	if h := GetOrRegisterHistogramFloat64("foo", r, s); 1 != h.Count() {
+		t.Fatal(h)
+	}
+}
+
+func TestHistogramFloat64Snapshot(t *testing.T) {
+	h := NewHistogramFloat64(NewUniformSampleFloat64(100000))
+	for i := 1; i <= 10000; i++ {
+		h.Update(float64(i) / 10)
+	}
+	snapshot := h.Snapshot()
+	h.Update(0)
+	if count := snapshot.Count(); 10000 != count {
+		t.Errorf("h.Count(): 10000 != %v\n", count)
+	}
+	if min := snapshot.Min(); 0.1 != min {
+		t.Errorf("h.Min(): 0.1 != %v\n", min)
+	}
+	if max := snapshot.Max(); 1000 != max {
+		t.Errorf("h.Max(): 1000 != %v\n", max)
+	}
+	if mean := snapshot.Mean(); 500.05 != mean {
+		t.Errorf("h.Mean(): 500.05 != %v\n", mean)
+	}
+}
+
+func TestHistogramFloat64Nil(t *testing.T) {
+	UseNilMetrics = true
+	defer func() { UseNilMetrics = false }()
+	h := NewHistogramFloat64(NewUniformSampleFloat64(100))
+	if _, ok := h.(NilHistogramFloat64); !ok {
+		t.Fatal(h)
+	}
+	if _, ok := h.Sample().(NilSampleFloat64); !ok {
+		t.Fatal(h.Sample())
+	}
+}
+
+func TestHistogramFloat64SnapshotAndClear(t *testing.T) {
+	h := NewHistogramFloat64(NewExpDecaySampleFloat64(100, 0.015))
+	h.Update(1.5)
+	snapshot := h.SnapshotAndClear()
+	if count, max := snapshot.Count(), snapshot.Max(); 1 != count || 1.5 != max {
+		t.Errorf("snapshot.Count(), snapshot.Max(): %v, %v\n", count, max)
+	}
+	if count := h.Count(); 0 != count {
+		t.Errorf("h.Count(): 0 != %v\n", count)
+	}
+}
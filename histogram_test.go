@@ -93,3 +93,39 @@ func testHistogram10000(t *testing.T, h Histogram) {
 		t.Errorf("99th percentile: 9900.99 != %v\n", ps[2])
 	}
 }
+
+func TestHistogramSnapshotAndClear(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100))
+	h.Update(1)
+	h.Update(2)
+	snapshot := h.SnapshotAndClear()
+	h.Update(3)
+	if count, max := snapshot.Count(), snapshot.Max(); 2 != count || 2 != max {
+		t.Errorf("snapshot.Count(), snapshot.Max(): %v, %v\n", count, max)
+	}
+	if count, min := h.Count(), h.Min(); 1 != count || 3 != min {
+		t.Errorf("h.Count(), h.Min(): %v, %v\n", count, min)
+	}
+}
+
+func TestHistogramExemplar(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100)).(*StandardHistogram)
+	h.Update(1)
+	if e := h.Exemplar(); nil != e {
+		t.Fatalf("h.Exemplar(): %v\n", e)
+	}
+	labels := Tags{"trace_id": "abc"}
+	h.UpdateWithExemplar(5, labels)
+	labels["trace_id"] = "def"
+	snapshot := h.SnapshotAndClear().(*HistogramSnapshot)
+	if count := snapshot.Count(); 2 != count {
+		t.Errorf("snapshot.Count(): 2 != %v\n", count)
+	}
+	e := snapshot.Exemplar()
+	if nil == e || 5 != e.Value || "abc" != e.Labels["trace_id"] || e.Timestamp.IsZero() {
+		t.Fatalf("snapshot.Exemplar(): %v\n", e)
+	}
+	if e := h.Exemplar(); nil != e {
+		t.Errorf("h.Exemplar() after SnapshotAndClear: %v\n", e)
+	}
+}
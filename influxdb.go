@@ -0,0 +1,303 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxDBConfig provides a container with configuration parameters for
+// the InfluxDB exporter.  Points are sent over UDP to Addr if it is set and
+// over HTTP to the /write endpoint of URL otherwise.
+type InfluxDBConfig struct {
+	URL           string        // Base URL of the HTTP API, i.e. http://localhost:8086
+	Database      string        // Database to write to over HTTP
+	Username      string        // Username for HTTP basic authentication, if any
+	Password      string        // Password for HTTP basic authentication
+	Addr          *net.UDPAddr  // Network address to send datagrams to
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	DurationUnit  time.Duration // Time conversion unit for durations
+	Prefix        string        // Prefix to be prepended to measurement names
+	Percentiles   []float64     // Percentiles to export from timers and histograms
+	Tags          Tags          // Tags to be added to every point
+	Gzip          bool          // Compress HTTP request bodies
+	MaxRetries    int           // Times to retry a failed HTTP write
+	RetryBackoff  time.Duration // Delay before the first retry, doubled after each
+	MaxPacketSize int           // Largest datagram to send, 1432 bytes if zero
+	Client        *http.Client  // HTTP client, http.DefaultClient if nil
+}
+
+// InfluxDB is a blocking exporter function which reports metrics in r
+// to the InfluxDB HTTP API located at u, writing them into database db
+// every d duration.
+func InfluxDB(r Registry, d time.Duration, u, db string) {
+	InfluxDBWithConfig(InfluxDBConfig{
+		URL:           u,
+		Database:      db,
+		Registry:      r,
+		FlushInterval: d,
+		DurationUnit:  time.Nanosecond,
+		Percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
+		MaxRetries:    3,
+		RetryBackoff:  time.Second,
+	})
+}
+
+// InfluxDBWithConfig is a blocking exporter function just like InfluxDB,
+// but it takes an InfluxDBConfig instead.
+func InfluxDBWithConfig(c InfluxDBConfig) {
+	InfluxDBContext(context.Background(), c, nil)
+}
+
+// InfluxDBContext is a blocking exporter function just like
+// InfluxDBWithConfig, but it returns after a final flush once ctx is done
+// and passes each failed flush to onError instead of logging it.  Requests
+// and retries are abandoned when ctx is done, and the final flush is tried
+// once without retrying.
+func InfluxDBContext(ctx context.Context, c InfluxDBConfig, onError func(error)) {
+	RunReporter(ctx, c.FlushInterval, func() error {
+		if nil != ctx.Err() {
+			final := c
+			final.MaxRetries = 0
+			return influxDB(context.Background(), &final)
+		}
+		return influxDB(ctx, &c)
+	}, onError)
+}
+
+// InfluxDBOnce performs a single submission to InfluxDB, returning a
+// non-nil error on failure.  This can be used in a loop similar to
+// InfluxDBWithConfig for custom error handling.
+func InfluxDBOnce(c InfluxDBConfig) error {
+	return influxDB(context.Background(), &c)
+}
+
+// InfluxDBError is the error returned when InfluxDB rejects a write.
+type InfluxDBError struct {
+	StatusCode int
+	Body       string
+}
+
+func (err *InfluxDBError) Error() string {
+	return fmt.Sprintf("influxdb: %d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Body)
+}
+
+func influxDB(ctx context.Context, c *InfluxDBConfig) error {
+	lines := influxDBLines(c, time.Now())
+	if 0 == len(lines) {
+		return nil
+	}
+	if nil != c.Addr {
+		return influxDBUDP(c, lines)
+	}
+	return influxDBHTTP(ctx, c, lines)
+}
+
+// influxDBLines returns one line-protocol point per metric.  The fields are
+// the same as those graphite() writes, less any NaN or infinite values, which
+// InfluxDB rejects; a metric left with no fields is skipped.
+func influxDBLines(c *InfluxDBConfig, now time.Time) []string {
+	du := float64(c.DurationUnit)
+	if 0 == du {
+		du = 1
+	}
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	var lines []string
+	c.Registry.EachTagged(func(name string, tags Tags, i interface{}) {
+		var fields []string
+		field := func(key, value string) {
+			fields = append(fields, influxDBEscape(key)+"="+value)
+		}
+		integer := func(key string, v int64) { field(key, strconv.FormatInt(v, 10)+"i") }
+		float := func(key string, v float64) {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				field(key, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+		switch metric := i.(type) {
+		case Counter:
+			integer("count", metric.Count())
+		case Gauge:
+			integer("value", metric.Value())
+		case GaugeFloat64:
+			float("value", metric.Value())
+		case Histogram:
+			h := metric.Snapshot()
+			ps := h.Percentiles(c.Percentiles)
+			integer("count", h.Count())
+			integer("min", h.Min())
+			integer("max", h.Max())
+			float("mean", h.Mean())
+			float("std-dev", h.StdDev())
+			for psIdx, psKey := range c.Percentiles {
+				key := PercentileKey(psKey)
+				float(key+"-percentile", ps[psIdx])
+			}
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			ps := h.Percentiles(c.Percentiles)
+			integer("count", h.Count())
+			float("min", h.Min())
+			float("max", h.Max())
+			float("mean", h.Mean())
+			float("std-dev", h.StdDev())
+			for psIdx, psKey := range c.Percentiles {
+				key := PercentileKey(psKey)
+				float(key+"-percentile", ps[psIdx])
+			}
+		case Meter:
+			m := metric.Snapshot()
+			integer("count", m.Count())
+			float("one-minute", m.Rate1())
+			float("five-minute", m.Rate5())
+			float("fifteen-minute", m.Rate15())
+			float("mean", m.RateMean())
+		case Timer:
+			t := metric.Snapshot()
+			ps := t.Percentiles(c.Percentiles)
+			integer("count", t.Count())
+			float("min", float64(t.Min())/du)
+			float("max", float64(t.Max())/du)
+			float("mean", t.Mean()/du)
+			float("std-dev", t.StdDev()/du)
+			for psIdx, psKey := range c.Percentiles {
+				key := PercentileKey(psKey)
+				float(key+"-percentile", ps[psIdx]/du)
+			}
+			float("one-minute", t.Rate1())
+			float("five-minute", t.Rate5())
+			float("fifteen-minute", t.Rate15())
+			float("mean-rate", t.RateMean())
+		default:
+			return
+		}
+		if 0 == len(fields) {
+			return
+		}
+		if "" != c.Prefix {
+			name = c.Prefix + "." + name
+		}
+		all := make(Tags, len(c.Tags)+len(tags))
+		for k, v := range c.Tags {
+			all[k] = v
+		}
+		for k, v := range tags {
+			all[k] = v
+		}
+		var b bytes.Buffer
+		b.WriteString(influxDBMeasurementReplacer.Replace(name))
+		for _, k := range all.Keys() {
+			// The line protocol has no empty tag values.
+			if "" == k || "" == all[k] {
+				continue
+			}
+			b.WriteString("," + influxDBEscape(k) + "=" + influxDBEscape(all[k]))
+		}
+		b.WriteString(" " + strings.Join(fields, ",") + " " + ts)
+		lines = append(lines, b.String())
+	})
+	return lines
+}
+
+var influxDBMeasurementReplacer = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+
+var influxDBReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// influxDBEscape escapes a tag key, tag value or field key.
+func influxDBEscape(s string) string {
+	return influxDBReplacer.Replace(s)
+}
+
+func influxDBUDP(c *InfluxDBConfig, lines []string) error {
+	conn, err := net.DialUDP("udp", nil, c.Addr)
+	if nil != err {
+		return err
+	}
+	defer conn.Close()
+	size := c.MaxPacketSize
+	if 0 == size {
+		size = 1432
+	}
+	w := &packetWriter{conn: conn, size: size}
+	for _, line := range lines {
+		w.add(line)
+	}
+	w.flush()
+	return w.err
+}
+
+func influxDBHTTP(ctx context.Context, c *InfluxDBConfig, lines []string) error {
+	var body bytes.Buffer
+	if c.Gzip {
+		gz := gzip.NewWriter(&body)
+		gz.Write([]byte(strings.Join(lines, "\n")))
+		if err := gz.Close(); nil != err {
+			return err
+		}
+	} else {
+		body.WriteString(strings.Join(lines, "\n"))
+	}
+	u, err := url.Parse(strings.TrimSuffix(c.URL, "/") + "/write")
+	if nil != err {
+		return err
+	}
+	q := u.Query()
+	q.Set("db", c.Database)
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+	client := c.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = influxDBPost(ctx, client, c, u.String(), body.Bytes())
+		if nil == err || attempt >= c.MaxRetries {
+			return err
+		}
+		if e, ok := err.(*InfluxDBError); ok && e.StatusCode < 500 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func influxDBPost(ctx context.Context, client *http.Client, c *InfluxDBConfig, u string, body []byte) error {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if c.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if "" != c.Username {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return &InfluxDBError{resp.StatusCode, strings.TrimSpace(string(b))}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleInfluxDB() {
+	go InfluxDB(DefaultRegistry, 10*time.Second, "http://localhost:8086", "metrics")
+}
+
+func TestInfluxDBLines(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterTagged("requests", Tags{"status": "2 00"}, NewCounter())
+	NewRegisteredGaugeFloat64("load", r).Update(0.5)
+	lines := influxDBLines(&InfluxDBConfig{
+		Registry: r,
+		Prefix:   "app",
+		Tags:     Tags{"host": "web1"},
+	}, time.Unix(1, 5))
+	if 2 != len(lines) {
+		t.Fatal(lines)
+	}
+	for _, line := range lines {
+		if "app.requests,host=web1,status=2\\ 00 count=0i 1000000005" != line &&
+			"app.load,host=web1 value=0.5 1000000005" != line {
+			t.Fatal(line)
+		}
+	}
+}
+
+func TestInfluxDBLinesNonFinite(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("nan", r).Update(math.NaN())
+	NewRegisteredGaugeFloat64("inf", r).Update(math.Inf(1))
+	r.RegisterTagged("load", Tags{"host": "", "dc": "east"}, NewGaugeFloat64())
+	lines := influxDBLines(&InfluxDBConfig{Registry: r}, time.Unix(1, 0))
+	if 1 != len(lines) || "load,dc=east value=0 1000000000" != lines[0] {
+		t.Fatal(lines)
+	}
+}
+
+func TestInfluxDBHTTP(t *testing.T) {
+	var attempts int
+	var body string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if 1 == attempts {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if "/write" != req.URL.Path || "metrics" != req.URL.Query().Get("db") || "ns" != req.URL.Query().Get("precision") {
+			t.Error(req.URL)
+		}
+		if "gzip" != req.Header.Get("Content-Encoding") {
+			t.Error(req.Header)
+		}
+		gz, err := gzip.NewReader(req.Body)
+		if nil != err {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(gz)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(3)
+	err := InfluxDBOnce(InfluxDBConfig{
+		URL:        s.URL,
+		Database:   "metrics",
+		Registry:   r,
+		Gzip:       true,
+		MaxRetries: 1,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != attempts || !strings.HasPrefix(body, "foo count=3i ") {
+		t.Fatal(attempts, body)
+	}
+}
+
+func TestInfluxDBHTTPError(t *testing.T) {
+	var attempts int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		http.Error(w, `{"error":"database not found"}`, http.StatusNotFound)
+	}))
+	defer s.Close()
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	err := InfluxDBOnce(InfluxDBConfig{URL: s.URL, Registry: r, MaxRetries: 3})
+	if e, ok := err.(*InfluxDBError); !ok || http.StatusNotFound != e.StatusCode {
+		t.Fatal(err)
+	}
+	if 1 != attempts {
+		t.Fatal(attempts)
+	}
+}
+
+func TestInfluxDBContextRetry(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var errs int
+	go func() {
+		InfluxDBContext(ctx, InfluxDBConfig{
+			URL:           s.URL,
+			Registry:      r,
+			FlushInterval: 10 * time.Millisecond,
+			MaxRetries:    3,
+			RetryBackoff:  time.Minute,
+		}, func(error) { errs++ })
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("InfluxDBContext still retrying after ctx was done")
+	}
+	if errs < 2 {
+		t.Fatal(errs)
+	}
+}
+
+func TestInfluxDBUDP(t *testing.T) {
+	addr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	conn, err := net.ListenUDP("udp", addr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := NewRegistry()
+	NewRegisteredGauge("foo", r).Update(7)
+	if err := InfluxDBOnce(InfluxDBConfig{Addr: conn.LocalAddr().(*net.UDPAddr), Registry: r}); nil != err {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if line := string(buf[:n]); !strings.HasPrefix(line, "foo value=7i ") {
+		t.Fatal(line)
+	}
+}
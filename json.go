@@ -1,17 +1,59 @@
 package metrics
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // MarshalJSON returns a byte slice containing a JSON representation of all
 // the metrics in the Registry.
 func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
+	return marshalJSON(r, OutputOptions{})
+}
+
+// UnmarshalJSON registers a read-only snapshot of each metric in a JSON
+// representation written by MarshalJSON, as ReadJSON does.
+func (r *StandardRegistry) UnmarshalJSON(b []byte) error {
+	return ReadJSON(r, bytes.NewReader(b))
+}
+
+// MarshalJSONWithOptions returns a JSON representation of all the metrics in
+// the registry, just like MarshalJSON, but reports the percentiles and fields
+// chosen by o, under keys such as "median" and "99.9%", and timer durations
+// in o.DurationUnit.
+func MarshalJSONWithOptions(r Registry, o OutputOptions) ([]byte, error) {
+	return marshalJSON(r, o)
+}
+
+func marshalJSON(r Registry, o OutputOptions) ([]byte, error) {
+	o = o.WithDefaults()
+	du := float64(o.DurationUnit)
 	data := make(map[string]map[string]interface{})
-	r.Each(func(name string, i interface{}) {
+	r.EachTagged(func(name string, tags Tags, i interface{}) {
 		values := make(map[string]interface{})
+		if 0 < len(tags) {
+			values["tags"] = tags
+		}
+		set := func(f Fields, key string, v interface{}) {
+			if o.Has(f) {
+				values[key] = v
+			}
+		}
+		percentiles := func(s interface{ Percentiles([]float64) []float64 }, div float64) {
+			if o.Has(FieldPercentiles) {
+				for i, p := range s.Percentiles(o.Percentiles) {
+					values[PercentileLabel(o.Percentiles[i])] = p / div
+				}
+			}
+		}
 		switch metric := i.(type) {
 		case Counter:
 			values["count"] = metric.Count()
@@ -25,45 +67,57 @@ func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
 			if err := metric.Error(); nil != err {
 				values["error"] = metric.Error().Error()
 			}
-		case Histogram:
+		case BucketHistogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			buckets := make(map[string]int64)
+			for _, b := range h.Buckets() {
+				buckets[bucketBound(b.UpperBound)] = b.Count
+			}
 			values["count"] = h.Count()
-			values["min"] = h.Min()
-			values["max"] = h.Max()
-			values["mean"] = h.Mean()
-			values["stddev"] = h.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
+			values["sum"] = h.Sum()
+			values["buckets"] = buckets
+		case Histogram:
+			h := metric.Snapshot()
+			set(FieldCount, "count", h.Count())
+			set(FieldMin, "min", h.Min())
+			set(FieldMax, "max", h.Max())
+			set(FieldMean, "mean", h.Mean())
+			set(FieldStdDev, "stddev", h.StdDev())
+			percentiles(h, 1)
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			set(FieldCount, "count", h.Count())
+			set(FieldMin, "min", h.Min())
+			set(FieldMax, "max", h.Max())
+			set(FieldMean, "mean", h.Mean())
+			set(FieldStdDev, "stddev", h.StdDev())
+			percentiles(h, 1)
 		case Meter:
 			m := metric.Snapshot()
-			values["count"] = m.Count()
-			values["1m.rate"] = m.Rate1()
-			values["5m.rate"] = m.Rate5()
-			values["15m.rate"] = m.Rate15()
-			values["mean.rate"] = m.RateMean()
+			set(FieldCount, "count", m.Count())
+			set(FieldRates, "1m.rate", m.Rate1())
+			set(FieldRates, "5m.rate", m.Rate5())
+			set(FieldRates, "15m.rate", m.Rate15())
+			set(FieldRates, "mean.rate", m.RateMean())
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			values["count"] = t.Count()
-			values["min"] = t.Min()
-			values["max"] = t.Max()
-			values["mean"] = t.Mean()
-			values["stddev"] = t.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
-			values["1m.rate"] = t.Rate1()
-			values["5m.rate"] = t.Rate5()
-			values["15m.rate"] = t.Rate15()
-			values["mean.rate"] = t.RateMean()
-		}
-		data[name] = values
+			set(FieldCount, "count", t.Count())
+			if 1 == du {
+				set(FieldMin, "min", t.Min())
+				set(FieldMax, "max", t.Max())
+			} else {
+				set(FieldMin, "min", float64(t.Min())/du)
+				set(FieldMax, "max", float64(t.Max())/du)
+			}
+			set(FieldMean, "mean", t.Mean()/du)
+			set(FieldStdDev, "stddev", t.StdDev()/du)
+			percentiles(t, du)
+			set(FieldRates, "1m.rate", t.Rate1())
+			set(FieldRates, "5m.rate", t.Rate5())
+			set(FieldRates, "15m.rate", t.Rate15())
+			set(FieldRates, "mean.rate", t.RateMean())
+		}
+		data[MetricID{name, tags}.String()] = values
 	})
 	return json.Marshal(data)
 }
@@ -71,9 +125,14 @@ func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
 // WriteJSON writes metrics from the given registry  periodically to the
 // specified io.Writer as JSON.
 func WriteJSON(r Registry, d time.Duration, w io.Writer) {
-	for _ = range time.Tick(d) {
-		WriteJSONOnce(r, w)
-	}
+	WriteJSONContext(context.Background(), r, d, w, nil)
+}
+
+// WriteJSONContext is just like WriteJSON, but it returns after a final write
+// once ctx is done and passes each failed write to onError instead of logging
+// it.
+func WriteJSONContext(ctx context.Context, r Registry, d time.Duration, w io.Writer, onError func(error)) {
+	RunReporter(ctx, d, func() error { return json.NewEncoder(w).Encode(r) }, onError)
 }
 
 // WriteJSONOnce writes metrics from the given registry to the specified
@@ -82,6 +141,333 @@ func WriteJSONOnce(r Registry, w io.Writer) {
 	json.NewEncoder(w).Encode(r)
 }
 
+// WriteJSONContextWithOptions is just like WriteJSONContext, but it reports
+// the percentiles, fields and duration unit chosen by o.
+func WriteJSONContextWithOptions(ctx context.Context, r Registry, d time.Duration, w io.Writer, o OutputOptions, onError func(error)) {
+	RunReporter(ctx, d, func() error { return WriteJSONOnceWithOptions(r, w, o) }, onError)
+}
+
+// WriteJSONOnceWithOptions is just like WriteJSONOnce, but it reports the
+// percentiles, fields and duration unit chosen by o and returns any error.
+func WriteJSONOnceWithOptions(r Registry, w io.Writer, o OutputOptions) error {
+	b, err := marshalJSON(r, o)
+	if nil != err {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
 func (p *PrefixedRegistry) MarshalJSON() ([]byte, error) {
 	return json.Marshal(p.underlying)
 }
+
+// ReadJSON reads a JSON representation of metrics, as written by WriteJSON
+// or WriteJSONContextWithOptions, and registers a read-only snapshot of each in r,
+// replacing any metric registered under the same name and tags.  JSON
+// doesn't record the type of a metric, so it is inferred from the fields
+// present: integral values are read back as a Gauge rather than a
+// GaugeFloat64, histograms are read back as a HistogramFloat64 only if their
+// min or max isn't integral, and objects without any known field are
+// skipped.  Histogram and timer snapshots keep the summary statistics alone
+// and interpolate other percentiles from those written.
+func ReadJSON(r Registry, rd io.Reader) error {
+	var data map[string]jsonValues
+	dec := json.NewDecoder(rd)
+	dec.UseNumber()
+	if err := dec.Decode(&data); nil != err {
+		return err
+	}
+	for key, values := range data {
+		var tags Tags
+		if m, ok := values["tags"].(map[string]interface{}); ok {
+			tags = make(Tags, len(m))
+			for k, v := range m {
+				tags[k], _ = v.(string)
+			}
+		}
+		i := values.metric()
+		if nil == i {
+			continue
+		}
+		name := nameUnescaper.Replace(strings.TrimSuffix(key, tags.String()))
+		r.UnregisterTagged(name, tags)
+		if err := r.RegisterTagged(name, tags, i); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonValues are the fields of a single metric decoded with UseNumber.
+type jsonValues map[string]interface{}
+
+func (v jsonValues) has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+// integer returns the value of a field rounded to an int64.
+func (v jsonValues) integer(key string) int64 {
+	n, _ := v[key].(json.Number)
+	if i, err := n.Int64(); nil == err {
+		return i
+	}
+	return int64(math.Floor(v.number(key) + 0.5))
+}
+
+// integral reports whether the value of a field was written as an integer.
+func (v jsonValues) integral(key string) bool {
+	n, _ := v[key].(json.Number)
+	return !strings.ContainsAny(string(n), ".eE")
+}
+
+func (v jsonValues) number(key string) float64 {
+	n, _ := v[key].(json.Number)
+	f, _ := n.Float64()
+	return f
+}
+
+// metric returns a read-only metric of the type inferred from the fields, or
+// nil.
+func (v jsonValues) metric() interface{} {
+	switch {
+	case v.has("error"):
+		h := NewHealthcheck(func(Healthcheck) {})
+		if msg, ok := v["error"].(string); ok {
+			h.Unhealthy(errors.New(msg))
+		}
+		return h
+	case v.has("buckets"):
+		m, _ := v["buckets"].(map[string]interface{})
+		counts := make(map[float64]int64, len(m))
+		bounds := make([]float64, 0, len(m))
+		for bound := range m {
+			if b, err := strconv.ParseFloat(bound, 64); nil == err {
+				counts[b] = jsonValues(m).integer(bound)
+				bounds = append(bounds, b)
+			}
+		}
+		sort.Float64s(bounds)
+		h := &BucketHistogramSnapshot{sum: v.number("sum")}
+		for _, b := range bounds {
+			h.buckets = append(h.buckets, Bucket{b, counts[b]})
+		}
+		if n := len(h.buckets); 0 == n || !math.IsInf(h.buckets[n-1].UpperBound, 1) {
+			h.buckets = append(h.buckets, Bucket{math.Inf(1), v.integer("count")})
+		}
+		return h
+	case v.summarized() && v.has("1m.rate"):
+		return &TimerSnapshot{
+			histogram: &HistogramSnapshot{sample: jsonSample{v.summary()}},
+			meter:     v.meter(),
+		}
+	case v.summarized():
+		if v.integral("min") && v.integral("max") {
+			return &HistogramSnapshot{sample: jsonSample{v.summary()}}
+		}
+		return &HistogramSnapshotFloat64{sample: jsonSampleFloat64{v.summary()}}
+	case v.has("1m.rate"):
+		return v.meter()
+	case v.has("value"):
+		if v.integral("value") {
+			return GaugeSnapshot(v.integer("value"))
+		}
+		return GaugeFloat64Snapshot(v.number("value"))
+	case v.has("count"):
+		return CounterSnapshot(v.integer("count"))
+	}
+	return nil
+}
+
+func (v jsonValues) meter() *MeterSnapshot {
+	return &MeterSnapshot{
+		count:    v.integer("count"),
+		rate1:    v.number("1m.rate"),
+		rate5:    v.number("5m.rate"),
+		rate15:   v.number("15m.rate"),
+		rateMean: v.number("mean.rate"),
+	}
+}
+
+// summarized reports whether the fields are the statistics of a histogram or
+// a timer.
+func (v jsonValues) summarized() bool {
+	for key := range v {
+		if _, ok := parsePercentileLabel(key); ok {
+			return true
+		}
+	}
+	return v.has("min") || v.has("max") || v.has("mean") || v.has("stddev")
+}
+
+func (v jsonValues) summary() *jsonSummary {
+	s := &jsonSummary{
+		count:  v.integer("count"),
+		min:    v.number("min"),
+		max:    v.number("max"),
+		mean:   v.number("mean"),
+		stdDev: v.number("stddev"),
+	}
+	quantiles := make(map[float64]float64)
+	for key := range v {
+		if p, ok := parsePercentileLabel(key); ok {
+			quantiles[p] = v.number(key)
+			s.ps = append(s.ps, p)
+		}
+	}
+	sort.Float64s(s.ps)
+	for _, p := range s.ps {
+		s.quantiles = append(s.quantiles, quantiles[p])
+	}
+	return s
+}
+
+// jsonSummary holds the statistics of a histogram read by ReadJSON.
+type jsonSummary struct {
+	count                  int64
+	min, max, mean, stdDev float64
+	ps, quantiles          []float64 // Known percentiles in order and their values
+}
+
+// percentile interpolates linearly between the known percentiles, taking the
+// min and max as the 0th and 100th.
+func (s *jsonSummary) percentile(p float64) float64 {
+	if 0 == s.count {
+		return 0
+	}
+	p = math.Max(0, math.Min(1, p))
+	prevP, prevV := 0.0, s.min
+	for i, q := range s.ps {
+		if p <= q {
+			if q == prevP {
+				return s.quantiles[i]
+			}
+			return prevV + (s.quantiles[i]-prevV)*(p-prevP)/(q-prevP)
+		}
+		prevP, prevV = q, s.quantiles[i]
+	}
+	return prevV + (s.max-prevV)*(p-prevP)/(1-prevP)
+}
+
+func (s *jsonSummary) percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	for i, p := range ps {
+		scores[i] = s.percentile(p)
+	}
+	return scores
+}
+
+// jsonSample is a read-only Sample with only the statistics of a histogram
+// read by ReadJSON.
+type jsonSample struct {
+	*jsonSummary
+}
+
+// Clear panics.
+func (jsonSample) Clear() {
+	panic("Clear called on a jsonSample")
+}
+
+// Count returns the number of values recorded.
+func (s jsonSample) Count() int64 { return s.count }
+
+// Max returns the maximum value.
+func (s jsonSample) Max() int64 { return int64(s.max) }
+
+// Mean returns the mean of the values.
+func (s jsonSample) Mean() float64 { return s.mean }
+
+// Min returns the minimum value.
+func (s jsonSample) Min() int64 { return int64(s.min) }
+
+// Percentile returns an arbitrary percentile of the values.
+func (s jsonSample) Percentile(p float64) float64 { return s.percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the values.
+func (s jsonSample) Percentiles(ps []float64) []float64 { return s.percentiles(ps) }
+
+// Size returns zero since no values are kept.
+func (jsonSample) Size() int { return 0 }
+
+// Snapshot returns the sample.
+func (s jsonSample) Snapshot() Sample { return s }
+
+// SnapshotAndClear panics.
+func (jsonSample) SnapshotAndClear() Sample {
+	panic("SnapshotAndClear called on a jsonSample")
+}
+
+// StdDev returns the standard deviation of the values.
+func (s jsonSample) StdDev() float64 { return s.stdDev }
+
+// Sum returns the sum of the values, computed from the count and mean.
+func (s jsonSample) Sum() int64 { return int64(math.Floor(s.mean*float64(s.count) + 0.5)) }
+
+// Update panics.
+func (jsonSample) Update(int64) {
+	panic("Update called on a jsonSample")
+}
+
+// Values returns nil since no values are kept.
+func (jsonSample) Values() []int64 { return nil }
+
+// Variance returns the variance of the values.
+func (s jsonSample) Variance() float64 { return s.stdDev * s.stdDev }
+
+// jsonSampleFloat64 is a read-only SampleFloat64 with only the statistics of
+// a histogram read by ReadJSON.
+type jsonSampleFloat64 struct {
+	*jsonSummary
+}
+
+// Clear panics.
+func (jsonSampleFloat64) Clear() {
+	panic("Clear called on a jsonSampleFloat64")
+}
+
+// Count returns the number of values recorded.
+func (s jsonSampleFloat64) Count() int64 { return s.count }
+
+// Max returns the maximum value.
+func (s jsonSampleFloat64) Max() float64 { return s.max }
+
+// Mean returns the mean of the values.
+func (s jsonSampleFloat64) Mean() float64 { return s.mean }
+
+// Min returns the minimum value.
+func (s jsonSampleFloat64) Min() float64 { return s.min }
+
+// Percentile returns an arbitrary percentile of the values.
+func (s jsonSampleFloat64) Percentile(p float64) float64 { return s.percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the values.
+func (s jsonSampleFloat64) Percentiles(ps []float64) []float64 { return s.percentiles(ps) }
+
+// Size returns zero since no values are kept.
+func (jsonSampleFloat64) Size() int { return 0 }
+
+// Snapshot returns the sample.
+func (s jsonSampleFloat64) Snapshot() SampleFloat64 { return s }
+
+// SnapshotAndClear panics.
+func (jsonSampleFloat64) SnapshotAndClear() SampleFloat64 {
+	panic("SnapshotAndClear called on a jsonSampleFloat64")
+}
+
+// StdDev returns the standard deviation of the values.
+func (s jsonSampleFloat64) StdDev() float64 { return s.stdDev }
+
+// Sum returns the sum of the values, computed from the count and mean.
+func (s jsonSampleFloat64) Sum() float64 { return s.mean * float64(s.count) }
+
+// Update panics.
+func (jsonSampleFloat64) Update(float64) {
+	panic("Update called on a jsonSampleFloat64")
+}
+
+// Values returns nil since no values are kept.
+func (jsonSampleFloat64) Values() []float64 { return nil }
+
+// Variance returns the variance of the values.
+func (s jsonSampleFloat64) Variance() float64 { return s.stdDev * s.stdDev }
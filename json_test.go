@@ -3,7 +3,10 @@ package metrics
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRegistryMarshallJSON(t *testing.T) {
@@ -13,7 +16,7 @@ func TestRegistryMarshallJSON(t *testing.T) {
 	r.Register("counter", NewCounter())
 	enc.Encode(r)
 	if s := b.String(); "{\"counter\":{\"count\":0}}\n" != s {
-		t.Fatalf(s)
+		t.Fatal(s)
 	}
 }
 
@@ -26,3 +29,192 @@ func TestRegistryWriteJSONOnce(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRegistryMarshallJSONTagged(t *testing.T) {
+	b := &bytes.Buffer{}
+	enc := json.NewEncoder(b)
+	r := NewRegistry()
+	r.RegisterTagged("counter", Tags{"status": "200", "method": "GET"}, NewCounter())
+	enc.Encode(r)
+	if s := b.String(); "{\"counter{method=GET,status=200}\":{\"count\":0,\"tags\":{\"method\":\"GET\",\"status\":\"200\"}}}\n" != s {
+		t.Fatal(s)
+	}
+}
+
+func TestRegistryMarshallJSONHistogramFloat64(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredHistogramFloat64("h", r, NewUniformSampleFloat64(100)).Update(1.5)
+	b, err := json.Marshal(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s := string(b); "{\"h\":{\"75%\":1.5,\"95%\":1.5,\"99%\":1.5,\"99.9%\":1.5,\"count\":1,\"max\":1.5,\"mean\":1.5,\"median\":1.5,\"min\":1.5,\"stddev\":0}}" != s {
+		t.Fatal(s)
+	}
+}
+
+func TestRegistryMarshallJSONBucketHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredBucketHistogram("h", r, []float64{1, 2.5})
+	h.Update(2)
+	h.Update(3)
+	b, err := json.Marshal(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s := string(b); "{\"h\":{\"buckets\":{\"+Inf\":2,\"1\":0,\"2.5\":1},\"count\":2,\"sum\":5}}" != s {
+		t.Fatal(s)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterTagged("requests", Tags{"status": "200"}, NewCounter())
+	r.GetTagged("requests", Tags{"status": "200"}).(Counter).Inc(47)
+	NewRegisteredGauge("queue", r).Update(7)
+	NewRegisteredGaugeFloat64("load", r).Update(1.5)
+	r.Register("db", NewHealthcheck(func(h Healthcheck) { h.Unhealthy(errors.New("down")) }))
+	NewRegisteredHistogram("size", r, NewUniformSample(100)).Update(10)
+	NewRegisteredHistogramFloat64("ratio", r, NewUniformSampleFloat64(100)).Update(0.25)
+	m := NewRegisteredMeter("events", r)
+	defer m.Stop()
+	m.Mark(3)
+	tm := NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(2 * time.Second)
+	b := NewRegisteredBucketHistogram("bytes", r, []float64{1, 10})
+	b.Update(5)
+	b.Update(50)
+	data, err := json.Marshal(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	r2 := NewRegistry()
+	if err := ReadJSON(r2, bytes.NewReader(data)); nil != err {
+		t.Fatal(err)
+	}
+	if c, ok := r2.GetTagged("requests", Tags{"status": "200"}).(CounterSnapshot); !ok || 47 != c.Count() {
+		t.Errorf("requests: %#v\n", r2.GetTagged("requests", Tags{"status": "200"}))
+	}
+	if g, ok := r2.Get("queue").(GaugeSnapshot); !ok || 7 != g.Value() {
+		t.Errorf("queue: %#v\n", r2.Get("queue"))
+	}
+	if g, ok := r2.Get("load").(GaugeFloat64Snapshot); !ok || 1.5 != g.Value() {
+		t.Errorf("load: %#v\n", r2.Get("load"))
+	}
+	if h, ok := r2.Get("db").(Healthcheck); !ok || nil == h.Error() || "down" != h.Error().Error() {
+		t.Errorf("db: %#v\n", r2.Get("db"))
+	}
+	if h, ok := r2.Get("size").(*HistogramSnapshot); !ok || 1 != h.Count() || 10 != h.Max() || 10 != h.Percentile(0.5) {
+		t.Errorf("size: %#v\n", r2.Get("size"))
+	}
+	if h, ok := r2.Get("ratio").(*HistogramSnapshotFloat64); !ok || 0.25 != h.Min() {
+		t.Errorf("ratio: %#v\n", r2.Get("ratio"))
+	}
+	if m, ok := r2.Get("events").(*MeterSnapshot); !ok || 3 != m.Count() || m.RateMean() <= 0 {
+		t.Errorf("events: %#v\n", r2.Get("events"))
+	}
+	if tm, ok := r2.Get("latency").(*TimerSnapshot); !ok || 1 != tm.Count() || int64(2*time.Second) != tm.Max() || 0 == tm.RateMean() {
+		t.Errorf("latency: %#v\n", r2.Get("latency"))
+	}
+	if h, ok := r2.Get("bytes").(*BucketHistogramSnapshot); !ok || 2 != h.Count() || 55 != h.Sum() || 3 != len(h.Buckets()) || 1 != h.Buckets()[1].Count {
+		t.Errorf("bytes: %#v\n", r2.Get("bytes"))
+	}
+
+	data2, err := json.Marshal(r2)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, data2) {
+		t.Errorf("\n%s\n!=\n%s\n", data, data2)
+	}
+}
+
+func TestRegistryUnmarshalJSON(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(1)
+	NewRegisteredCounter("errors", r).Inc(1)
+	if err := json.Unmarshal([]byte(`{"requests":{"count":5},"unknown":{}}`), r); nil != err {
+		t.Fatal(err)
+	}
+	if c := r.Get("requests").(Counter); 5 != c.Count() {
+		t.Errorf("requests: 5 != %v\n", c.Count())
+	}
+	if c := r.Get("errors").(Counter); 1 != c.Count() {
+		t.Errorf("errors: 1 != %v\n", c.Count())
+	}
+	if nil != r.Get("unknown") {
+		t.Error(r.Get("unknown"))
+	}
+	if err := json.Unmarshal([]byte(`[]`), r); nil == err {
+		t.Error("unmarshaled an array")
+	}
+}
+
+func TestReadJSONEscaping(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("x{a=1}", r).Inc(1)
+	r.GetOrRegisterTagged("x", Tags{"a": "1"}, NewCounter).(Counter).Inc(2)
+	r.GetOrRegisterTagged("x", Tags{"a": "1}"}, NewCounter).(Counter).Inc(3)
+	b, err := json.Marshal(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	r2 := NewRegistry()
+	if err := ReadJSON(r2, bytes.NewReader(b)); nil != err {
+		t.Fatal(err)
+	}
+	if c := r2.GetTagged("x{a=1}", nil).(Counter); 1 != c.Count() {
+		t.Error(c.Count())
+	}
+	if c := r2.GetTagged("x", Tags{"a": "1"}).(Counter); 2 != c.Count() {
+		t.Error(c.Count())
+	}
+	if c := r2.GetTagged("x", Tags{"a": "1}"}).(Counter); 3 != c.Count() {
+		t.Error(c.Count())
+	}
+}
+
+func TestReadJSONPercentiles(t *testing.T) {
+	r := NewRegistry()
+	in := `{"h":{"count":100,"min":0,"max":100,"mean":50,"stddev":29,"median":50,"75%":75,"95%":95,"99%":99,"99.9%":99.9}}`
+	if err := ReadJSON(r, strings.NewReader(in)); nil != err {
+		t.Fatal(err)
+	}
+	h := r.Get("h").(Histogram)
+	ps := h.Percentiles([]float64{0, 0.25, 0.5, 0.85, 1})
+	if 0 != ps[0] || 25 != ps[1] || 50 != ps[2] || 85 != ps[3] || 100 != ps[4] {
+		t.Errorf("percentiles: %v\n", ps)
+	}
+	if 5000 != h.Sum() || 29*29 != h.Variance() {
+		t.Errorf("sum: %v, variance: %v\n", h.Sum(), h.Variance())
+	}
+}
+
+func TestMarshalJSONWithOptions(t *testing.T) {
+	r := NewRegistry()
+	tm := NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(1500 * time.Microsecond)
+	NewRegisteredHistogram("size", r, NewUniformSample(100)).Update(10)
+	b, err := MarshalJSONWithOptions(r, OutputOptions{
+		Percentiles:  []float64{0.9, 0.9999},
+		DurationUnit: time.Millisecond,
+		Fields:       FieldCount | FieldMax | FieldPercentiles,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s := string(b); `{"latency":{"90%":1.5,"99.99%":1.5,"count":1,"max":1.5},"size":{"90%":10,"99.99%":10,"count":1,"max":10}}` != s {
+		t.Fatal(s)
+	}
+
+	r2 := NewRegistry()
+	if err := r2.(*StandardRegistry).UnmarshalJSON(b); nil != err {
+		t.Fatal(err)
+	}
+	if h, ok := r2.Get("size").(Histogram); !ok || 10 != h.Percentile(0.9999) {
+		t.Errorf("size: %#v\n", r2.Get("size"))
+	}
+}
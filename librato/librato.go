@@ -1,6 +1,7 @@
 package librato
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
@@ -41,21 +42,24 @@ func Librato(r metrics.Registry, d time.Duration, e string, t string, s string,
 }
 
 func (self *Reporter) Run() {
+	self.RunContext(context.Background(), nil)
+}
+
+// RunContext is just like Run, but it returns after a final flush once ctx is
+// done and passes each failed flush to onError instead of logging it.
+func (self *Reporter) RunContext(ctx context.Context, onError func(error)) {
 	log.Printf("WARNING: This client has been DEPRECATED! It has been moved to https://github.com/mihasya/go-metrics-librato and will be removed from rcrowley/go-metrics on August 5th 2015")
-	ticker := time.Tick(self.Interval)
 	metricsApi := &LibratoClient{self.Email, self.Token}
-	for now := range ticker {
-		var metrics Batch
-		var err error
-		if metrics, err = self.BuildRequest(now, self.Registry); err != nil {
-			log.Printf("ERROR constructing librato request body %s", err)
-			continue
+	metrics.RunReporter(ctx, self.Interval, func() error {
+		batch, err := self.BuildRequest(time.Now(), self.Registry)
+		if err != nil {
+			return fmt.Errorf("ERROR constructing librato request body %s", err)
 		}
-		if err := metricsApi.PostMetrics(metrics); err != nil {
-			log.Printf("ERROR sending metrics to librato %s", err)
-			continue
+		if err := metricsApi.PostMetrics(batch); err != nil {
+			return fmt.Errorf("ERROR sending metrics to librato %s", err)
 		}
-	}
+		return nil
+	}, onError)
 }
 
 // calculate sum of squares from data provided by metrics.Histogram
@@ -69,6 +73,15 @@ func sumSquares(s metrics.Sample) float64 {
 	}
 	return sumSquares
 }
+func sumSquaresFloat64(s metrics.SampleFloat64) float64 {
+	count := float64(s.Count())
+	sumSquared := math.Pow(count*s.Mean(), 2)
+	sumSquares := math.Pow(count*s.StdDev(), 2) + sumSquared/count
+	if math.IsNaN(sumSquares) {
+		return 0.0
+	}
+	return sumSquares
+}
 func sumSquaresTimer(t metrics.Timer) float64 {
 	count := float64(t.Count())
 	sumSquared := math.Pow(count*t.Mean(), 2)
@@ -134,6 +147,26 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 				}
 				snapshot.Gauges = append(snapshot.Gauges, gauges...)
 			}
+		case metrics.HistogramFloat64:
+			if m.Count() > 0 {
+				gauges := make([]Measurement, histogramGaugeCount, histogramGaugeCount)
+				s := m.Sample()
+				measurement[Name] = fmt.Sprintf("%s.%s", name, "hist")
+				measurement[Count] = uint64(s.Count())
+				measurement[Max] = s.Max()
+				measurement[Min] = s.Min()
+				measurement[Sum] = s.Sum()
+				measurement[SumSquares] = sumSquaresFloat64(s)
+				gauges[0] = measurement
+				for i, p := range self.Percentiles {
+					gauges[i+1] = Measurement{
+						Name:   fmt.Sprintf("%s.%.2f", measurement[Name], p),
+						Value:  s.Percentile(p),
+						Period: measurement[Period],
+					}
+				}
+				snapshot.Gauges = append(snapshot.Gauges, gauges...)
+			}
 		case metrics.Meter:
 			measurement[Name] = name
 			measurement[Value] = float64(m.Count())
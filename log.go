@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"time"
 )
 
@@ -12,69 +13,105 @@ func Log(r Registry, freq time.Duration, l Logger) {
 	LogScaled(r, freq, time.Nanosecond, l)
 }
 
+// LogContext is just like Log, but it returns after logging one final time
+// once ctx is done.
+func LogContext(ctx context.Context, r Registry, freq time.Duration, l Logger) {
+	LogScaledContext(ctx, r, freq, time.Nanosecond, l)
+}
+
 // Output each metric in the given registry periodically using the given
 // logger. Print timings in `scale` units (eg time.Millisecond) rather than nanos.
 func LogScaled(r Registry, freq time.Duration, scale time.Duration, l Logger) {
-	du := float64(scale)
-	duSuffix := scale.String()[1:]
+	LogScaledContext(context.Background(), r, freq, scale, l)
+}
+
+// LogScaledContext is just like LogScaled, but it returns after logging one
+// final time once ctx is done.
+func LogScaledContext(ctx context.Context, r Registry, freq time.Duration, scale time.Duration, l Logger) {
+	LogContextWithOptions(ctx, r, freq, l, OutputOptions{DurationUnit: scale}, nil)
+}
 
-	for _ = range time.Tick(freq) {
-		r.Each(func(name string, i interface{}) {
-			switch metric := i.(type) {
-			case Counter:
-				l.Printf("counter %s\n", name)
-				l.Printf("  count:       %9d\n", metric.Count())
-			case Gauge:
-				l.Printf("gauge %s\n", name)
-				l.Printf("  value:       %9d\n", metric.Value())
-			case GaugeFloat64:
-				l.Printf("gauge %s\n", name)
-				l.Printf("  value:       %f\n", metric.Value())
-			case Healthcheck:
-				metric.Check()
-				l.Printf("healthcheck %s\n", name)
-				l.Printf("  error:       %v\n", metric.Error())
-			case Histogram:
-				h := metric.Snapshot()
-				ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				l.Printf("histogram %s\n", name)
-				l.Printf("  count:       %9d\n", h.Count())
-				l.Printf("  min:         %9d\n", h.Min())
-				l.Printf("  max:         %9d\n", h.Max())
-				l.Printf("  mean:        %12.2f\n", h.Mean())
-				l.Printf("  stddev:      %12.2f\n", h.StdDev())
-				l.Printf("  median:      %12.2f\n", ps[0])
-				l.Printf("  75%%:         %12.2f\n", ps[1])
-				l.Printf("  95%%:         %12.2f\n", ps[2])
-				l.Printf("  99%%:         %12.2f\n", ps[3])
-				l.Printf("  99.9%%:       %12.2f\n", ps[4])
-			case Meter:
-				m := metric.Snapshot()
-				l.Printf("meter %s\n", name)
-				l.Printf("  count:       %9d\n", m.Count())
-				l.Printf("  1-min rate:  %12.2f\n", m.Rate1())
-				l.Printf("  5-min rate:  %12.2f\n", m.Rate5())
-				l.Printf("  15-min rate: %12.2f\n", m.Rate15())
-				l.Printf("  mean rate:   %12.2f\n", m.RateMean())
-			case Timer:
-				t := metric.Snapshot()
-				ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				l.Printf("timer %s\n", name)
-				l.Printf("  count:       %9d\n", t.Count())
-				l.Printf("  min:         %12.2f%s\n", float64(t.Min())/du, duSuffix)
-				l.Printf("  max:         %12.2f%s\n", float64(t.Max())/du, duSuffix)
-				l.Printf("  mean:        %12.2f%s\n", t.Mean()/du, duSuffix)
-				l.Printf("  stddev:      %12.2f%s\n", t.StdDev()/du, duSuffix)
-				l.Printf("  median:      %12.2f%s\n", ps[0]/du, duSuffix)
-				l.Printf("  75%%:         %12.2f%s\n", ps[1]/du, duSuffix)
-				l.Printf("  95%%:         %12.2f%s\n", ps[2]/du, duSuffix)
-				l.Printf("  99%%:         %12.2f%s\n", ps[3]/du, duSuffix)
-				l.Printf("  99.9%%:       %12.2f%s\n", ps[4]/du, duSuffix)
-				l.Printf("  1-min rate:  %12.2f\n", t.Rate1())
-				l.Printf("  5-min rate:  %12.2f\n", t.Rate5())
-				l.Printf("  15-min rate: %12.2f\n", t.Rate15())
-				l.Printf("  mean rate:   %12.2f\n", t.RateMean())
+// LogContextWithOptions is just like LogContext, but it logs the percentiles
+// and fields chosen by o and timings in o.DurationUnit.  Logging can't fail,
+// so onError is only passed an invalid freq.
+func LogContextWithOptions(ctx context.Context, r Registry, freq time.Duration, l Logger, o OutputOptions, onError func(error)) {
+	RunReporter(ctx, freq, func() error {
+		logOnce(r, l, o)
+		return nil
+	}, onError)
+}
+
+func logOnce(r Registry, l Logger, o OutputOptions) {
+	o = o.WithDefaults()
+	du := float64(o.DurationUnit)
+	duSuffix := o.DurationUnit.String()[1:]
+
+	r.Each(func(name string, i interface{}) {
+		printf := func(f Fields, format string, v ...interface{}) {
+			if o.Has(f) {
+				l.Printf(format, v...)
+			}
+		}
+		percentiles := func(s interface{ Percentiles([]float64) []float64 }, div float64, suffix string) {
+			if o.Has(FieldPercentiles) {
+				for i, p := range s.Percentiles(o.Percentiles) {
+					l.Printf("  %-13s%12.2f%s\n", PercentileLabel(o.Percentiles[i])+":", p/div, suffix)
+				}
 			}
-		})
-	}
+		}
+		switch metric := i.(type) {
+		case Counter:
+			l.Printf("counter %s\n", name)
+			l.Printf("  count:       %9d\n", metric.Count())
+		case Gauge:
+			l.Printf("gauge %s\n", name)
+			l.Printf("  value:       %9d\n", metric.Value())
+		case GaugeFloat64:
+			l.Printf("gauge %s\n", name)
+			l.Printf("  value:       %f\n", metric.Value())
+		case Healthcheck:
+			metric.Check()
+			l.Printf("healthcheck %s\n", name)
+			l.Printf("  error:       %v\n", metric.Error())
+		case Histogram:
+			h := metric.Snapshot()
+			l.Printf("histogram %s\n", name)
+			printf(FieldCount, "  count:       %9d\n", h.Count())
+			printf(FieldMin, "  min:         %9d\n", h.Min())
+			printf(FieldMax, "  max:         %9d\n", h.Max())
+			printf(FieldMean, "  mean:        %12.2f\n", h.Mean())
+			printf(FieldStdDev, "  stddev:      %12.2f\n", h.StdDev())
+			percentiles(h, 1, "")
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			l.Printf("histogram %s\n", name)
+			printf(FieldCount, "  count:       %9d\n", h.Count())
+			printf(FieldMin, "  min:         %12.2f\n", h.Min())
+			printf(FieldMax, "  max:         %12.2f\n", h.Max())
+			printf(FieldMean, "  mean:        %12.2f\n", h.Mean())
+			printf(FieldStdDev, "  stddev:      %12.2f\n", h.StdDev())
+			percentiles(h, 1, "")
+		case Meter:
+			m := metric.Snapshot()
+			l.Printf("meter %s\n", name)
+			printf(FieldCount, "  count:       %9d\n", m.Count())
+			printf(FieldRates, "  1-min rate:  %12.2f\n", m.Rate1())
+			printf(FieldRates, "  5-min rate:  %12.2f\n", m.Rate5())
+			printf(FieldRates, "  15-min rate: %12.2f\n", m.Rate15())
+			printf(FieldRates, "  mean rate:   %12.2f\n", m.RateMean())
+		case Timer:
+			t := metric.Snapshot()
+			l.Printf("timer %s\n", name)
+			printf(FieldCount, "  count:       %9d\n", t.Count())
+			printf(FieldMin, "  min:         %12.2f%s\n", float64(t.Min())/du, duSuffix)
+			printf(FieldMax, "  max:         %12.2f%s\n", float64(t.Max())/du, duSuffix)
+			printf(FieldMean, "  mean:        %12.2f%s\n", t.Mean()/du, duSuffix)
+			printf(FieldStdDev, "  stddev:      %12.2f%s\n", t.StdDev()/du, duSuffix)
+			percentiles(t, du, duSuffix)
+			printf(FieldRates, "  1-min rate:  %12.2f\n", t.Rate1())
+			printf(FieldRates, "  5-min rate:  %12.2f\n", t.Rate5())
+			printf(FieldRates, "  15-min rate: %12.2f\n", t.Rate15())
+			printf(FieldRates, "  mean rate:   %12.2f\n", t.RateMean())
+		}
+	})
 }
@@ -0,0 +1,92 @@
+package metrics
+
+// MergeRegistries merges snapshots of every metric in srcs into dst, so that
+// the metrics of several workers can be exported as one.  Metrics with the
+// same name and tags are combined: counts, gauges and rates are summed and
+// the samples of histograms and timers are unioned.  Healthchecks, and
+// metrics whose type differs from the one already in dst, are skipped.
+//
+// The metrics in dst are replaced by read-only snapshots, so dst should be a
+// registry kept for the purpose, such as a new one for each export.
+func MergeRegistries(dst Registry, srcs ...Registry) {
+	for _, src := range srcs {
+		src.EachTagged(func(name string, tags Tags, i interface{}) {
+			snapshot := snapshotMetric(i)
+			if nil == snapshot {
+				return
+			}
+			if existing := dst.GetTagged(name, tags); nil != existing {
+				if snapshot = mergeSnapshots(snapshotMetric(existing), snapshot); nil == snapshot {
+					return
+				}
+				dst.UnregisterTagged(name, tags)
+			}
+			dst.RegisterTagged(name, tags, snapshot)
+		})
+	}
+}
+
+// snapshotMetric returns a snapshot of a metric whose type has a Merge
+// method, or nil for any other metric.
+func snapshotMetric(i interface{}) interface{} {
+	switch metric := i.(type) {
+	case Counter:
+		return CounterSnapshot(metric.Count())
+	case Gauge:
+		return GaugeSnapshot(metric.Value())
+	case GaugeFloat64:
+		return GaugeFloat64Snapshot(metric.Value())
+	case BucketHistogram:
+		h := metric.Snapshot()
+		return &BucketHistogramSnapshot{buckets: h.Buckets(), sum: h.Sum()}
+	case Histogram:
+		return &HistogramSnapshot{sample: metric.Snapshot().Sample()}
+	case HistogramFloat64:
+		return &HistogramSnapshotFloat64{sample: metric.Snapshot().Sample()}
+	case Meter:
+		return (&MeterSnapshot{}).Merge(metric)
+	case Timer:
+		return timerSnapshot(metric)
+	}
+	return nil
+}
+
+// mergeSnapshots merges two snapshots returned by snapshotMetric, or returns
+// nil if they're of different types.
+func mergeSnapshots(a, b interface{}) interface{} {
+	switch a := a.(type) {
+	case CounterSnapshot:
+		if b, ok := b.(CounterSnapshot); ok {
+			return a.Merge(b)
+		}
+	case GaugeSnapshot:
+		if b, ok := b.(GaugeSnapshot); ok {
+			return a.Merge(b)
+		}
+	case GaugeFloat64Snapshot:
+		if b, ok := b.(GaugeFloat64Snapshot); ok {
+			return a.Merge(b)
+		}
+	case *BucketHistogramSnapshot:
+		if b, ok := b.(*BucketHistogramSnapshot); ok {
+			return a.Merge(b)
+		}
+	case *HistogramSnapshot:
+		if b, ok := b.(*HistogramSnapshot); ok {
+			return a.Merge(b)
+		}
+	case *HistogramSnapshotFloat64:
+		if b, ok := b.(*HistogramSnapshotFloat64); ok {
+			return a.Merge(b)
+		}
+	case *MeterSnapshot:
+		if b, ok := b.(*MeterSnapshot); ok {
+			return a.Merge(b)
+		}
+	case *TimerSnapshot:
+		if b, ok := b.(*TimerSnapshot); ok {
+			return a.Merge(b)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import "testing"
+
+func TestMergeRegistries(t *testing.T) {
+	a, b := NewRegistry(), NewRegistry()
+	defer a.UnregisterAll()
+	defer b.UnregisterAll()
+	NewRegisteredCounter("requests", a).Inc(1)
+	NewRegisteredCounter("requests", b).Inc(2)
+	a.RegisterTagged("requests", Tags{"status": "500"}, NewCounter())
+	NewRegisteredHistogram("size", a, NewUniformSample(100)).Update(1)
+	NewRegisteredHistogram("size", b, NewUniformSample(100)).Update(3)
+	NewRegisteredBucketHistogram("latency", a, []float64{1, 2}).Update(1.5)
+	NewRegisteredBucketHistogram("latency", b, []float64{2, 4}).Update(3)
+	NewRegisteredMeter("events", a).Mark(1)
+	NewRegisteredMeter("events", b).Mark(1)
+	NewRegisteredGauge("requests.inflight", b).Update(1)
+	c := NewRegistry()
+	NewRegisteredGauge("size", c).Update(47)
+
+	dst := NewRegistry()
+	MergeRegistries(dst, a, b, c)
+	if c := dst.Get("requests").(Counter); 3 != c.Count() {
+		t.Errorf("requests: 3 != %v\n", c.Count())
+	}
+	if c := dst.GetTagged("requests", Tags{"status": "500"}); nil == c {
+		t.Error("requests{status=500} wasn't merged")
+	}
+	h := dst.Get("size").(Histogram)
+	if count, mean := h.Count(), h.Mean(); 2 != count || 2 != mean {
+		t.Errorf("size: %v, %v\n", count, mean)
+	}
+	buckets := dst.Get("latency").(BucketHistogram).Buckets()
+	if 2 != len(buckets) || 2 != buckets[0].UpperBound || 1 != buckets[0].Count || 2 != buckets[1].Count {
+		t.Errorf("latency: %v\n", buckets)
+	}
+	if m := dst.Get("events").(Meter); 2 != m.Count() {
+		t.Errorf("events: 2 != %v\n", m.Count())
+	}
+	if g := dst.Get("requests.inflight").(Gauge); 1 != g.Value() {
+		t.Errorf("requests.inflight: 1 != %v\n", g.Value())
+	}
+	if _, ok := dst.Get("size").(Histogram); !ok {
+		t.Error("size was replaced by a gauge")
+	}
+}
+
+func TestMergeTDigestSamples(t *testing.T) {
+	a, b := NewTDigestSample(100), NewTDigestSample(100)
+	for i := 1; i <= 1000; i++ {
+		a.Update(int64(i))
+		b.Update(int64(1000 + i))
+	}
+	h := (&HistogramSnapshot{sample: a.Snapshot()}).Merge(NewHistogram(b))
+	if _, ok := h.Sample().(*TDigestSampleSnapshot); !ok {
+		t.Fatalf("h.Sample(): %T\n", h.Sample())
+	}
+	if count, min, max := h.Count(), h.Min(), h.Max(); 2000 != count || 1 != min || 2000 != max {
+		t.Errorf("h.Count(), h.Min(), h.Max(): %v, %v, %v\n", count, min, max)
+	}
+	if p := h.Percentile(0.5); 990 > p || 1010 < p {
+		t.Errorf("h.Percentile(0.5): %v\n", p)
+	}
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"reflect"
 	"sync"
 	"time"
 )
@@ -15,6 +16,7 @@ type Meter interface {
 	Rate15() float64
 	RateMean() float64
 	Snapshot() Meter
+	Stop()
 }
 
 // GetOrRegisterMeter returns an existing Meter or constructs and registers a
@@ -28,17 +30,17 @@ func GetOrRegisterMeter(name string, r Registry) Meter {
 
 // NewMeter constructs a new StandardMeter and launches a goroutine.
 func NewMeter() Meter {
+	return NewMeterWithClock(SystemClock)
+}
+
+// NewMeterWithClock constructs a new StandardMeter which takes the time from
+// and is ticked by the given Clock.
+func NewMeterWithClock(c Clock) Meter {
 	if UseNilMetrics {
 		return NilMeter{}
 	}
-	m := newStandardMeter()
-	arbiter.Lock()
-	defer arbiter.Unlock()
-	arbiter.meters = append(arbiter.meters, m)
-	if !arbiter.started {
-		arbiter.started = true
-		go arbiter.tick()
-	}
+	m := newStandardMeter(c)
+	startMeter(m)
 	return m
 }
 
@@ -57,16 +59,39 @@ func NewRegisteredMeter(name string, r Registry) Meter {
 type MeterSnapshot struct {
 	count                          int64
 	rate1, rate5, rate15, rateMean float64
+	created                        time.Time
 }
 
 // Count returns the count of events at the time the snapshot was taken.
 func (m *MeterSnapshot) Count() int64 { return m.count }
 
+// Created returns the time the meter was constructed.
+func (m *MeterSnapshot) Created() time.Time { return m.created }
+
 // Mark panics.
 func (*MeterSnapshot) Mark(n int64) {
 	panic("Mark called on a MeterSnapshot")
 }
 
+// Merge returns a snapshot whose count and rates are the sums of this
+// snapshot's and another Meter's, as though every event had been marked on a
+// single meter constructed when the earlier of the two was.
+func (m *MeterSnapshot) Merge(o Meter) *MeterSnapshot {
+	o = o.Snapshot()
+	created := m.created
+	if c := createdOf(o); created.IsZero() || !c.IsZero() && c.Before(created) {
+		created = c
+	}
+	return &MeterSnapshot{
+		count:    m.count + o.Count(),
+		rate1:    m.rate1 + o.Rate1(),
+		rate5:    m.rate5 + o.Rate5(),
+		rate15:   m.rate15 + o.Rate15(),
+		rateMean: m.rateMean + o.RateMean(),
+		created:  created,
+	}
+}
+
 // Rate1 returns the one-minute moving average rate of events per second at the
 // time the snapshot was taken.
 func (m *MeterSnapshot) Rate1() float64 { return m.rate1 }
@@ -86,12 +111,18 @@ func (m *MeterSnapshot) RateMean() float64 { return m.rateMean }
 // Snapshot returns the snapshot.
 func (m *MeterSnapshot) Snapshot() Meter { return m }
 
+// Stop is a no-op.
+func (m *MeterSnapshot) Stop() {}
+
 // NilMeter is a no-op Meter.
 type NilMeter struct{}
 
 // Count is a no-op.
 func (NilMeter) Count() int64 { return 0 }
 
+// Created is a no-op.
+func (NilMeter) Created() time.Time { return time.Time{} }
+
 // Mark is a no-op.
 func (NilMeter) Mark(n int64) {}
 
@@ -110,21 +141,29 @@ func (NilMeter) RateMean() float64 { return 0.0 }
 // Snapshot is a no-op.
 func (NilMeter) Snapshot() Meter { return NilMeter{} }
 
+// Stop is a no-op.
+func (NilMeter) Stop() {}
+
 // StandardMeter is the standard implementation of a Meter.
 type StandardMeter struct {
 	lock        sync.RWMutex
 	snapshot    *MeterSnapshot
 	a1, a5, a15 EWMA
+	clock       Clock
+	arbiter     *meterArbiter
 	startTime   time.Time
+	stopped     bool
 }
 
-func newStandardMeter() *StandardMeter {
+func newStandardMeter(c Clock) *StandardMeter {
+	now := c.Now()
 	return &StandardMeter{
-		snapshot:  &MeterSnapshot{},
+		snapshot:  &MeterSnapshot{created: now},
 		a1:        NewEWMA1(),
 		a5:        NewEWMA5(),
 		a15:       NewEWMA15(),
-		startTime: time.Now(),
+		clock:     c,
+		startTime: now,
 	}
 }
 
@@ -136,10 +175,21 @@ func (m *StandardMeter) Count() int64 {
 	return count
 }
 
-// Mark records the occurance of n events.
+// Created returns the time the meter was constructed.
+func (m *StandardMeter) Created() time.Time {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.startTime
+}
+
+// Mark records the occurance of n events.  It is a no-op once the meter has
+// been stopped.
 func (m *StandardMeter) Mark(n int64) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	if m.stopped {
+		return
+	}
 	m.snapshot.count += n
 	m.a1.Update(n)
 	m.a5.Update(n)
@@ -187,13 +237,47 @@ func (m *StandardMeter) Snapshot() Meter {
 	return &snapshot
 }
 
+// Stop detaches the meter from the goroutine which ticks its moving averages
+// so that it can be garbage collected.  The meter's rates are frozen and Mark
+// becomes a no-op.
+func (m *StandardMeter) Stop() {
+	m.lock.Lock()
+	stopped := m.stopped
+	m.stopped = true
+	m.lock.Unlock()
+	if !stopped {
+		m.arbiter.remove(m)
+	}
+}
+
+// checkpoint returns the count and start time of the meter.
+func (m *StandardMeter) checkpoint() *persistedState {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return &persistedState{Count: m.snapshot.count, Start: m.startTime}
+}
+
+// restore adds a checkpointed count to the meter and takes the checkpointed
+// start time if it is earlier, so that the mean rate spans both.  The moving
+// averages aren't affected.
+func (m *StandardMeter) restore(s *persistedState) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.snapshot.count += s.Count
+	if !s.Start.IsZero() && s.Start.Before(m.startTime) {
+		m.startTime = s.Start
+		m.snapshot.created = s.Start
+	}
+	m.updateSnapshot()
+}
+
 func (m *StandardMeter) updateSnapshot() {
 	// should run with write lock held on m.lock
 	snapshot := m.snapshot
 	snapshot.rate1 = m.a1.Rate()
 	snapshot.rate5 = m.a5.Rate()
 	snapshot.rate15 = m.a15.Rate()
-	snapshot.rateMean = float64(snapshot.count) / time.Since(m.startTime).Seconds()
+	snapshot.rateMean = float64(snapshot.count) / m.clock.Now().Sub(m.startTime).Seconds()
 }
 
 func (m *StandardMeter) tick() {
@@ -205,21 +289,65 @@ func (m *StandardMeter) tick() {
 	m.updateSnapshot()
 }
 
+// meterArbiter ticks every running meter of a Clock from a single Ticker,
+// which is started with the first meter and stopped with the last one.
 type meterArbiter struct {
 	sync.RWMutex
-	started bool
-	meters  []*StandardMeter
-	ticker  *time.Ticker
+	clock  Clock
+	meters map[*StandardMeter]struct{}
+	ticker Ticker
+}
+
+// arbiters holds the meterArbiter of each Clock running meters have been made
+// with.  Meters made with a Clock which can't be a map key are given an
+// arbiter of their own.
+var arbiters = struct {
+	sync.Mutex
+	m map[Clock]*meterArbiter
+}{m: make(map[Clock]*meterArbiter)}
+
+// startMeter adds the meter to the arbiter of its Clock, making one if need
+// be.
+func startMeter(m *StandardMeter) {
+	arbiters.Lock()
+	defer arbiters.Unlock()
+	comparable := reflect.TypeOf(m.clock).Comparable()
+	var ma *meterArbiter
+	if comparable {
+		ma = arbiters.m[m.clock]
+	}
+	if nil == ma {
+		ma = &meterArbiter{clock: m.clock, meters: make(map[*StandardMeter]struct{})}
+		if comparable {
+			arbiters.m[m.clock] = ma
+		}
+	}
+	m.arbiter = ma
+	ma.add(m)
 }
 
-var arbiter = meterArbiter{ticker: time.NewTicker(5e9)}
+func (ma *meterArbiter) add(m *StandardMeter) {
+	ma.Lock()
+	defer ma.Unlock()
+	ma.meters[m] = struct{}{}
+	if nil == ma.ticker {
+		ma.ticker = ma.clock.Tick(5*time.Second, ma.tickMeters)
+	}
+}
 
-// Ticks meters on the scheduled interval
-func (ma *meterArbiter) tick() {
-	for {
-		select {
-		case <-ma.ticker.C:
-			ma.tickMeters()
+// remove stops ticking the meter and forgets the arbiter once it has no
+// meters left.
+func (ma *meterArbiter) remove(m *StandardMeter) {
+	arbiters.Lock()
+	defer arbiters.Unlock()
+	ma.Lock()
+	defer ma.Unlock()
+	delete(ma.meters, m)
+	if nil != ma.ticker && 0 == len(ma.meters) {
+		ma.ticker.Stop()
+		ma.ticker = nil
+		if reflect.TypeOf(ma.clock).Comparable() && ma == arbiters.m[ma.clock] {
+			delete(arbiters.m, ma.clock)
 		}
 	}
 }
@@ -227,7 +355,7 @@ func (ma *meterArbiter) tick() {
 func (ma *meterArbiter) tickMeters() {
 	ma.RLock()
 	defer ma.RUnlock()
-	for _, meter := range ma.meters {
+	for meter := range ma.meters {
 		meter.tick()
 	}
 }
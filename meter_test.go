@@ -22,15 +22,16 @@ func TestGetOrRegisterMeter(t *testing.T) {
 }
 
 func TestMeterDecay(t *testing.T) {
-	ma := meterArbiter{
-		ticker: time.NewTicker(time.Millisecond),
-	}
-	m := newStandardMeter()
-	ma.meters = append(ma.meters, m)
-	go ma.tick()
+	c := NewManualClock(time.Now())
+	m := NewMeterWithClock(c)
+	defer m.Stop()
 	m.Mark(1)
-	rateMean := m.RateMean()
-	time.Sleep(100 * time.Millisecond)
+	c.Add(5 * time.Second)
+	rate1, rateMean := m.Rate1(), m.RateMean()
+	c.Add(5 * time.Second)
+	if m.Rate1() >= rate1 {
+		t.Error("m.Rate1() didn't decrease")
+	}
 	if m.RateMean() >= rateMean {
 		t.Error("m.RateMean() didn't decrease")
 	}
@@ -52,9 +53,103 @@ func TestMeterSnapshot(t *testing.T) {
 	}
 }
 
+func TestMeterStop(t *testing.T) {
+	m := NewMeter()
+	m.Mark(1)
+	m.Stop()
+	ma := m.(*StandardMeter).arbiter
+	ma.RLock()
+	_, ok := ma.meters[m.(*StandardMeter)]
+	ma.RUnlock()
+	if ok {
+		t.Error("stopped meter is still ticked by the arbiter")
+	}
+	m.Mark(1)
+	if count := m.Count(); 1 != count {
+		t.Errorf("m.Count(): 1 != %v\n", count)
+	}
+	m.Stop()
+}
+
+func TestMeterArbiterExits(t *testing.T) {
+	c := NewManualClock(time.Now())
+	m1, m2 := NewMeterWithClock(c), NewMeterWithClock(c)
+	ma := m1.(*StandardMeter).arbiter
+	m1.Stop()
+	if nil == ma.ticker {
+		t.Fatal("arbiter stopped with a meter remaining")
+	}
+	m2.Stop()
+	if nil != ma.ticker {
+		t.Fatal("arbiter still ticking with no meters")
+	}
+	if 0 != len(c.tickers) {
+		t.Errorf("len(c.tickers): 0 != %v\n", len(c.tickers))
+	}
+}
+
+func TestMeterArbiterForgotten(t *testing.T) {
+	c := NewManualClock(time.Now())
+	m := NewMeterWithClock(c)
+	arbiters.Lock()
+	_, ok := arbiters.m[c]
+	arbiters.Unlock()
+	if !ok {
+		t.Fatal("no arbiter for the clock")
+	}
+	m.Stop()
+	arbiters.Lock()
+	_, ok = arbiters.m[c]
+	arbiters.Unlock()
+	if ok {
+		t.Error("arbiter kept with no meters")
+	}
+}
+
+func TestMeterUnhashableClock(t *testing.T) {
+	c := unhashableClock{NewManualClock(time.Now()), nil}
+	m1, m2 := NewMeterWithClock(c), NewMeterWithClock(c)
+	defer m1.Stop()
+	defer m2.Stop()
+	m1.Mark(60)
+	c.Add(5 * time.Second)
+	if rate := m1.Rate1(); 0 == rate {
+		t.Errorf("m1.Rate1(): %v\n", rate)
+	}
+}
+
+type unhashableClock struct {
+	*ManualClock
+	_ []int
+}
+
 func TestMeterZero(t *testing.T) {
 	m := NewMeter()
 	if count := m.Count(); 0 != count {
 		t.Errorf("m.Count(): 0 != %v\n", count)
 	}
 }
+
+func TestMeterSnapshotMerge(t *testing.T) {
+	a := &MeterSnapshot{count: 1, rate1: 1, rate5: 2, rate15: 3, rateMean: 4}
+	b := &MeterSnapshot{count: 2, rate1: 0.5, rate5: 0.5, rate15: 0.5, rateMean: 0.5}
+	m := a.Merge(b)
+	if 3 != m.Count() || 1.5 != m.Rate1() || 2.5 != m.Rate5() || 3.5 != m.Rate15() || 4.5 != m.RateMean() {
+		t.Errorf("m: %+v\n", *m)
+	}
+}
+
+func TestMeterCreated(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	m := NewMeterWithClock(clock)
+	defer m.Stop()
+	clock.Add(time.Minute)
+	if created := m.Snapshot().(*MeterSnapshot).Created(); !time.Unix(1000, 0).Equal(created) {
+		t.Errorf("m.Snapshot().Created(): %v\n", created)
+	}
+	o := NewMeterWithClock(clock)
+	defer o.Stop()
+	if created := m.Snapshot().(*MeterSnapshot).Merge(o).Created(); !time.Unix(1000, 0).Equal(created) {
+		t.Errorf("merged Created(): %v\n", created)
+	}
+}
@@ -2,10 +2,17 @@ package metrics
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"math"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,13 +20,21 @@ import (
 var shortHostName string = ""
 
 // OpenTSDBConfig provides a container with configuration parameters for
-// the OpenTSDB exporter
+// the OpenTSDB exporter.  Datapoints are sent as JSON to the /api/put
+// endpoint of URL if it is set and with the telnet put protocol to Addr
+// otherwise.
 type OpenTSDBConfig struct {
 	Addr          *net.TCPAddr  // Network address to connect to
+	URL           string        // Base URL of the HTTP API, i.e. http://localhost:4242
 	Registry      Registry      // Registry to be exported
 	FlushInterval time.Duration // Flush interval
 	DurationUnit  time.Duration // Time conversion unit for durations
 	Prefix        string        // Prefix to be prepended to metric names
+	Percentiles   []float64     // Percentiles to export from timers and histograms, 50th to 99.9th if nil
+	Tags          Tags          // Tags to be added to every datapoint, host=<short hostname> if nil or if a datapoint would have none
+	BatchSize     int           // Datapoints per HTTP request, 50 if zero
+	Gzip          bool          // Compress HTTP request bodies
+	Client        *http.Client  // HTTP client, http.DefaultClient if nil
 }
 
 // OpenTSDB is a blocking exporter function which reports metrics in r
@@ -32,17 +47,34 @@ func OpenTSDB(r Registry, d time.Duration, prefix string, addr *net.TCPAddr) {
 		FlushInterval: d,
 		DurationUnit:  time.Nanosecond,
 		Prefix:        prefix,
+		Percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
 	})
 }
 
 // OpenTSDBWithConfig is a blocking exporter function just like OpenTSDB,
 // but it takes a OpenTSDBConfig instead.
 func OpenTSDBWithConfig(c OpenTSDBConfig) {
-	for _ = range time.Tick(c.FlushInterval) {
-		if err := openTSDB(&c); nil != err {
-			log.Println(err)
-		}
-	}
+	OpenTSDBContext(context.Background(), c, nil)
+}
+
+// OpenTSDBContext is a blocking exporter function just like
+// OpenTSDBWithConfig, but it returns after a final flush once ctx is done
+// and passes each failed flush to onError instead of logging it.
+func OpenTSDBContext(ctx context.Context, c OpenTSDBConfig, onError func(error)) {
+	RunReporter(ctx, c.FlushInterval, func() error { return openTSDB(&c) }, onError)
+}
+
+// OpenTSDBError is the error returned when OpenTSDB rejects some or all of
+// the datapoints sent to /api/put.
+type OpenTSDBError struct {
+	StatusCode int
+	Success    int      // Datapoints stored, as reported in the response details
+	Failed     int      // Datapoints rejected, as reported in the response details
+	Errors     []string // Why each datapoint was rejected, or the response body
+}
+
+func (err *OpenTSDBError) Error() string {
+	return fmt.Sprintf("opentsdb: %d %s: %d datapoints failed: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Failed, strings.Join(err.Errors, "; "))
 }
 
 func getShortHostname() string {
@@ -57,63 +89,210 @@ func getShortHostname() string {
 	return shortHostName
 }
 
+// openTSDBTags merges the global tags with a metric's tags, which take
+// precedence.
+func openTSDBTags(global, tags Tags) Tags {
+	all := make(Tags, len(global)+len(tags))
+	for k, v := range global {
+		all[openTSDBTagReplacer.Replace(k)] = openTSDBTagReplacer.Replace(v)
+	}
+	for k, v := range tags {
+		all[openTSDBTagReplacer.Replace(k)] = openTSDBTagReplacer.Replace(v)
+	}
+	return all
+}
+
+// openTSDBTagList renders tags, in sorted key order, as a space-separated
+// list of key=value pairs.
+func openTSDBTagList(tags Tags) string {
+	list := make([]string, 0, len(tags))
+	for _, k := range tags.Keys() {
+		list = append(list, k+"="+tags[k])
+	}
+	return strings.Join(list, " ")
+}
+
+var openTSDBTagReplacer = strings.NewReplacer(" ", "_", "=", "_")
+
+// openTSDBPoint is a single datapoint in the form /api/put accepts.  Its
+// value is written to the telnet protocol with prec digits after the
+// decimal point.
+type openTSDBPoint struct {
+	Metric    string  `json:"metric"`
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+	Tags      Tags    `json:"tags"`
+	prec      int
+}
+
 func openTSDB(c *OpenTSDBConfig) error {
-	shortHostname := getShortHostname()
-	now := time.Now().Unix()
-	du := float64(c.DurationUnit)
+	points := openTSDBPoints(c, time.Now().Unix())
+	if "" != c.URL {
+		return openTSDBHTTP(c, points)
+	}
 	conn, err := net.DialTCP("tcp", nil, c.Addr)
 	if nil != err {
 		return err
 	}
 	defer conn.Close()
 	w := bufio.NewWriter(conn)
-	c.Registry.Each(func(name string, i interface{}) {
+	for _, p := range points {
+		fmt.Fprintf(w, "put %s %d %s %s\n", p.Metric, p.Timestamp, strconv.FormatFloat(p.Value, 'f', p.prec, 64), openTSDBTagList(p.Tags))
+	}
+	return w.Flush()
+}
+
+// openTSDBPoints returns a datapoint for each field of each metric in the
+// registry, less any NaN or infinite values, which OpenTSDB can't store.
+func openTSDBPoints(c *OpenTSDBConfig, now int64) []openTSDBPoint {
+	var points []openTSDBPoint
+	du := float64(c.DurationUnit)
+	if 0 == du {
+		du = 1
+	}
+	global := c.Tags
+	if nil == global {
+		global = Tags{"host": getShortHostname()}
+	}
+	percentiles := c.Percentiles
+	if nil == percentiles {
+		percentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+	}
+	c.Registry.EachTagged(func(name string, tags Tags, i interface{}) {
+		tags = openTSDBTags(global, tags)
+		if 0 == len(tags) {
+			// OpenTSDB rejects datapoints without tags.
+			tags = Tags{"host": getShortHostname()}
+		}
+		point := func(field string, value float64, prec int) {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				return
+			}
+			points = append(points, openTSDBPoint{c.Prefix + "." + name + "." + field, now, value, tags, prec})
+		}
+		percentile := func(ps []float64, div float64) {
+			for psIdx, psKey := range percentiles {
+				key := PercentileKey(psKey)
+				point(key+"-percentile", ps[psIdx]/div, 2)
+			}
+		}
 		switch metric := i.(type) {
 		case Counter:
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, metric.Count(), shortHostname)
+			point("count", float64(metric.Count()), 0)
 		case Gauge:
-			fmt.Fprintf(w, "put %s.%s.value %d %d host=%s\n", c.Prefix, name, now, metric.Value(), shortHostname)
+			point("value", float64(metric.Value()), 0)
 		case GaugeFloat64:
-			fmt.Fprintf(w, "put %s.%s.value %d %f host=%s\n", c.Prefix, name, now, metric.Value(), shortHostname)
+			point("value", metric.Value(), 6)
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, h.Count(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.min %d %d host=%s\n", c.Prefix, name, now, h.Min(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.max %d %d host=%s\n", c.Prefix, name, now, h.Max(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, h.Mean(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.std-dev %d %.2f host=%s\n", c.Prefix, name, now, h.StdDev(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.50-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[0], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.75-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[1], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.95-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[2], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.99-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[3], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.999-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[4], shortHostname)
+			point("count", float64(h.Count()), 0)
+			point("min", float64(h.Min()), 0)
+			point("max", float64(h.Max()), 0)
+			point("mean", h.Mean(), 2)
+			point("std-dev", h.StdDev(), 2)
+			percentile(h.Percentiles(percentiles), 1)
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			point("count", float64(h.Count()), 0)
+			point("min", h.Min(), 6)
+			point("max", h.Max(), 6)
+			point("mean", h.Mean(), 2)
+			point("std-dev", h.StdDev(), 2)
+			percentile(h.Percentiles(percentiles), 1)
 		case Meter:
 			m := metric.Snapshot()
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, m.Count(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.one-minute %d %.2f host=%s\n", c.Prefix, name, now, m.Rate1(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.five-minute %d %.2f host=%s\n", c.Prefix, name, now, m.Rate5(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.fifteen-minute %d %.2f host=%s\n", c.Prefix, name, now, m.Rate15(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, m.RateMean(), shortHostname)
+			point("count", float64(m.Count()), 0)
+			point("one-minute", m.Rate1(), 2)
+			point("five-minute", m.Rate5(), 2)
+			point("fifteen-minute", m.Rate15(), 2)
+			point("mean", m.RateMean(), 2)
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, t.Count(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.min %d %d host=%s\n", c.Prefix, name, now, t.Min()/int64(du), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.max %d %d host=%s\n", c.Prefix, name, now, t.Max()/int64(du), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, t.Mean()/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.std-dev %d %.2f host=%s\n", c.Prefix, name, now, t.StdDev()/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.50-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[0]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.75-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[1]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.95-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[2]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.99-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[3]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.999-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[4]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.one-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate1(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.five-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate5(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.fifteen-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate15(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean-rate %d %.2f host=%s\n", c.Prefix, name, now, t.RateMean(), shortHostname)
+			point("count", float64(t.Count()), 0)
+			point("min", float64(t.Min()/int64(du)), 0)
+			point("max", float64(t.Max()/int64(du)), 0)
+			point("mean", t.Mean()/du, 2)
+			point("std-dev", t.StdDev()/du, 2)
+			percentile(t.Percentiles(percentiles), du)
+			point("one-minute", t.Rate1(), 2)
+			point("five-minute", t.Rate5(), 2)
+			point("fifteen-minute", t.Rate15(), 2)
+			point("mean-rate", t.RateMean(), 2)
 		}
-		w.Flush()
 	})
+	return points
+}
+
+// openTSDBHTTP posts the datapoints to /api/put in batches, asking for the
+// details of any failures, and returns the first error.
+func openTSDBHTTP(c *OpenTSDBConfig, points []openTSDBPoint) error {
+	size := c.BatchSize
+	if size <= 0 {
+		size = 50
+	}
+	client := c.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	u := strings.TrimSuffix(c.URL, "/") + "/api/put?details"
+	for i := 0; i < len(points); i += size {
+		end := i + size
+		if end > len(points) {
+			end = len(points)
+		}
+		if err := openTSDBPost(client, c, u, points[i:end]); nil != err {
+			return err
+		}
+	}
 	return nil
 }
+
+func openTSDBPost(client *http.Client, c *OpenTSDBConfig, u string, points []openTSDBPoint) error {
+	var body bytes.Buffer
+	if c.Gzip {
+		gz := gzip.NewWriter(&body)
+		if err := json.NewEncoder(gz).Encode(points); nil != err {
+			return err
+		}
+		if err := gz.Close(); nil != err {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(points); nil != err {
+		return err
+	}
+	req, err := http.NewRequest("POST", u, &body)
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	var details struct {
+		Success int
+		Failed  int
+		Errors  []struct {
+			Error string
+		}
+	}
+	parsed := nil == json.Unmarshal(b, &details)
+	if resp.StatusCode/100 == 2 && 0 == details.Failed {
+		return nil
+	}
+	e := &OpenTSDBError{StatusCode: resp.StatusCode}
+	if !parsed {
+		e.Errors = []string{strings.TrimSpace(string(b))}
+		return e
+	}
+	e.Success, e.Failed = details.Success, details.Failed
+	for _, d := range details.Errors {
+		e.Errors = append(e.Errors, d.Error)
+	}
+	return e
+}
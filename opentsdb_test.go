@@ -1,7 +1,14 @@
 package metrics
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"math"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
 	"time"
 )
 
@@ -19,3 +26,133 @@ func ExampleOpenTSDBWithConfig() {
 		DurationUnit:  time.Millisecond,
 	})
 }
+
+func TestOpenTSDBTags(t *testing.T) {
+	global := Tags{"host": "web1"}
+	if tags := openTSDBTagList(openTSDBTags(global, Tags{"status": "200", "method": "GET"})); "host=web1 method=GET status=200" != tags {
+		t.Fatal(tags)
+	}
+	if tags := openTSDBTagList(openTSDBTags(global, Tags{"host": "web2"})); "host=web2" != tags {
+		t.Fatal(tags)
+	}
+	if tags := openTSDBTagList(openTSDBTags(Tags{"dc": "us east"}, nil)); "dc=us_east" != tags {
+		t.Fatal(tags)
+	}
+}
+
+func TestOpenTSDBPercentiles(t *testing.T) {
+	r := NewRegistry()
+	tm := NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(2 * time.Second)
+	c := OpenTSDBConfig{
+		Registry:     r,
+		DurationUnit: time.Millisecond,
+		Prefix:       "app",
+		Percentiles:  []float64{0.9},
+		Tags:         Tags{"dc": "east"},
+	}
+	values := make(map[string]float64)
+	for _, p := range openTSDBPoints(&c, 1000) {
+		if "dc=east" != openTSDBTagList(p.Tags) {
+			t.Error(p.Tags)
+		}
+		values[p.Metric] = p.Value
+	}
+	if v, ok := values["app.latency.90-percentile"]; !ok || 2000 != v {
+		t.Error(values)
+	}
+	if _, ok := values["app.latency.50-percentile"]; ok {
+		t.Error(values)
+	}
+}
+
+func TestOpenTSDBPointsDefaults(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r)
+	NewRegisteredGaugeFloat64("load", r).Update(math.NaN())
+	NewRegisteredGaugeFloat64("ratio", r).Update(math.Inf(-1))
+	points := openTSDBPoints(&OpenTSDBConfig{Registry: r, Prefix: "app", Tags: Tags{}}, 1000)
+	if 1 != len(points) || "app.requests.count" != points[0].Metric {
+		t.Fatal(points)
+	}
+	if tags := openTSDBTagList(points[0].Tags); "host="+getShortHostname() != tags {
+		t.Fatal(tags)
+	}
+}
+
+func TestOpenTSDBHTTP(t *testing.T) {
+	var batches [][]map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.URL.Query()["details"]; "/api/put" != req.URL.Path || !ok {
+			t.Error(req.URL)
+		}
+		if "gzip" != req.Header.Get("Content-Encoding") {
+			t.Error(req.Header)
+		}
+		gz, err := gzip.NewReader(req.Body)
+		if nil != err {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var batch []map[string]interface{}
+		if err := json.NewDecoder(gz).Decode(&batch); nil != err {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, batch)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		NewRegisteredCounter(name, r).Inc(1)
+	}
+	err := openTSDB(&OpenTSDBConfig{
+		URL:       ts.URL,
+		Registry:  r,
+		Prefix:    "app",
+		Tags:      Tags{"host": "web1"},
+		BatchSize: 2,
+		Gzip:      true,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(batches) || 2 != len(batches[0]) || 1 != len(batches[1]) {
+		t.Fatal(batches)
+	}
+	points := make(map[interface{}]map[string]interface{})
+	for _, batch := range batches {
+		for _, p := range batch {
+			points[p["metric"]] = p
+		}
+	}
+	p := points["app.a.count"]
+	if nil == p || 1.0 != p["value"] || "web1" != p["tags"].(map[string]interface{})["host"] {
+		t.Error(points)
+	}
+}
+
+func TestOpenTSDBHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":[{"datapoint":{},"error":"Unable to parse value to a number"}],"failed":1,"success":2}`))
+	}))
+	defer ts.Close()
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r)
+	err := openTSDB(&OpenTSDBConfig{URL: ts.URL, Registry: r})
+	e, ok := err.(*OpenTSDBError)
+	if !ok {
+		t.Fatal(err)
+	}
+	if http.StatusBadRequest != e.StatusCode || 2 != e.Success || 1 != e.Failed {
+		t.Error(e)
+	}
+	if !strings.Contains(e.Error(), "Unable to parse value to a number") {
+		t.Error(e)
+	}
+}
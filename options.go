@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields selects the statistics of histograms, meters and timers that an
+// output reports.  Counters, gauges and healthchecks are always reported.
+type Fields uint
+
+const (
+	FieldCount Fields = 1 << iota
+	FieldMin
+	FieldMax
+	FieldMean
+	FieldStdDev
+	FieldPercentiles
+	FieldRates // The one-, five- and fifteen-minute and mean rates
+
+	AllFields = FieldCount | FieldMin | FieldMax | FieldMean | FieldStdDev | FieldPercentiles | FieldRates
+)
+
+// OutputOptions configures the JSON, Log, Syslog and Write outputs as well as
+// the exp and stathat packages.  The zero value reports what they always
+// have.
+type OutputOptions struct {
+	Percentiles  []float64     // Percentiles to report, 50th to 99.9th if nil
+	DurationUnit time.Duration // Unit of timer durations, nanoseconds if zero
+	Fields       Fields        // Statistics to report, AllFields if zero
+}
+
+// WithDefaults returns a copy of the options with every zero field set to its
+// default.
+func (o OutputOptions) WithDefaults() OutputOptions {
+	if nil == o.Percentiles {
+		o.Percentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+	}
+	if 0 == o.DurationUnit {
+		o.DurationUnit = time.Nanosecond
+	}
+	if 0 == o.Fields {
+		o.Fields = AllFields
+	}
+	return o
+}
+
+// Has reports whether the options include every one of the given fields.
+func (o OutputOptions) Has(f Fields) bool {
+	return 0 == o.Fields || f == o.Fields&f
+}
+
+// PercentileKey returns the percentage of a percentile without its decimal
+// point, such as "999" for the 99.9th, as used in names such as
+// "latency.999-percentile".
+func PercentileKey(p float64) string {
+	return strings.Replace(percentage(p), ".", "", 1)
+}
+
+// PercentileLabel returns "median" for the 50th percentile and the percentage
+// followed by a percent sign, such as "99.9%", for any other.
+func PercentileLabel(p float64) string {
+	if 0.5 == p {
+		return "median"
+	}
+	return percentage(p) + "%"
+}
+
+// percentage formats a percentile as a percentage rounded to ten significant
+// figures, so that 0.07 gives "7" rather than "7.000000000000001".
+func percentage(p float64) string {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(p*100, 'g', 10, 64), 64)
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// parsePercentileLabel is the inverse of PercentileLabel.
+func parsePercentileLabel(label string) (float64, bool) {
+	if "median" == label {
+		return 0.5, true
+	}
+	if !strings.HasSuffix(label, "%") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(strings.TrimSuffix(label, "%")+"e-2", 64)
+	return p, nil == err
+}
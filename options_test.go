@@ -0,0 +1,35 @@
+package metrics
+
+import "testing"
+
+func TestOutputOptionsHas(t *testing.T) {
+	if o := (OutputOptions{}); !o.Has(AllFields) {
+		t.Error("zero options don't include every field")
+	}
+	o := OutputOptions{Fields: FieldCount | FieldPercentiles}
+	if !o.Has(FieldCount) || !o.Has(FieldCount|FieldPercentiles) || o.Has(FieldMin) || o.Has(FieldCount|FieldRates) {
+		t.Error(o.Fields)
+	}
+}
+
+func TestPercentileLabel(t *testing.T) {
+	for p, label := range map[float64]string{0.07: "7%", 0.29: "29%", 0.5: "median", 0.57: "57%", 0.75: "75%", 0.9: "90%", 0.999: "99.9%", 0.9999: "99.99%"} {
+		if l := PercentileLabel(p); label != l {
+			t.Errorf("%v: %q != %q\n", p, label, l)
+		}
+		if q, ok := parsePercentileLabel(label); !ok || p != q {
+			t.Errorf("%q: %v != %v\n", label, p, q)
+		}
+	}
+	if _, ok := parsePercentileLabel("mean"); ok {
+		t.Error("parsed mean")
+	}
+}
+
+func TestPercentileKey(t *testing.T) {
+	for p, key := range map[float64]string{0.07: "7", 0.29: "29", 0.5: "50", 0.57: "57", 0.999: "999", 0.9999: "9999"} {
+		if k := PercentileKey(p); key != k {
+			t.Errorf("%v: %q != %q\n", p, key, k)
+		}
+	}
+}
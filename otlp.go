@@ -0,0 +1,459 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OTLPConfig provides a container with configuration parameters for the
+// OpenTelemetry exporter, which posts protocol buffers to an OTLP/HTTP
+// endpoint such as that of the OpenTelemetry Collector.
+type OTLPConfig struct {
+	URL                string            // Endpoint to post to, i.e. http://localhost:4318/v1/metrics
+	Registry           Registry          // Registry to be exported
+	FlushInterval      time.Duration     // Flush interval
+	DurationUnit       time.Duration     // Time conversion unit for durations
+	Prefix             string            // Prefix to be prepended to metric names
+	Percentiles        []float64         // Quantiles to export from timers and histograms
+	ResourceAttributes Tags              // Attributes of the resource, service.name=unknown_service:<program> if missing
+	Headers            map[string]string // Headers to be added to every request, such as for authentication
+	Gzip               bool              // Compress request bodies
+	Client             *http.Client      // HTTP client, http.DefaultClient if nil
+}
+
+// OTLP is a blocking exporter function which reports metrics in r to the
+// OTLP/HTTP endpoint at u every d duration.
+func OTLP(r Registry, d time.Duration, u string) {
+	OTLPWithConfig(OTLPConfig{
+		URL:           u,
+		Registry:      r,
+		FlushInterval: d,
+		DurationUnit:  time.Second,
+		Percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
+	})
+}
+
+// OTLPWithConfig is a blocking exporter function just like OTLP, but it
+// takes an OTLPConfig instead.
+func OTLPWithConfig(c OTLPConfig) {
+	OTLPContext(context.Background(), c, nil)
+}
+
+// OTLPContext is a blocking exporter function just like OTLPWithConfig, but
+// it returns after a final flush once ctx is done and passes each failed
+// flush to onError instead of logging it.
+func OTLPContext(ctx context.Context, c OTLPConfig, onError func(error)) {
+	RunReporter(ctx, c.FlushInterval, func() error { return otlp(&c) }, onError)
+}
+
+// OTLPOnce performs a single export, returning a non-nil error on failure.
+func OTLPOnce(c OTLPConfig) error {
+	return otlp(&c)
+}
+
+// OTLPError is the error returned when the endpoint rejects an export, or
+// some of the datapoints in it.
+type OTLPError struct {
+	StatusCode int
+	Rejected   int64  // Datapoints rejected by a partially successful export
+	Message    string // Message of the returned status, or the response body
+}
+
+func (err *OTLPError) Error() string {
+	if 0 < err.Rejected {
+		return fmt.Sprintf("otlp: %d datapoints rejected: %s", err.Rejected, err.Message)
+	}
+	return fmt.Sprintf("otlp: %d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+func otlp(c *OTLPConfig) error {
+	var body bytes.Buffer
+	msg := otlpRequest(c, time.Now())
+	if c.Gzip {
+		gz := gzip.NewWriter(&body)
+		if _, err := gz.Write(msg); nil != err {
+			return err
+		}
+		if err := gz.Close(); nil != err {
+			return err
+		}
+	} else {
+		body.Write(msg)
+	}
+	req, err := http.NewRequest("POST", c.URL, &body)
+	if nil != err {
+		return err
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if c.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	client := c.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		// The body is a google.rpc.Status whose message is field 2.
+		e := &OTLPError{StatusCode: resp.StatusCode}
+		err := protoFields(b, func(field, wire int, v uint64, data []byte) {
+			if 2 == field && 2 == wire {
+				e.Message = string(data)
+			}
+		})
+		if nil != err || "" == e.Message {
+			e.Message = strings.TrimSpace(string(b))
+		}
+		return e
+	}
+	// The body is an ExportMetricsServiceResponse whose partial_success, field
+	// 1, counts rejected datapoints in field 1 and explains why in field 2.
+	e := &OTLPError{StatusCode: resp.StatusCode}
+	protoFields(b, func(field, wire int, v uint64, data []byte) {
+		if 1 == field && 2 == wire {
+			protoFields(data, func(field, wire int, v uint64, data []byte) {
+				if 1 == field && 0 == wire {
+					e.Rejected = int64(v)
+				} else if 2 == field && 2 == wire {
+					e.Message = string(data)
+				}
+			})
+		}
+	})
+	if 0 < e.Rejected {
+		return e
+	}
+	return nil
+}
+
+// Aggregation temporalities of sums and histograms.
+const (
+	otlpDelta      = 1
+	otlpCumulative = 2
+)
+
+// otlpRequest encodes an ExportMetricsServiceRequest holding every metric in
+// the registry.  Counters become sums, gauges gauges, meters a monotonic sum
+// and a gauge per rate, bucket histograms histograms, and histograms and
+// timers summaries or, if their sample is an ExponentialSample, exponential
+// histograms.  Sums and histograms are cumulative unless the registry is a
+// DeltaRegistry.
+func otlpRequest(c *OTLPConfig, now time.Time) []byte {
+	du := float64(c.DurationUnit)
+	if 0 == du {
+		du = 1
+	}
+	ts := uint64(now.UnixNano())
+	temporality := uint64(otlpCumulative)
+	if _, ok := c.Registry.(*DeltaRegistry); ok {
+		temporality = otlpDelta
+	}
+
+	var metrics protoBuffer
+	c.Registry.EachTagged(func(name string, tags Tags, i interface{}) {
+		if "" != c.Prefix {
+			name = c.Prefix + "." + name
+		}
+		// Data points of every kind but exponential histograms keep their
+		// attributes in field 7 and histograms in field 9.
+		point := func(attrs int, start time.Time, f func(*protoBuffer)) func(*protoBuffer) {
+			return func(d *protoBuffer) {
+				for _, k := range tags.Keys() {
+					d.message(attrs, otlpKeyValue(k, tags[k]))
+				}
+				if !start.IsZero() {
+					d.fixed64(2, uint64(start.UnixNano()))
+				}
+				d.fixed64(3, ts)
+				f(d)
+			}
+		}
+		add := func(name, unit string, kind int, f func(*protoBuffer)) {
+			metrics.message(2, func(m *protoBuffer) {
+				m.str(1, name)
+				if "" != unit {
+					m.str(3, unit)
+				}
+				m.message(kind, f)
+			})
+		}
+		gauge := func(name, unit string, v float64) {
+			add(name, unit, 5, func(g *protoBuffer) {
+				g.message(1, point(7, time.Time{}, func(d *protoBuffer) { d.double(4, v) }))
+			})
+		}
+		sum := func(name string, v int64, start time.Time, monotonic bool) {
+			add(name, "", 7, func(s *protoBuffer) {
+				s.message(1, point(7, start, func(d *protoBuffer) { d.fixed64(6, uint64(v)) }))
+				s.varint(2, temporality)
+				if monotonic {
+					s.varint(3, 1)
+				}
+			})
+		}
+		summary := func(unit string, count int64, total float64, ps []float64, div float64) {
+			add(name, unit, 11, func(s *protoBuffer) {
+				s.message(1, point(7, time.Time{}, func(d *protoBuffer) {
+					d.fixed64(4, uint64(count))
+					d.double(5, total/div)
+					for psIdx, psKey := range c.Percentiles {
+						d.message(6, func(q *protoBuffer) {
+							q.double(1, psKey)
+							q.double(2, ps[psIdx]/div)
+						})
+					}
+				}))
+			})
+		}
+		histogram := func(unit string, h Histogram, div float64) {
+			if s, ok := h.Sample().(ExponentialSample); ok {
+				counts := s.ExponentialCounts(div)
+				add(name, unit, 10, func(e *protoBuffer) {
+					e.message(1, func(d *protoBuffer) {
+						for _, k := range tags.Keys() {
+							d.message(1, otlpKeyValue(k, tags[k]))
+						}
+						d.fixed64(3, ts)
+						d.fixed64(4, uint64(h.Count()))
+						d.double(5, float64(h.Sum())/div)
+						d.sint32(6, counts.Scale)
+						d.fixed64(7, uint64(counts.ZeroCount))
+						d.message(8, func(b *protoBuffer) {
+							b.sint32(1, counts.Offset)
+							b.message(2, func(p *protoBuffer) {
+								for _, n := range counts.Counts {
+									p.uvarint(uint64(n))
+								}
+							})
+						})
+						if 0 < h.Count() {
+							d.double(12, float64(h.Min())/div)
+							d.double(13, float64(h.Max())/div)
+						}
+					})
+					e.varint(2, temporality)
+				})
+				return
+			}
+			summary(unit, h.Count(), float64(h.Sum()), h.Percentiles(c.Percentiles), div)
+		}
+		switch metric := i.(type) {
+		case Counter:
+			sum(name, metric.Count(), createdOf(metric), false)
+		case Gauge:
+			add(name, "", 5, func(g *protoBuffer) {
+				g.message(1, point(7, time.Time{}, func(d *protoBuffer) { d.fixed64(6, uint64(metric.Value())) }))
+			})
+		case GaugeFloat64:
+			gauge(name, "", metric.Value())
+		case BucketHistogram:
+			h := metric.Snapshot()
+			buckets := h.Buckets()
+			add(name, "", 9, func(p *protoBuffer) {
+				p.message(1, point(9, time.Time{}, func(d *protoBuffer) {
+					d.fixed64(4, uint64(h.Count()))
+					d.double(5, h.Sum())
+					d.message(6, func(p *protoBuffer) {
+						var last int64
+						for _, b := range buckets {
+							p.fixed(uint64(b.Count - last))
+							last = b.Count
+						}
+					})
+					d.message(7, func(p *protoBuffer) {
+						for _, b := range buckets[:len(buckets)-1] {
+							p.fixed(math.Float64bits(b.UpperBound))
+						}
+					})
+				}))
+				p.varint(2, temporality)
+			})
+		case Histogram:
+			histogram("", metric.Snapshot(), 1)
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			summary("", h.Count(), h.Sum(), h.Percentiles(c.Percentiles), 1)
+		case Meter:
+			m := metric.Snapshot()
+			sum(name, m.Count(), createdOf(m), true)
+			gauge(name+".rate1", "1/s", m.Rate1())
+			gauge(name+".rate5", "1/s", m.Rate5())
+			gauge(name+".rate15", "1/s", m.Rate15())
+			gauge(name+".rate_mean", "1/s", m.RateMean())
+		case Timer:
+			histogram(otlpUnit(time.Duration(du)), timerSnapshot(metric).histogram, du)
+		}
+	})
+
+	attrs := make(Tags, len(c.ResourceAttributes)+1)
+	for k, v := range c.ResourceAttributes {
+		attrs[k] = v
+	}
+	if _, ok := attrs["service.name"]; !ok {
+		attrs["service.name"] = "unknown_service:" + filepath.Base(os.Args[0])
+	}
+	var req protoBuffer
+	req.message(1, func(rm *protoBuffer) {
+		rm.message(1, func(r *protoBuffer) {
+			for _, k := range attrs.Keys() {
+				r.message(1, otlpKeyValue(k, attrs[k]))
+			}
+		})
+		rm.message(2, func(sm *protoBuffer) {
+			sm.message(1, func(s *protoBuffer) { s.str(1, "github.com/rcrowley/go-metrics") })
+			sm.buf = append(sm.buf, metrics.buf...)
+		})
+	})
+	return req.buf
+}
+
+// otlpKeyValue encodes a KeyValue with a string value.
+func otlpKeyValue(k, v string) func(*protoBuffer) {
+	return func(kv *protoBuffer) {
+		kv.str(1, k)
+		kv.message(2, func(value *protoBuffer) { value.str(1, v) })
+	}
+}
+
+// otlpUnit returns the UCUM unit of a duration, or an empty string if it
+// has none.
+func otlpUnit(d time.Duration) string {
+	switch d {
+	case time.Nanosecond:
+		return "ns"
+	case time.Microsecond:
+		return "us"
+	case time.Millisecond:
+		return "ms"
+	case time.Second:
+		return "s"
+	case time.Minute:
+		return "min"
+	case time.Hour:
+		return "h"
+	}
+	return ""
+}
+
+// protoBuffer encodes the few protocol buffer wire types OTLP uses.
+type protoBuffer struct {
+	buf []byte
+}
+
+func (p *protoBuffer) double(field int, v float64) {
+	p.fixed64(field, math.Float64bits(v))
+}
+
+// fixed appends a little-endian 64-bit value without a tag, as packed
+// repeated fields hold them.
+func (p *protoBuffer) fixed(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	p.buf = append(p.buf, b[:]...)
+}
+
+func (p *protoBuffer) fixed64(field int, v uint64) {
+	p.tag(field, 1)
+	p.fixed(v)
+}
+
+// message appends a length-delimited field holding whatever f encodes.
+func (p *protoBuffer) message(field int, f func(*protoBuffer)) {
+	var m protoBuffer
+	f(&m)
+	p.tag(field, 2)
+	p.uvarint(uint64(len(m.buf)))
+	p.buf = append(p.buf, m.buf...)
+}
+
+func (p *protoBuffer) sint32(field int, v int32) {
+	p.varint(field, uint64(uint32(v<<1^v>>31)))
+}
+
+func (p *protoBuffer) str(field int, s string) {
+	p.tag(field, 2)
+	p.uvarint(uint64(len(s)))
+	p.buf = append(p.buf, s...)
+}
+
+func (p *protoBuffer) tag(field, wire int) {
+	p.uvarint(uint64(field)<<3 | uint64(wire))
+}
+
+// uvarint appends a varint without a tag, as packed repeated fields hold
+// them.
+func (p *protoBuffer) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	p.buf = append(p.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (p *protoBuffer) varint(field int, v uint64) {
+	p.tag(field, 0)
+	p.uvarint(v)
+}
+
+var errProtoMalformed = errors.New("otlp: malformed protocol buffer")
+
+// protoFields calls f with the number, wire type and value of each field of
+// an encoded message.  The value is in v for numbers and in data for
+// length-delimited fields.
+func protoFields(b []byte, f func(field, wire int, v uint64, data []byte)) error {
+	for 0 < len(b) {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoMalformed
+		}
+		b = b[n:]
+		var (
+			v    uint64
+			data []byte
+		)
+		field, wire := int(key>>3), int(key&7)
+		switch wire {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errProtoMalformed
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return errProtoMalformed
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errProtoMalformed
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return errProtoMalformed
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return errProtoMalformed
+		}
+		f(field, wire, v, data)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ExampleOTLPWithConfig() {
+	go OTLPWithConfig(OTLPConfig{
+		URL:                "http://localhost:4318/v1/metrics",
+		Registry:           DefaultRegistry,
+		FlushInterval:      10 * time.Second,
+		DurationUnit:       time.Second,
+		Percentiles:        []float64{0.5, 0.99},
+		ResourceAttributes: Tags{"service.name": "api", "deployment.environment": "production"},
+		Gzip:               true,
+	})
+}
+
+// protoTree is a decoded message: the values of each field, by number.
+type protoTree map[int][]protoValue
+
+type protoValue struct {
+	v    uint64
+	data []byte
+}
+
+func decodeProto(t *testing.T, b []byte) protoTree {
+	m := make(protoTree)
+	err := protoFields(b, func(field, wire int, v uint64, data []byte) {
+		m[field] = append(m[field], protoValue{v, data})
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func (m protoTree) msgs(t *testing.T, field int) []protoTree {
+	var msgs []protoTree
+	for _, v := range m[field] {
+		msgs = append(msgs, decodeProto(t, v.data))
+	}
+	return msgs
+}
+
+func (m protoTree) msg(t *testing.T, field int) protoTree {
+	if 0 == len(m[field]) {
+		t.Fatalf("no field %d in %v", field, m)
+	}
+	return decodeProto(t, m[field][0].data)
+}
+
+// m returns the bytes of a length-delimited field.
+func (m protoTree) m(field int) []byte {
+	if 0 == len(m[field]) {
+		return nil
+	}
+	return m[field][0].data
+}
+
+func (m protoTree) num(field int) uint64 {
+	if 0 == len(m[field]) {
+		return 0
+	}
+	return m[field][0].v
+}
+
+func (m protoTree) double(field int) float64 {
+	return math.Float64frombits(m.num(field))
+}
+
+func (m protoTree) str(field int) string {
+	if 0 == len(m[field]) {
+		return ""
+	}
+	return string(m[field][0].data)
+}
+
+// attrs decodes the KeyValues with string values in a field.
+func (m protoTree) attrs(t *testing.T, field int) Tags {
+	tags := make(Tags)
+	for _, kv := range m.msgs(t, field) {
+		tags[kv.str(1)] = kv.msg(t, 2).str(1)
+	}
+	return tags
+}
+
+func otlpServer(t *testing.T, requests chan<- protoTree, status int, response []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ct := req.Header.Get("Content-Type"); "application/x-protobuf" != ct {
+			t.Error(ct)
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if nil != err {
+			t.Error(err)
+		}
+		if "gzip" == req.Header.Get("Content-Encoding") {
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if nil == err {
+				body, err = ioutil.ReadAll(gz)
+			}
+			if nil != err {
+				t.Error(err)
+			}
+		}
+		if nil != requests {
+			requests <- decodeProto(t, body)
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(status)
+		w.Write(response)
+	}))
+}
+
+func TestOTLP(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterTagged("requests", Tags{"status": "200"}, NewCounter())
+	r.GetTagged("requests", Tags{"status": "200"}).(Counter).Inc(3)
+	NewRegisteredGauge("queue", r).Update(7)
+	NewRegisteredGaugeFloat64("load", r).Update(1.5)
+	m := NewRegisteredMeter("events", r)
+	defer m.Stop()
+	m.Mark(2)
+	tm := NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(2 * time.Second)
+	h := NewRegisteredHistogram("size", r, NewHDRSample(1, 1000000, 3))
+	h.Update(0)
+	h.Update(1000)
+	b := NewRegisteredBucketHistogram("bytes", r, []float64{1, 10})
+	b.Update(0.5)
+	b.Update(5)
+	b.Update(50)
+
+	requests := make(chan protoTree, 1)
+	s := otlpServer(t, requests, http.StatusOK, nil)
+	defer s.Close()
+	err := OTLPOnce(OTLPConfig{
+		URL:                s.URL,
+		Registry:           r,
+		DurationUnit:       time.Second,
+		Prefix:             "app",
+		Percentiles:        []float64{0.5},
+		ResourceAttributes: Tags{"service.name": "api"},
+		Headers:            map[string]string{"Authorization": "Bearer token"},
+		Gzip:               true,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	rm := (<-requests).msg(t, 1)
+	if attrs := rm.msg(t, 1).attrs(t, 1); "api" != attrs["service.name"] {
+		t.Error(attrs)
+	}
+	sm := rm.msg(t, 2)
+	if scope := sm.msg(t, 1).str(1); "github.com/rcrowley/go-metrics" != scope {
+		t.Error(scope)
+	}
+	metrics := make(map[string]protoTree)
+	for _, m := range sm.msgs(t, 2) {
+		metrics[m.str(1)] = m
+	}
+	if 11 != len(metrics) {
+		t.Errorf("metrics: 11 != %v\n", len(metrics))
+	}
+
+	sum := metrics["app.requests"].msg(t, 7)
+	dp := sum.msg(t, 1)
+	if attrs := dp.attrs(t, 7); "200" != attrs["status"] {
+		t.Error(attrs)
+	}
+	if 3 != dp.num(6) || 0 == dp.num(2) || otlpCumulative != sum.num(2) || 0 != sum.num(3) {
+		t.Errorf("app.requests: %v, %v\n", sum, dp)
+	}
+	if v := metrics["app.queue"].msg(t, 5).msg(t, 1).num(6); 7 != v {
+		t.Errorf("app.queue: 7 != %v\n", v)
+	}
+	if v := metrics["app.load"].msg(t, 5).msg(t, 1).double(4); 1.5 != v {
+		t.Errorf("app.load: 1.5 != %v\n", v)
+	}
+
+	sum = metrics["app.events"].msg(t, 7)
+	if v := sum.msg(t, 1).num(6); 2 != v || 1 != sum.num(3) {
+		t.Errorf("app.events: %v\n", sum)
+	}
+	if unit := metrics["app.events.rate1"].str(3); "1/s" != unit {
+		t.Errorf("app.events.rate1 unit: %q\n", unit)
+	}
+
+	if unit := metrics["app.latency"].str(3); "s" != unit {
+		t.Errorf("app.latency unit: %q\n", unit)
+	}
+	dp = metrics["app.latency"].msg(t, 11).msg(t, 1)
+	q := dp.msg(t, 6)
+	if 1 != dp.num(4) || 2 != dp.double(5) || 0.5 != q.double(1) || 2 != q.double(2) {
+		t.Errorf("app.latency: %v, %v\n", dp, q)
+	}
+
+	eh := metrics["app.size"].msg(t, 10)
+	dp = eh.msg(t, 1)
+	if 2 != dp.num(4) || 1000 != dp.double(5) || 1 != dp.num(7) || 1000 != dp.double(13) {
+		t.Errorf("app.size: %v\n", dp)
+	}
+	if scale := int32(dp.num(6)>>1) ^ -int32(dp.num(6)&1); 9 != scale {
+		t.Errorf("app.size scale: 9 != %v\n", scale)
+	}
+	var n uint64
+	for data := dp.msg(t, 8).m(2); 0 < len(data); {
+		v, l := binary.Uvarint(data)
+		n, data = n+v, data[l:]
+	}
+	if 1 != n || otlpCumulative != eh.num(2) {
+		t.Errorf("app.size positive count: 1 != %v\n", n)
+	}
+
+	dp = metrics["app.bytes"].msg(t, 9).msg(t, 1)
+	var counts, bounds []float64
+	for data := dp.m(6); 0 < len(data); data = data[8:] {
+		counts = append(counts, float64(binary.LittleEndian.Uint64(data)))
+	}
+	for data := dp.m(7); 0 < len(data); data = data[8:] {
+		bounds = append(bounds, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+	}
+	if 3 != dp.num(4) || 55.5 != dp.double(5) || 3 != len(counts) || 1 != counts[0] || 1 != counts[1] || 1 != counts[2] || 2 != len(bounds) || 10 != bounds[1] {
+		t.Errorf("app.bytes: %v, %v, %v\n", dp, counts, bounds)
+	}
+}
+
+func TestOTLPDelta(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(1)
+	c := OTLPConfig{Registry: NewDeltaRegistry(r)}
+	m := decodeProto(t, otlpRequest(&c, time.Now())).msg(t, 1).msg(t, 2).msg(t, 2)
+	if temporality := m.msg(t, 7).num(2); otlpDelta != temporality {
+		t.Errorf("temporality: %v != %v\n", otlpDelta, temporality)
+	}
+	if attrs := decodeProto(t, otlpRequest(&c, time.Now())).msg(t, 1).msg(t, 1).attrs(t, 1); "" == attrs["service.name"] {
+		t.Error(attrs)
+	}
+}
+
+func TestOTLPError(t *testing.T) {
+	var status protoBuffer
+	status.varint(1, 3)
+	status.str(2, "invalid metric")
+	s := otlpServer(t, nil, http.StatusBadRequest, status.buf)
+	defer s.Close()
+	err := OTLPOnce(OTLPConfig{URL: s.URL, Registry: NewRegistry()})
+	if e, ok := err.(*OTLPError); !ok || http.StatusBadRequest != e.StatusCode || "invalid metric" != e.Message {
+		t.Fatal(err)
+	}
+}
+
+func TestOTLPPartialSuccess(t *testing.T) {
+	var resp protoBuffer
+	resp.message(1, func(p *protoBuffer) {
+		p.varint(1, 2)
+		p.str(2, "out of order")
+	})
+	s := otlpServer(t, nil, http.StatusOK, resp.buf)
+	defer s.Close()
+	err := OTLPOnce(OTLPConfig{URL: s.URL, Registry: NewRegistry()})
+	if e, ok := err.(*OTLPError); !ok || 2 != e.Rejected || "otlp: 2 datapoints rejected: out of order" != e.Error() {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store holds the checkpoints of a PersistentRegistry.
+type Store interface {
+
+	// Load returns the last checkpoint saved, or nil if there is none.
+	Load() ([]byte, error)
+
+	// Save replaces the last checkpoint.
+	Save([]byte) error
+}
+
+// FileStore is a Store which keeps checkpoints in the named file.  Save
+// writes a temporary file in the same directory and renames it over the
+// file, so that a crash never leaves a partial checkpoint behind.
+type FileStore string
+
+// Load reads the file, returning nil if it doesn't exist.
+func (f FileStore) Load() ([]byte, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Save atomically replaces the file.
+func (f FileStore) Save(b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(string(f)), filepath.Base(string(f))+".tmp")
+	if nil != err {
+		return err
+	}
+	if _, err = tmp.Write(b); nil == err {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); nil == err {
+		err = closeErr
+	}
+	if nil == err {
+		err = os.Rename(tmp.Name(), string(f))
+	}
+	if nil != err {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// PersistentRegistry wraps a Registry so that the state of its metrics
+// survives restarts.  Checkpoint saves the counts and creation times of
+// counters and meters, the samples of histograms whose sample is a
+// UniformSample, an ExpDecaySample, an HDRSample or a TDigestSample, and both
+// of timers built from those.  Other metrics and samples aren't persisted.
+//
+// The last checkpoint is loaded when the registry is constructed and each
+// metric's state is restored as it is registered, or at the next checkpoint
+// if it was registered with the wrapped registry directly.  Counts, and the
+// buckets and centroids of HDR and t-digest samples, are added to whatever
+// was counted in the meantime, while a reservoir is only restored if nothing
+// has been sampled yet.  HDR buckets are only restored into a sample with the
+// same bounds and precision.
+type PersistentRegistry struct {
+	Registry
+	store   Store
+	pending map[string]*persistedState
+	mutex   sync.Mutex
+}
+
+// NewPersistentRegistry constructs a new PersistentRegistry which saves the
+// state of the metrics in r to s, restoring any metric already registered
+// from the last checkpoint in s.
+func NewPersistentRegistry(r Registry, s Store) (*PersistentRegistry, error) {
+	b, err := s.Load()
+	if nil != err {
+		return nil, err
+	}
+	pending := make(map[string]*persistedState)
+	if 0 < len(b) {
+		if err := json.Unmarshal(b, &pending); nil != err {
+			return nil, err
+		}
+	}
+	p := &PersistentRegistry{Registry: r, store: s, pending: pending}
+	r.EachTagged(func(name string, tags Tags, i interface{}) {
+		p.restore(MetricID{name, tags}.String(), i)
+	})
+	return p, nil
+}
+
+// Checkpoint saves the state of every persisted metric to the store, along
+// with the state loaded for metrics which haven't been registered since.
+func (r *PersistentRegistry) Checkpoint() error {
+	states := make(map[string]*persistedState)
+	r.Registry.EachTagged(func(name string, tags Tags, i interface{}) {
+		id := MetricID{name, tags}.String()
+		r.restore(id, i)
+		if s := checkpoint(i); nil != s {
+			states[id] = s
+		}
+	})
+	r.mutex.Lock()
+	for id, s := range r.pending {
+		if _, ok := states[id]; !ok {
+			states[id] = s
+		}
+	}
+	r.mutex.Unlock()
+	b, err := json.Marshal(states)
+	if nil != err {
+		return err
+	}
+	return r.store.Save(b)
+}
+
+// Gets an existing metric or registers the given one, restoring its state
+// from the last checkpoint.
+func (r *PersistentRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	return r.GetOrRegisterTagged(name, nil, i)
+}
+
+// Gets an existing metric with the given tags or registers the given one,
+// restoring its state from the last checkpoint.
+func (r *PersistentRegistry) GetOrRegisterTagged(name string, tags Tags, i interface{}) interface{} {
+	i = r.Registry.GetOrRegisterTagged(name, tags, i)
+	if nil != i {
+		r.restore(MetricID{name, tags}.String(), i)
+	}
+	return i
+}
+
+// Register the given metric under the given name, restoring its state from
+// the last checkpoint.
+func (r *PersistentRegistry) Register(name string, i interface{}) error {
+	return r.RegisterTagged(name, nil, i)
+}
+
+// Register the given metric under the given name and tags, restoring its
+// state from the last checkpoint.
+func (r *PersistentRegistry) RegisterTagged(name string, tags Tags, i interface{}) error {
+	if err := r.Registry.RegisterTagged(name, tags, i); nil != err {
+		return err
+	}
+	r.restore(MetricID{name, tags}.String(), i)
+	return nil
+}
+
+// restore restores the state loaded for the named metric, if it hasn't been
+// already.
+func (r *PersistentRegistry) restore(id string, i interface{}) {
+	p, ok := i.(persistent)
+	if !ok {
+		return
+	}
+	r.mutex.Lock()
+	s, ok := r.pending[id]
+	delete(r.pending, id)
+	r.mutex.Unlock()
+	if ok && persistedKind(i) == s.Kind {
+		p.restore(s)
+	}
+}
+
+// Persist checkpoints the metrics in r every d duration.
+func Persist(r *PersistentRegistry, d time.Duration) {
+	PersistContext(context.Background(), r, d, nil)
+}
+
+// PersistContext is just like Persist, but it returns after a final
+// checkpoint once ctx is done and passes each failed checkpoint to onError
+// instead of logging it.
+func PersistContext(ctx context.Context, r *PersistentRegistry, d time.Duration, onError func(error)) {
+	RunReporter(ctx, d, r.Checkpoint, onError)
+}
+
+// persistent is implemented by the metrics and samples whose state a
+// PersistentRegistry saves.
+type persistent interface {
+	checkpoint() *persistedState
+	restore(*persistedState)
+}
+
+// persistedState is the saved state of a metric or a sample.
+type persistedState struct {
+	Kind       string          `json:"kind,omitempty"`
+	Count      int64           `json:"count"`
+	Start      time.Time       `json:"start"` // When a counter or meter was created or an ExpDecaySample last rescaled
+	Values     []int64         `json:"values,omitempty"`
+	Priorities []float64       `json:"priorities,omitempty"` // Of each of an ExpDecaySample's values
+	Digest     *Digest         `json:"digest,omitempty"`     // Of a TDigestSample
+	HDR        *persistedHDR   `json:"hdr,omitempty"`        // Of an HDRSample
+	Sample     *persistedState `json:"sample,omitempty"`
+}
+
+// persistedHDR is the saved state of an HDRSample: the index and count of
+// each of its non-empty buckets along with its exact statistics.
+type persistedHDR struct {
+	Layout  [3]int  `json:"layout"` // Which must match for the counts to be restored
+	Indexes []int   `json:"indexes"`
+	Counts  []int64 `json:"counts"`
+	Sum     int64   `json:"sum"`
+	Min     int64   `json:"min"`
+	Max     int64   `json:"max"`
+	Mean    float64 `json:"mean"`
+	M2      float64 `json:"m2"` // Sum of the squared differences from the mean
+}
+
+// checkpoint returns the state of a metric or nil if it isn't persisted.
+func checkpoint(i interface{}) *persistedState {
+	p, ok := i.(persistent)
+	if !ok {
+		return nil
+	}
+	s := p.checkpoint()
+	if nil != s {
+		s.Kind = persistedKind(i)
+	}
+	return s
+}
+
+// persistedKind names the type of a metric so that a metric which changed
+// type between restarts isn't restored.
+func persistedKind(i interface{}) string {
+	switch i.(type) {
+	case Counter:
+		return "counter"
+	case Histogram:
+		return "histogram"
+	case Meter:
+		return "meter"
+	case Timer:
+		return "timer"
+	}
+	return ""
+}
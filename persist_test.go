@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func ExamplePersist() {
+	r, err := NewPersistentRegistry(DefaultRegistry, FileStore("/var/lib/app/metrics.json"))
+	if nil != err {
+		panic(err)
+	}
+	go Persist(r, time.Minute)
+	GetOrRegisterCounter("orders", r).Inc(1)
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := FileStore(filepath.Join(dir, "metrics.json"))
+	if b, err := s.Load(); nil != err || nil != b {
+		t.Fatal(b, err)
+	}
+	for _, data := range []string{"first", "second"} {
+		if err := s.Save([]byte(data)); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if b, err := s.Load(); nil != err || "second" != string(b) {
+		t.Fatal(string(b), err)
+	}
+	if files, _ := ioutil.ReadDir(dir); 1 != len(files) {
+		t.Errorf("files: 1 != %v\n", len(files))
+	}
+}
+
+func TestPersistentRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := FileStore(filepath.Join(dir, "metrics.json"))
+
+	r, err := NewPersistentRegistry(NewRegistry(), store)
+	if nil != err {
+		t.Fatal(err)
+	}
+	c := NewCounter()
+	r.RegisterTagged("orders", Tags{"region": "eu"}, c)
+	c.Inc(47)
+	created := createdOf(c)
+	m := NewRegisteredMeter("events", r)
+	defer m.Stop()
+	m.Mark(3)
+	tm := NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(time.Second)
+	NewRegisteredHistogram("uniform", r, NewUniformSample(10)).Update(5)
+	h := NewRegisteredHistogram("decay", r, NewExpDecaySample(10, 0.015))
+	for i := int64(1); i <= 20; i++ {
+		h.Update(i)
+	}
+	NewRegisteredCounter("unused", r).Inc(2)
+	if err := r.Checkpoint(); nil != err {
+		t.Fatal(err)
+	}
+
+	r2 := NewRegistry()
+	NewRegisteredCounter("unused", r2)
+	p, err := NewPersistentRegistry(r2, store)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if c := r2.Get("unused").(Counter); 2 != c.Count() {
+		t.Errorf("unused: 2 != %v\n", c.Count())
+	}
+	c = NewCounter()
+	c.Inc(1)
+	p.RegisterTagged("orders", Tags{"region": "eu"}, c)
+	if 48 != c.Count() || !createdOf(c).Equal(created) {
+		t.Errorf("orders: %v, %v != %v\n", c.Count(), createdOf(c), created)
+	}
+	m = GetOrRegisterMeter("events", p)
+	defer m.Stop()
+	if 3 != m.Count() || 0 != m.Rate1() {
+		t.Errorf("events: %v, %v\n", m.Count(), m.Rate1())
+	}
+	tm = GetOrRegisterTimer("latency", p)
+	defer tm.Stop()
+	if 1 != tm.Count() || int64(time.Second) != tm.Max() {
+		t.Errorf("latency: %v, %v\n", tm.Count(), tm.Max())
+	}
+	if h := GetOrRegisterHistogram("uniform", p, NewUniformSample(10)); 1 != h.Count() || 5 != h.Max() {
+		t.Errorf("uniform: %v, %v\n", h.Count(), h.Max())
+	}
+	h = GetOrRegisterHistogram("decay", p, NewExpDecaySample(10, 0.015))
+	if 20 != h.Count() || 10 != h.Sample().Size() {
+		t.Errorf("decay: %v, %v\n", h.Count(), h.Sample().Size())
+	}
+	h.Update(100)
+	if 21 != h.Count() || 100 != h.Max() {
+		t.Errorf("decay: %v, %v\n", h.Count(), h.Max())
+	}
+	if c := GetOrRegisterCounter("orders", p); 0 != c.Count() {
+		t.Errorf("untagged orders: 0 != %v\n", c.Count())
+	}
+}
+
+func TestPersistentRegistryPending(t *testing.T) {
+	store := &memoryStore{}
+	r, _ := NewPersistentRegistry(NewRegistry(), store)
+	NewRegisteredCounter("orders", r).Inc(5)
+	NewRegisteredCounter("refunds", r).Inc(1)
+	if err := r.Checkpoint(); nil != err {
+		t.Fatal(err)
+	}
+
+	// Checkpoints keep the state of metrics which haven't been registered
+	// again, and metrics which changed type aren't restored.
+	r, _ = NewPersistentRegistry(NewRegistry(), store)
+	m := NewRegisteredMeter("refunds", r)
+	defer m.Stop()
+	if err := r.Checkpoint(); nil != err {
+		t.Fatal(err)
+	}
+	if 0 != m.Count() {
+		t.Errorf("refunds: 0 != %v\n", m.Count())
+	}
+	r, _ = NewPersistentRegistry(NewRegistry(), store)
+	if c := GetOrRegisterCounter("orders", r); 5 != c.Count() {
+		t.Errorf("orders: 5 != %v\n", c.Count())
+	}
+}
+
+func TestPersistentRegistrySamples(t *testing.T) {
+	store := &memoryStore{}
+	r, _ := NewPersistentRegistry(NewRegistry(), store)
+	hdr := NewRegisteredHistogram("hdr", r, NewHDRSample(1, 1000000, 3))
+	td := NewRegisteredHistogram("tdigest", r, NewTDigestSample(100))
+	for i := int64(1); i <= 1000; i++ {
+		hdr.Update(i)
+		td.Update(i)
+	}
+	NewRegisteredHistogram("changed", r, NewHDRSample(1, 1000000, 3)).Update(5)
+	if err := r.Checkpoint(); nil != err {
+		t.Fatal(err)
+	}
+
+	r, _ = NewPersistentRegistry(NewRegistry(), store)
+	for _, name := range []string{"hdr", "tdigest"} {
+		var s Sample = NewHDRSample(1, 1000000, 3)
+		if "tdigest" == name {
+			s = NewTDigestSample(100)
+		}
+		s.Update(2000)
+		h := GetOrRegisterHistogram(name, r, s)
+		if count, min, max, sum := h.Count(), h.Min(), h.Max(), h.Sum(); 1001 != count || 1 != min || 2000 != max || 502500 != sum {
+			t.Errorf("%s: %v, %v, %v, %v\n", name, count, min, max, sum)
+		}
+		if p50 := h.Percentile(0.5); math.Abs(500-p50) > 2 {
+			t.Errorf("%s: p50: %v\n", name, p50)
+		}
+	}
+	if h := GetOrRegisterHistogram("changed", r, NewHDRSample(1, 1000, 3)); 0 != h.Count() {
+		t.Errorf("changed: 0 != %v\n", h.Count())
+	}
+}
+
+type memoryStore struct {
+	b []byte
+}
+
+func (s *memoryStore) Load() ([]byte, error) { return s.b, nil }
+
+func (s *memoryStore) Save(b []byte) error {
+	s.b = b
+	return nil
+}
@@ -0,0 +1,398 @@
+// Serve go-metrics in the Prometheus text exposition format
+// <https://prometheus.io/docs/instrumenting/exposition_formats/> or in the
+// OpenMetrics text format <https://openmetrics.io/>
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// OpenMetricsContentType is the content type of the OpenMetrics text format.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Config provides a container with configuration parameters for the
+// Prometheus handler
+type Config struct {
+	Registry  metrics.Registry  // Registry to be exported
+	Namespace string            // Prefix to be prepended to metric names
+	Quantiles []float64         // Quantiles to export from timers and histograms
+	Units     map[string]string // Units of metrics by name, appended to their names
+}
+
+// Handler returns an http.Handler which serves the metrics in r in the
+// Prometheus text exposition format.
+func Handler(r metrics.Registry) http.Handler {
+	return HandlerWithConfig(Config{
+		Registry:  r,
+		Quantiles: []float64{0.5, 0.75, 0.95, 0.99, 0.999},
+	})
+}
+
+// HandlerWithConfig is just like Handler, but it takes a Config instead.
+func HandlerWithConfig(c Config) http.Handler {
+	return handler(c, Write, ContentType)
+}
+
+// OpenMetricsHandler returns an http.Handler which serves the metrics in r in
+// the OpenMetrics text format.
+func OpenMetricsHandler(r metrics.Registry) http.Handler {
+	return OpenMetricsHandlerWithConfig(Config{
+		Registry:  r,
+		Quantiles: []float64{0.5, 0.75, 0.95, 0.99, 0.999},
+	})
+}
+
+// OpenMetricsHandlerWithConfig is just like OpenMetricsHandler, but it takes
+// a Config instead.
+func OpenMetricsHandlerWithConfig(c Config) http.Handler {
+	return handler(c, WriteOpenMetrics, OpenMetricsContentType)
+}
+
+func handler(c Config, write func(io.Writer, Config) error, contentType string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b bytes.Buffer
+		if err := write(&b, c); nil != err {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		b.WriteTo(w)
+	})
+}
+
+// Write writes every metric in the configured registry to w in the
+// Prometheus text exposition format.
+//
+// Counters become counters suffixed with _total, gauges stay gauges, meters
+// become a _total counter plus one gauge per rate, bucket histograms become
+// histograms, and histograms and timers become summaries.  Timers are
+// reported in seconds and suffixed with _seconds, and metrics with a
+// configured unit are suffixed with it.  Tags become labels.
+//
+// It returns an error, without writing anything, if two metrics of different
+// types are given the same name or if the name of one is among the samples of
+// another, such as a gauge foo_total alongside a counter foo, or if two
+// metrics are given the same name and labels.
+func Write(w io.Writer, c Config) error {
+	return write(w, c, false)
+}
+
+// WriteOpenMetrics writes every metric in the configured registry to w in
+// the OpenMetrics text format, with the same names as Write.
+//
+// Beyond what Write does, units are declared, counters and meters are given
+// a _created sample from the time they were constructed or last cleared, and
+// the output is terminated with # EOF.
+//
+// OpenMetrics only allows exemplars on counters and histogram buckets, so
+// each Histogram and Timer which has recorded an exemplar with
+// UpdateWithExemplar is also given a counter of its observations, and the
+// last exemplar is attached to that.  The counter is named after the metric,
+// before any unit is appended, followed by _observations: a timer latency
+// gives latency_seconds and latency_observations.  As with any other
+// conflict, an error is returned if a metric of that name and the same tags
+// is registered as well.
+func WriteOpenMetrics(w io.Writer, c Config) error {
+	return write(w, c, true)
+}
+
+func write(w io.Writer, c Config, openMetrics bool) error {
+	families := make(map[string]*family)
+	owners := make(map[string]*family) // By the names of their samples
+	var err error
+	addSeries := func(name, typ, unit string, s series) {
+		f := families[name]
+		if nil == f {
+			for _, suffix := range sampleSuffixes[typ] {
+				if f = owners[name+suffix]; nil != f {
+					break
+				}
+			}
+		}
+		if nil == f {
+			f = &family{name: name, typ: typ}
+			if "" != unit && strings.HasSuffix(name, "_"+unit) {
+				f.unit = unit
+			}
+			families[name] = f
+			for _, suffix := range sampleSuffixes[typ] {
+				owners[name+suffix] = f
+			}
+		}
+		if typ != f.typ || name != f.name {
+			if nil == err {
+				err = fmt.Errorf("prometheus: %s %s conflicts with %s %s", typ, name, f.typ, f.name)
+			}
+			return
+		}
+		f.series = append(f.series, s)
+	}
+	add := func(name, typ, labels string, value float64) {
+		addSeries(name, typ, "", series{labels, []sample{{name, "", value, ""}}})
+	}
+	addCounter := func(name, unit, labels string, count float64, created time.Time, e *metrics.Exemplar, scale float64) {
+		samples := []sample{{name + "_total", "", count, ""}}
+		if openMetrics {
+			samples[0].exemplar = exemplar(e, scale)
+			if !created.IsZero() {
+				samples = append(samples, sample{name + "_created", "", timestamp(created), ""})
+			}
+		}
+		addSeries(name, "counter", unit, series{labels, samples})
+	}
+	c.Registry.EachTagged(func(name string, tags metrics.Tags, i interface{}) {
+		unit := c.Units[name]
+		base := Name(c.Namespace, name)
+		name = base
+		if "" != unit && !strings.HasSuffix(name, "_"+unit) {
+			name += "_" + unit
+		}
+		labels := labelPairs(tags)
+		switch metric := i.(type) {
+		case metrics.Counter:
+			addCounter(name, unit, labels, float64(metric.Count()), createdOf(metric), nil, 1)
+		case metrics.Gauge:
+			addSeries(name, "gauge", unit, series{labels, []sample{{name, "", float64(metric.Value()), ""}}})
+		case metrics.GaugeFloat64:
+			addSeries(name, "gauge", unit, series{labels, []sample{{name, "", metric.Value(), ""}}})
+		case metrics.BucketHistogram:
+			h := metric.Snapshot()
+			buckets := h.Buckets()
+			samples := make([]sample, 0, len(buckets)+2)
+			for _, b := range buckets {
+				samples = append(samples, sample{name + "_bucket", `le="` + formatFloat(b.UpperBound) + `"`, float64(b.Count), ""})
+			}
+			samples = append(samples,
+				sample{name + "_sum", "", h.Sum(), ""},
+				sample{name + "_count", "", float64(h.Count()), ""},
+			)
+			addSeries(name, "histogram", unit, series{labels, samples})
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			ps := h.Percentiles(c.Quantiles)
+			addSeries(name, "summary", unit, summary(name, labels, c.Quantiles, ps, float64(h.Sum()), h.Count(), 1))
+			if e := exemplarOf(h); openMetrics && nil != e {
+				addCounter(base+"_observations", "", labels, float64(h.Count()), time.Time{}, e, 1)
+			}
+		case metrics.HistogramFloat64:
+			h := metric.Snapshot()
+			ps := h.Percentiles(c.Quantiles)
+			addSeries(name, "summary", unit, summary(name, labels, c.Quantiles, ps, h.Sum(), h.Count(), 1))
+		case metrics.Meter:
+			m := metric.Snapshot()
+			addCounter(name, unit, labels, float64(m.Count()), createdOf(m), nil, 1)
+			add(name+"_rate1", "gauge", labels, m.Rate1())
+			add(name+"_rate5", "gauge", labels, m.Rate5())
+			add(name+"_rate15", "gauge", labels, m.Rate15())
+			add(name+"_rate_mean", "gauge", labels, m.RateMean())
+		case metrics.Timer:
+			t := metric.Snapshot()
+			ps := t.Percentiles(c.Quantiles)
+			addSeries(base+"_seconds", "summary", "seconds", summary(base+"_seconds", labels, c.Quantiles, ps, float64(t.Sum()), t.Count(), float64(time.Second)))
+			if e := exemplarOf(t); openMetrics && nil != e {
+				addCounter(base+"_observations", "", labels, float64(t.Count()), time.Time{}, e, float64(time.Second))
+			}
+		}
+	})
+
+	if nil != err {
+		return err
+	}
+	names := make([]string, 0, len(families))
+	for name, f := range families {
+		names = append(names, name)
+		sort.Sort(byLabels(f.series))
+		for i := 1; i < len(f.series); i++ {
+			if f.series[i-1].labels == f.series[i].labels {
+				return fmt.Errorf("prometheus: duplicate %s %s{%s}", f.typ, name, f.series[i].labels)
+			}
+		}
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		families[name].write(bw, openMetrics)
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// Name returns a valid Prometheus metric name made from the namespace and
+// the go-metrics name, replacing every disallowed character with an
+// underscore.
+func Name(namespace, name string) string {
+	if "" != namespace {
+		name = namespace + "_" + name
+	}
+	return sanitize(name, true)
+}
+
+func sanitize(name string, colons bool) string {
+	b := []byte(name)
+	for i, c := range b {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || '_' == c || colons && ':' == c {
+			continue
+		}
+		b[i] = '_'
+	}
+	if 0 < len(b) && '0' <= b[0] && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelPairs renders tags as a comma-separated list of label pairs in sorted
+// key order, without the surrounding braces.
+func labelPairs(tags metrics.Tags) string {
+	pairs := make([]string, 0, len(tags))
+	for _, k := range tags.Keys() {
+		pairs = append(pairs, sanitize(k, false)+`="`+labelValueReplacer.Replace(tags[k])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// timestamp formats a time as seconds since the epoch, as OpenMetrics wants.
+func timestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// createdOf returns the time a counter or meter was constructed or last
+// cleared, or the zero time if it doesn't record one.
+func createdOf(i interface{}) time.Time {
+	if c, ok := i.(interface {
+		Created() time.Time
+	}); ok {
+		return c.Created()
+	}
+	return time.Time{}
+}
+
+// exemplarOf returns the last exemplar of a histogram or timer, or nil if it
+// doesn't record them.
+func exemplarOf(i interface{}) *metrics.Exemplar {
+	if e, ok := i.(interface {
+		Exemplar() *metrics.Exemplar
+	}); ok {
+		return e.Exemplar()
+	}
+	return nil
+}
+
+// exemplar renders an exemplar with its value divided by scale.  It returns
+// an empty string if there isn't one or if its labels are longer than the 128
+// characters OpenMetrics allows.
+func exemplar(e *metrics.Exemplar, scale float64) string {
+	if nil == e {
+		return ""
+	}
+	n := 0
+	for k, v := range e.Labels {
+		n += utf8.RuneCountInString(k) + utf8.RuneCountInString(v)
+	}
+	if 128 < n {
+		return ""
+	}
+	return " # {" + labelPairs(e.Labels) + "} " + formatFloat(e.Value/scale) + " " + strconv.FormatFloat(timestamp(e.Timestamp), 'f', -1, 64)
+}
+
+// summary builds the quantile, _sum and _count samples of a summary, dividing
+// the quantiles and the sum by scale.
+func summary(name, labels string, qs, ps []float64, sum float64, count int64, scale float64) series {
+	samples := make([]sample, 0, len(qs)+2)
+	for i, q := range qs {
+		samples = append(samples, sample{name, `quantile="` + formatFloat(q) + `"`, ps[i] / scale, ""})
+	}
+	samples = append(samples,
+		sample{name + "_sum", "", sum / scale, ""},
+		sample{name + "_count", "", float64(count), ""},
+	)
+	return series{labels, samples}
+}
+
+// sampleSuffixes are appended to the name of a family of each type to name
+// its samples.
+var sampleSuffixes = map[string][]string{
+	"counter":   {"", "_total", "_created"},
+	"gauge":     {""},
+	"histogram": {"", "_bucket", "_sum", "_count", "_created"},
+	"summary":   {"", "_sum", "_count", "_created"},
+}
+
+// family is every series which share a metric name, type and unit.  The
+// name of a counter family lacks the _total suffix of its samples, as in
+// OpenMetrics.
+type family struct {
+	name, typ, unit string
+	series          []series
+}
+
+// series is the samples of a single registered metric.
+type series struct {
+	labels  string
+	samples []sample
+}
+
+// sample is a single line of output.  The label, if any, is added to those
+// of the series, and the exemplar, if any, is rendered already.
+type sample struct {
+	name, label string
+	value       float64
+	exemplar    string
+}
+
+func (f *family) write(w *bufio.Writer, openMetrics bool) {
+	if openMetrics {
+		w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		if "" != f.unit {
+			w.WriteString("# UNIT " + f.name + " " + f.unit + "\n")
+		}
+	} else if "counter" == f.typ {
+		w.WriteString("# TYPE " + f.name + "_total counter\n")
+	} else {
+		w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+	}
+	for _, s := range f.series {
+		for _, smp := range s.samples {
+			w.WriteString(smp.name)
+			labels := s.labels
+			if "" != smp.label {
+				if "" != labels {
+					labels += ","
+				}
+				labels += smp.label
+			}
+			if "" != labels {
+				w.WriteString("{" + labels + "}")
+			}
+			w.WriteString(" " + formatFloat(smp.value) + smp.exemplar + "\n")
+		}
+	}
+}
+
+type byLabels []series
+
+func (s byLabels) Len() int           { return len(s) }
+func (s byLabels) Less(i, j int) bool { return s[i].labels < s[j].labels }
+func (s byLabels) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
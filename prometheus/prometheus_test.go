@@ -0,0 +1,232 @@
+package prometheus
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWrite(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("requests", r).Inc(3)
+	r.RegisterTagged("requests", metrics.Tags{"status": "500", "method": `GE"T`}, metrics.NewCounter())
+	metrics.NewRegisteredGaugeFloat64("load.avg", r).Update(1.5)
+	h := metrics.NewRegisteredHistogram("size", r, metrics.NewUniformSample(100))
+	h.Update(1)
+	h.Update(3)
+	tm := metrics.NewRegisteredTimer("latency", r)
+	tm.Update(2 * time.Second)
+	b := &bytes.Buffer{}
+	if err := Write(b, Config{Registry: r, Namespace: "app", Quantiles: []float64{0.5}}); nil != err {
+		t.Fatal(err)
+	}
+	expected := `# TYPE app_latency_seconds summary
+app_latency_seconds{quantile="0.5"} 2
+app_latency_seconds_sum 2
+app_latency_seconds_count 1
+# TYPE app_load_avg gauge
+app_load_avg 1.5
+# TYPE app_requests_total counter
+app_requests_total 3
+app_requests_total{method="GE\"T",status="500"} 0
+# TYPE app_size summary
+app_size{quantile="0.5"} 2
+app_size_sum 4
+app_size_count 2
+`
+	if s := b.String(); expected != s {
+		t.Fatal(s)
+	}
+}
+
+func TestWriteBucketHistogram(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := metrics.NewRegisteredBucketHistogram("size", r, []float64{1, 10})
+	h.Update(0.5)
+	h.Update(5)
+	h.Update(50)
+	b := &bytes.Buffer{}
+	if err := Write(b, Config{Registry: r}); nil != err {
+		t.Fatal(err)
+	}
+	expected := `# TYPE size histogram
+size_bucket{le="1"} 1
+size_bucket{le="10"} 2
+size_bucket{le="+Inf"} 3
+size_sum 55.5
+size_count 3
+`
+	if s := b.String(); expected != s {
+		t.Fatal(s)
+	}
+}
+
+func TestWriteConflict(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("foo", r)
+	metrics.NewRegisteredGauge("foo_total", r)
+	b := &bytes.Buffer{}
+	if err := Write(b, Config{Registry: r}); nil == err {
+		t.Fatal(b.String())
+	}
+	if 0 != b.Len() {
+		t.Fatal(b.String())
+	}
+}
+
+func TestWriteConflictTagged(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("foo", r)
+	r.RegisterTagged("foo", metrics.Tags{"a": "2"}, metrics.NewGauge())
+	if err := Write(&bytes.Buffer{}, Config{Registry: r}); nil == err {
+		t.Fatal("a counter and a gauge share a family")
+	}
+	r.UnregisterTagged("foo", metrics.Tags{"a": "2"})
+	metrics.NewRegisteredCounter("a.b", r)
+	metrics.NewRegisteredCounter("a_b", r)
+	if err := Write(&bytes.Buffer{}, Config{Registry: r}); nil == err {
+		t.Fatal("duplicate series")
+	}
+}
+
+func TestWriteOpenMetricsObservations(t *testing.T) {
+	r := metrics.NewRegistry()
+	tm := metrics.NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(time.Second)
+	metrics.NewRegisteredCounter("latency_observations", r).Inc(1)
+	b := &bytes.Buffer{}
+	if err := WriteOpenMetrics(b, Config{Registry: r}); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "# TYPE latency_observations counter\nlatency_observations_total 1\n") {
+		t.Fatal(b.String())
+	}
+	tm.(*metrics.StandardTimer).UpdateWithExemplar(time.Second, metrics.Tags{"trace_id": "abc123"})
+	if err := WriteOpenMetrics(&bytes.Buffer{}, Config{Registry: r}); nil == err {
+		t.Fatal("latency_observations written twice")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredMeter("events", r).Mark(2)
+	s := httptest.NewServer(Handler(r))
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ContentType != ct {
+		t.Fatal(ct)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !bytes.Contains(body, []byte("# TYPE events_total counter\nevents_total 2\n")) {
+		t.Fatal(string(body))
+	}
+	if !bytes.Contains(body, []byte("# TYPE events_rate1 gauge\n")) {
+		t.Fatal(string(body))
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("requests", r).Inc(3)
+	metrics.NewRegisteredGauge("heap", r).Update(1024)
+	m := metrics.NewRegisteredMeter("events", r)
+	defer m.Stop()
+	tm := metrics.NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(time.Second)
+	tm.(*metrics.StandardTimer).UpdateWithExemplar(2*time.Second, metrics.Tags{"trace_id": "abc123"})
+	b := &bytes.Buffer{}
+	err := WriteOpenMetrics(b, Config{
+		Registry:  r,
+		Namespace: "app",
+		Quantiles: []float64{0.5},
+		Units:     map[string]string{"heap": "bytes"},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	expected := `# TYPE app_events counter
+app_events_total 0
+app_events_created <ts>
+# TYPE app_events_rate1 gauge
+app_events_rate1 0
+# TYPE app_events_rate15 gauge
+app_events_rate15 0
+# TYPE app_events_rate5 gauge
+app_events_rate5 0
+# TYPE app_events_rate_mean gauge
+app_events_rate_mean 0
+# TYPE app_heap_bytes gauge
+# UNIT app_heap_bytes bytes
+app_heap_bytes 1024
+# TYPE app_latency_observations counter
+app_latency_observations_total 2 # {trace_id="abc123"} 2 <ts>
+# TYPE app_latency_seconds summary
+# UNIT app_latency_seconds seconds
+app_latency_seconds{quantile="0.5"} 1.5
+app_latency_seconds_sum 3
+app_latency_seconds_count 2
+# TYPE app_requests counter
+app_requests_total 3
+app_requests_created <ts>
+# EOF
+`
+	s := regexp.MustCompile(`\d{10}(\.\d+)?|\d\.\d+e\+09`).ReplaceAllString(b.String(), "<ts>")
+	s = regexp.MustCompile(`(?m)^app_events_rate_mean .+$`).ReplaceAllString(s, "app_events_rate_mean 0")
+	if expected != s {
+		t.Fatal(s)
+	}
+}
+
+func TestWriteOpenMetricsLongExemplar(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := metrics.NewRegisteredHistogram("size", r, metrics.NewUniformSample(100))
+	h.(*metrics.StandardHistogram).UpdateWithExemplar(1, metrics.Tags{"trace_id": strings.Repeat("a", 121)})
+	b := &bytes.Buffer{}
+	if err := WriteOpenMetrics(b, Config{Registry: r}); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "size_observations_total 1\n") {
+		t.Fatal(b.String())
+	}
+}
+
+func TestOpenMetricsHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("requests", r).Inc(1)
+	s := httptest.NewServer(OpenMetricsHandler(r))
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); OpenMetricsContentType != ct {
+		t.Fatal(ct)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !bytes.HasPrefix(body, []byte("# TYPE requests counter\nrequests_total 1\nrequests_created ")) {
+		t.Fatal(string(body))
+	}
+	if !bytes.HasSuffix(body, []byte("\n# EOF\n")) {
+		t.Fatal(string(body))
+	}
+}
+
+func TestName(t *testing.T) {
+	if name := Name("", "1api.users-get"); "_1api_users_get" != name {
+		t.Fatal(name)
+	}
+}
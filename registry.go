@@ -16,6 +16,24 @@ func (err DuplicateMetric) Error() string {
 	return fmt.Sprintf("duplicate metric: %s", string(err))
 }
 
+// UnsupportedMetricType is the error returned by Registry.Register when the
+// value given is not of a metric type the registry knows how to export.
+type UnsupportedMetricType struct {
+	Name   string
+	Metric interface{}
+}
+
+func (err UnsupportedMetricType) Error() string {
+	return fmt.Sprintf("unsupported metric type: %s: %T", err.Name, err.Metric)
+}
+
+// Stoppable is implemented by metrics, such as meters and timers, which hold
+// resources that must be released once they're no longer used.  Unregister
+// stops the metrics it removes.
+type Stoppable interface {
+	Stop()
+}
+
 // A Registry holds references to a set of metrics by name and can iterate
 // over them, calling callback functions provided by the user.
 //
@@ -23,79 +41,144 @@ func (err DuplicateMetric) Error() string {
 // the Registry API as appropriate.
 type Registry interface {
 
-	// Call the given function for each registered metric.
+	// Call the given function for each registered metric.  Untagged metrics
+	// are passed by name and tagged ones by the canonical form of their
+	// MetricID.
 	Each(func(string, interface{}))
 
+	// Call the given function for each registered metric with its name and
+	// tags, which are nil for untagged metrics.
+	EachTagged(func(string, Tags, interface{}))
+
 	// Get the metric by the given name or nil if none is registered.
 	Get(string) interface{}
 
+	// Get the metric by the given name and tags or nil if none is registered.
+	GetTagged(string, Tags) interface{}
+
 	// Gets an existing metric or registers the given one.
 	// The interface can be the metric to register if not found in registry,
 	// or a function returning the metric for lazy instantiation.
+	// Returns nil if the metric is of an unsupported type.
 	GetOrRegister(string, interface{}) interface{}
 
+	// Gets an existing metric with the given tags or registers the given one.
+	GetOrRegisterTagged(string, Tags, interface{}) interface{}
+
 	// Register the given metric under the given name.
 	Register(string, interface{}) error
 
+	// Register the given metric under the given name and tags.
+	RegisterTagged(string, Tags, interface{}) error
+
 	// Run all registered healthchecks.
 	RunHealthchecks()
 
-	// Unregister the metric with the given name.
+	// Unregister the metric with the given name, stopping it if it is
+	// Stoppable.
 	Unregister(string)
 
+	// Unregister the metric with the given name and tags.
+	UnregisterTagged(string, Tags)
+
 	// Unregister all metrics.  (Mostly for testing.)
 	UnregisterAll()
 }
 
 // The standard implementation of a Registry is a mutex-protected map
-// of names to metrics.
+// of names to metrics.  Metrics are keyed by the canonical form of their
+// MetricID, which is kept alongside, if it differs from the name, so it can
+// be handed back by EachTagged.
 type StandardRegistry struct {
 	metrics map[string]interface{}
+	tagged  map[string]MetricID
 	mutex   sync.Mutex
 }
 
 // Create a new registry.
 func NewRegistry() Registry {
-	return &StandardRegistry{metrics: make(map[string]interface{})}
+	return &StandardRegistry{
+		metrics: make(map[string]interface{}),
+		tagged:  make(map[string]MetricID),
+	}
 }
 
-// Call the given function for each registered metric.
+// Call the given function for each registered metric.  An untagged metric
+// whose name looks like a MetricID, such as "x{a=1}", is passed by that name
+// just as a tagged metric x with the tag a=1 is.
 func (r *StandardRegistry) Each(f func(string, interface{})) {
-	for name, i := range r.registered() {
-		f(name, i)
+	for _, m := range r.registeredTagged() {
+		f(eachName(m.id), m.metric)
 	}
 }
 
-// Get the metric by the given name or nil if none is registered.
+// Call the given function for each registered metric with its name and tags.
+func (r *StandardRegistry) EachTagged(f func(string, Tags, interface{})) {
+	for _, m := range r.registeredTagged() {
+		f(m.id.Name, m.id.Tags, m.metric)
+	}
+}
+
+// Get the metric by the given name or nil if none is registered.  The name
+// may also be the canonical form of a MetricID.
 func (r *StandardRegistry) Get(name string) interface{} {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	return r.metrics[name]
+	return r.metrics[r.lookup(name)]
+}
+
+// Get the metric by the given name and tags or nil if none is registered.
+func (r *StandardRegistry) GetTagged(name string, tags Tags) interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.metrics[MetricID{name, tags}.String()]
 }
 
 // Gets an existing metric or creates and registers a new one. Threadsafe
 // alternative to calling Get and Register on failure.
 // The interface can be the metric to register if not found in registry,
 // or a function returning the metric for lazy instantiation.
+// Returns nil if the metric is of an unsupported type, since it can't be
+// registered.
 func (r *StandardRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	return r.GetOrRegisterTagged(name, nil, i)
+}
+
+// Gets an existing metric with the given tags or creates and registers a new
+// one.  Threadsafe alternative to calling GetTagged and RegisterTagged on
+// failure.
+func (r *StandardRegistry) GetOrRegisterTagged(name string, tags Tags, i interface{}) interface{} {
+	id := MetricID{name, tags.Copy()}
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	if metric, ok := r.metrics[name]; ok {
+	if metric, ok := r.metrics[id.String()]; ok {
 		return metric
 	}
 	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
 		i = v.Call(nil)[0].Interface()
 	}
-	r.register(name, i)
+	if err := r.register(id, i); nil != err {
+		return nil
+	}
 	return i
 }
 
 // Register the given metric under the given name.  Returns a DuplicateMetric
-// if a metric by the given name is already registered.
+// if a metric by the given name is already registered and an
+// UnsupportedMetricType if the metric is not of a supported type.
 func (r *StandardRegistry) Register(name string, i interface{}) error {
+	return r.RegisterTagged(name, nil, i)
+}
+
+// Register the given metric under the given name and tags.  Returns a
+// DuplicateMetric if a metric by the given name and tags is already
+// registered and an UnsupportedMetricType if the metric is not of a
+// supported type.
+func (r *StandardRegistry) RegisterTagged(name string, tags Tags, i interface{}) error {
+	id := MetricID{name, tags.Copy()}
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	return r.register(name, i)
+	return r.register(id, i)
 }
 
 // Run all registered healthchecks.
@@ -109,11 +192,19 @@ func (r *StandardRegistry) RunHealthchecks() {
 	}
 }
 
-// Unregister the metric with the given name.
+// Unregister the metric with the given name, which may also be the
+// canonical form of a MetricID.
 func (r *StandardRegistry) Unregister(name string) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	delete(r.metrics, name)
+	r.unregister(r.lookup(name))
+}
+
+// Unregister the metric with the given name and tags.
+func (r *StandardRegistry) UnregisterTagged(name string, tags Tags) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.unregister(MetricID{name, tags}.String())
 }
 
 // Unregister all metrics.  (Mostly for testing.)
@@ -121,27 +212,78 @@ func (r *StandardRegistry) UnregisterAll() {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	for name, _ := range r.metrics {
+		r.stop(name)
 		delete(r.metrics, name)
 	}
+	for name, _ := range r.tagged {
+		delete(r.tagged, name)
+	}
+}
+
+// lookup returns the key of the untagged metric with the given name if there
+// is one and otherwise the name itself, taken as a canonical MetricID.
+func (r *StandardRegistry) lookup(name string) string {
+	if key := (MetricID{Name: name}).String(); key != name {
+		if _, ok := r.metrics[key]; ok {
+			return key
+		}
+	}
+	return name
+}
+
+func (r *StandardRegistry) unregister(key string) {
+	r.stop(key)
+	delete(r.metrics, key)
+	delete(r.tagged, key)
+}
+
+// stop stops the named metric if it is Stoppable.
+func (r *StandardRegistry) stop(name string) {
+	if i, ok := r.metrics[name].(Stoppable); ok {
+		i.Stop()
+	}
 }
 
-func (r *StandardRegistry) register(name string, i interface{}) error {
+func (r *StandardRegistry) register(id MetricID, i interface{}) error {
+	name := id.String()
 	if _, ok := r.metrics[name]; ok {
 		return DuplicateMetric(name)
 	}
 	switch i.(type) {
-	case Counter, Gauge, GaugeFloat64, Healthcheck, Histogram, Meter, Timer:
+	case Counter, Gauge, GaugeFloat64, Healthcheck, BucketHistogram, Histogram, HistogramFloat64, Meter, Timer:
 		r.metrics[name] = i
+		if name != id.Name {
+			r.tagged[name] = id
+		}
+		return nil
 	}
-	return nil
+	return UnsupportedMetricType{name, i}
+}
+
+// eachName returns the name by which Each passes a metric: its name if it is
+// untagged and the canonical form of its MetricID otherwise.
+func eachName(id MetricID) string {
+	if 0 == len(id.Tags) {
+		return id.Name
+	}
+	return id.String()
+}
+
+type taggedMetric struct {
+	id     MetricID
+	metric interface{}
 }
 
-func (r *StandardRegistry) registered() map[string]interface{} {
+func (r *StandardRegistry) registeredTagged() []taggedMetric {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	metrics := make(map[string]interface{}, len(r.metrics))
+	metrics := make([]taggedMetric, 0, len(r.metrics))
 	for name, i := range r.metrics {
-		metrics[name] = i
+		id, ok := r.tagged[name]
+		if !ok {
+			id = MetricID{Name: name}
+		}
+		metrics = append(metrics, taggedMetric{id, i})
 	}
 	return metrics
 }
@@ -181,6 +323,16 @@ func (r *PrefixedRegistry) Each(fn func(string, interface{})) {
 	baseRegistry.Each(wrappedFn(prefix))
 }
 
+// Call the given function for each registered metric with its name and tags.
+func (r *PrefixedRegistry) EachTagged(fn func(string, Tags, interface{})) {
+	baseRegistry, prefix := findPrefix(r, "")
+	baseRegistry.EachTagged(func(name string, tags Tags, iface interface{}) {
+		if strings.HasPrefix(name, prefix) {
+			fn(name, tags, iface)
+		}
+	})
+}
+
 func findPrefix(registry Registry, prefix string) (Registry, string) {
 	switch r := registry.(type) {
 	case *PrefixedRegistry:
@@ -197,6 +349,12 @@ func (r *PrefixedRegistry) Get(name string) interface{} {
 	return r.underlying.Get(realName)
 }
 
+// Get the metric by the given name and tags or nil if none is registered.
+func (r *PrefixedRegistry) GetTagged(name string, tags Tags) interface{} {
+	realName := r.prefix + name
+	return r.underlying.GetTagged(realName, tags)
+}
+
 // Gets an existing metric or registers the given one.
 // The interface can be the metric to register if not found in registry,
 // or a function returning the metric for lazy instantiation.
@@ -205,12 +363,26 @@ func (r *PrefixedRegistry) GetOrRegister(name string, metric interface{}) interf
 	return r.underlying.GetOrRegister(realName, metric)
 }
 
+// Gets an existing metric with the given tags or registers the given one.
+// The name will be prefixed.
+func (r *PrefixedRegistry) GetOrRegisterTagged(name string, tags Tags, metric interface{}) interface{} {
+	realName := r.prefix + name
+	return r.underlying.GetOrRegisterTagged(realName, tags, metric)
+}
+
 // Register the given metric under the given name. The name will be prefixed.
 func (r *PrefixedRegistry) Register(name string, metric interface{}) error {
 	realName := r.prefix + name
 	return r.underlying.Register(realName, metric)
 }
 
+// Register the given metric under the given name and tags. The name will be
+// prefixed.
+func (r *PrefixedRegistry) RegisterTagged(name string, tags Tags, metric interface{}) error {
+	realName := r.prefix + name
+	return r.underlying.RegisterTagged(realName, tags, metric)
+}
+
 // Run all registered healthchecks.
 func (r *PrefixedRegistry) RunHealthchecks() {
 	r.underlying.RunHealthchecks()
@@ -222,6 +394,13 @@ func (r *PrefixedRegistry) Unregister(name string) {
 	r.underlying.Unregister(realName)
 }
 
+// Unregister the metric with the given name and tags. The name will be
+// prefixed.
+func (r *PrefixedRegistry) UnregisterTagged(name string, tags Tags) {
+	realName := r.prefix + name
+	r.underlying.UnregisterTagged(realName, tags)
+}
+
 // Unregister all metrics.  (Mostly for testing.)
 func (r *PrefixedRegistry) UnregisterAll() {
 	r.underlying.UnregisterAll()
@@ -234,25 +413,52 @@ func Each(f func(string, interface{})) {
 	DefaultRegistry.Each(f)
 }
 
+// Call the given function for each registered metric with its name and tags.
+func EachTagged(f func(string, Tags, interface{})) {
+	DefaultRegistry.EachTagged(f)
+}
+
 // Get the metric by the given name or nil if none is registered.
 func Get(name string) interface{} {
 	return DefaultRegistry.Get(name)
 }
 
+// Get the metric by the given name and tags or nil if none is registered.
+func GetTagged(name string, tags Tags) interface{} {
+	return DefaultRegistry.GetTagged(name, tags)
+}
+
 // Gets an existing metric or creates and registers a new one. Threadsafe
 // alternative to calling Get and Register on failure.
 func GetOrRegister(name string, i interface{}) interface{} {
 	return DefaultRegistry.GetOrRegister(name, i)
 }
 
+// Gets an existing metric with the given tags or creates and registers a new
+// one.  Threadsafe alternative to calling GetTagged and RegisterTagged on
+// failure.
+func GetOrRegisterTagged(name string, tags Tags, i interface{}) interface{} {
+	return DefaultRegistry.GetOrRegisterTagged(name, tags, i)
+}
+
 // Register the given metric under the given name.  Returns a DuplicateMetric
-// if a metric by the given name is already registered.
+// if a metric by the given name is already registered and an
+// UnsupportedMetricType if the metric is not of a supported type.
 func Register(name string, i interface{}) error {
 	return DefaultRegistry.Register(name, i)
 }
 
+// Register the given metric under the given name and tags.  Returns a
+// DuplicateMetric if a metric by the given name and tags is already
+// registered and an UnsupportedMetricType if the metric is not of a
+// supported type.
+func RegisterTagged(name string, tags Tags, i interface{}) error {
+	return DefaultRegistry.RegisterTagged(name, tags, i)
+}
+
 // Register the given metric under the given name.  Panics if a metric by the
-// given name is already registered.
+// given name is already registered or if the metric is not of a supported
+// type.
 func MustRegister(name string, i interface{}) {
 	if err := Register(name, i); err != nil {
 		panic(err)
@@ -268,3 +474,8 @@ func RunHealthchecks() {
 func Unregister(name string) {
 	DefaultRegistry.Unregister(name)
 }
+
+// Unregister the metric with the given name and tags.
+func UnregisterTagged(name string, tags Tags) {
+	DefaultRegistry.UnregisterTagged(name, tags)
+}
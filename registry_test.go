@@ -286,3 +286,150 @@ func TestWalkRegistries(t *testing.T) {
 	}
 
 }
+
+func TestRegistryTagged(t *testing.T) {
+	r := NewRegistry()
+	tags := Tags{"status": "200", "method": "GET"}
+	if err := r.RegisterTagged("requests", tags, NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+	if err := r.RegisterTagged("requests", Tags{"method": "GET", "status": "200"}, NewCounter()); nil == err {
+		t.Fatal(err)
+	}
+	if err := r.RegisterTagged("requests", Tags{"method": "GET", "status": "500"}, NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+	tags["status"] = "404"
+	r.GetTagged("requests", Tags{"method": "GET", "status": "200"}).(Counter).Inc(1)
+	if nil != r.GetTagged("requests", tags) {
+		t.Fatal(tags)
+	}
+	if c := r.Get("requests{method=GET,status=200}").(Counter); 1 != c.Count() {
+		t.Fatal(c.Count())
+	}
+	i := 0
+	r.EachTagged(func(name string, tags Tags, iface interface{}) {
+		i++
+		if "requests" != name {
+			t.Fatal(name)
+		}
+		if "GET" != tags["method"] {
+			t.Fatal(tags)
+		}
+	})
+	if 2 != i {
+		t.Fatal(i)
+	}
+	r.UnregisterTagged("requests", Tags{"method": "GET", "status": "200"})
+	i = 0
+	r.Each(func(name string, iface interface{}) {
+		i++
+		if "requests{method=GET,status=500}" != name {
+			t.Fatal(name)
+		}
+	})
+	if 1 != i {
+		t.Fatal(i)
+	}
+}
+
+func TestRegistryTaggedEscaping(t *testing.T) {
+	r := NewRegistry()
+	if err := r.RegisterTagged("x", Tags{"a": "1,b=2"}, NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+	if err := r.RegisterTagged("x", Tags{"a": "1", "b": "2"}, NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+	if err := r.Register("x{a=1,b=2}", NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+	r.Get("x{a=1,b=2}").(Counter).Inc(1)
+	if r.GetTagged("x{a=1,b=2}", nil) != r.Get(`x\{a=1,b=2\}`) {
+		t.Fatal("the canonical form of an untagged metric isn't its key")
+	}
+	if c := r.GetTagged("x", Tags{"a": "1", "b": "2"}).(Counter); 0 != c.Count() {
+		t.Fatal(c.Count())
+	}
+	if c := r.Get("x{a=1,b=2}").(Counter); 1 != c.Count() {
+		t.Fatal(c.Count())
+	}
+	names := make(map[string]int)
+	r.Each(func(name string, iface interface{}) { names[name]++ })
+	if 2 != len(names) || 1 != names[`x{a=1\,b\=2}`] || 2 != names["x{a=1,b=2}"] {
+		t.Fatal(names)
+	}
+	r.UnregisterTagged("x", Tags{"a": "1", "b": "2"})
+	if nil == r.Get("x{a=1,b=2}") || nil != r.GetTagged("x", Tags{"a": "1", "b": "2"}) {
+		t.Fatal("unregistered the untagged metric")
+	}
+}
+
+func TestRegistryEachTaggedUntagged(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewCounter())
+	r.EachTagged(func(name string, tags Tags, iface interface{}) {
+		if "foo" != name {
+			t.Fatal(name)
+		}
+		if nil != tags {
+			t.Fatal(tags)
+		}
+	})
+}
+
+func TestPrefixedRegistryTagged(t *testing.T) {
+	r := NewRegistry()
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	pr.GetOrRegisterTagged("foo", Tags{"a": "b"}, NewCounter)
+	r.Register("bar", NewCounter())
+	i := 0
+	pr.EachTagged(func(name string, tags Tags, m interface{}) {
+		i++
+		if "prefix.foo" != name || "b" != tags["a"] {
+			t.Fatal(name, tags)
+		}
+	})
+	if 1 != i {
+		t.Fatal(i)
+	}
+	if nil == pr.GetTagged("foo", Tags{"a": "b"}) {
+		t.Fatal("foo")
+	}
+}
+
+func TestRegistryUnsupportedMetricType(t *testing.T) {
+	r := NewRegistry()
+	err := r.Register("foo", "not a metric")
+	if e, ok := err.(UnsupportedMetricType); !ok || "foo" != e.Name {
+		t.Fatal(err)
+	}
+	if m := r.GetOrRegister("bar", func() int { return 47 }); nil != m {
+		t.Fatal(m)
+	}
+	i := 0
+	r.Each(func(string, interface{}) { i++ })
+	if 0 != i {
+		t.Fatal(i)
+	}
+	if err := r.Register("foo", NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryUnregisterStops(t *testing.T) {
+	r := NewRegistry()
+	m := NewRegisteredMeter("foo", r).(*StandardMeter)
+	tm := NewRegisteredTimer("bar", r).(*StandardTimer)
+	r.Unregister("foo")
+	r.UnregisterAll()
+	ma := m.arbiter
+	ma.RLock()
+	defer ma.RUnlock()
+	if _, ok := ma.meters[m]; ok {
+		t.Error("unregistered meter is still ticked by the arbiter")
+	}
+	if _, ok := ma.meters[tm.meter.(*StandardMeter)]; ok {
+		t.Error("unregistered timer is still ticked by the arbiter")
+	}
+}
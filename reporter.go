@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RunReporter calls flush every d until ctx is done and then once more, so
+// that whatever was recorded since the last tick is not lost.  Each error
+// flush returns is passed to onError, or logged if onError is nil.
+//
+// RunReporter blocks until the final flush has returned, which makes it the
+// loop behind every blocking exporter function in this package: cancel the
+// context to stop the exporter.  If d isn't positive, the error is reported
+// and RunReporter returns at once without flushing.
+func RunReporter(ctx context.Context, d time.Duration, flush func() error, onError func(error)) {
+	if nil == onError {
+		onError = func(err error) { log.Println(err) }
+	}
+	if d <= 0 {
+		onError(fmt.Errorf("metrics: non-positive reporting interval %v", d))
+		return
+	}
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := flush(); nil != err {
+				onError(err)
+			}
+		case <-ctx.Done():
+			if err := flush(); nil != err {
+				onError(err)
+			}
+			return
+		}
+	}
+}
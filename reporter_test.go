@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunReporterFinalFlush(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var n int
+	RunReporter(ctx, time.Hour, func() error {
+		n++
+		return nil
+	}, nil)
+	if 1 != n {
+		t.Errorf("flushes: %d != 1\n", n)
+	}
+}
+
+func TestRunReporterOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	want := errors.New("flush failed")
+	var errs []error
+	RunReporter(ctx, time.Millisecond, func() error {
+		return want
+	}, func(err error) {
+		errs = append(errs, err)
+		if 3 == len(errs) {
+			cancel()
+		}
+	})
+	if 4 != len(errs) {
+		t.Fatalf("errors: %d != 4\n", len(errs))
+	}
+	for _, err := range errs {
+		if want != err {
+			t.Errorf("error: %v != %v\n", err, want)
+		}
+	}
+}
+
+func TestRunReporterInterval(t *testing.T) {
+	var errs []error
+	WriteJSONContext(context.Background(), NewRegistry(), 0, &bytes.Buffer{}, func(err error) {
+		errs = append(errs, err)
+	})
+	if 1 != len(errs) {
+		t.Fatalf("errors: %d != 1\n", len(errs))
+	}
+}
+
+func TestWriteContext(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(47)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var b bytes.Buffer
+	WriteContext(ctx, r, time.Hour, &b, func(err error) { t.Error(err) })
+	if s := b.String(); "counter foo\n  count:              47\n" != s {
+		t.Errorf("output: %q\n", s)
+	}
+}
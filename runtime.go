@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"runtime"
 	"runtime/pprof"
 	"time"
@@ -55,9 +56,16 @@ var (
 // Capture new values for the Go runtime statistics exported in
 // runtime.MemStats.  This is designed to be called as a goroutine.
 func CaptureRuntimeMemStats(r Registry, d time.Duration) {
-	for _ = range time.Tick(d) {
+	CaptureRuntimeMemStatsContext(context.Background(), r, d)
+}
+
+// CaptureRuntimeMemStatsContext is just like CaptureRuntimeMemStats, but it
+// returns after capturing one final time once ctx is done.
+func CaptureRuntimeMemStatsContext(ctx context.Context, r Registry, d time.Duration) {
+	RunReporter(ctx, d, func() error {
 		CaptureRuntimeMemStatsOnce(r)
-	}
+		return nil
+	}, nil)
 }
 
 // Capture new values for the Go runtime statistics exported in
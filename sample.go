@@ -22,6 +22,7 @@ type Sample interface {
 	Percentiles([]float64) []float64
 	Size() int
 	Snapshot() Sample
+	SnapshotAndClear() Sample
 	StdDev() float64
 	Sum() int64
 	Update(int64)
@@ -29,6 +30,23 @@ type Sample interface {
 	Variance() float64
 }
 
+// ExponentialSample is implemented by samples which can count their values in
+// the buckets of an exponential histogram, as OpenTelemetry's are.
+type ExponentialSample interface {
+	Sample
+	ExponentialCounts(unit float64) ExponentialCounts
+}
+
+// ExponentialCounts are counts of values in buckets whose bounds grow by a
+// factor of 2^(2^-Scale).  Counts[i] is the number of values v for which
+// base^(Offset+i) < v <= base^(Offset+i+1).
+type ExponentialCounts struct {
+	Scale     int32
+	ZeroCount int64 // Values of zero or less, which no bucket holds
+	Offset    int32
+	Counts    []int64
+}
+
 // ExpDecaySample is an exponentially-decaying sample using a forward-decaying
 // priority reservoir.  See Cormode et al's "Forward Decay: A Practical Time
 // Decay Model for Streaming Systems".
@@ -36,6 +54,7 @@ type Sample interface {
 // <http://dimacs.rutgers.edu/~graham/pubs/papers/fwddecay.pdf>
 type ExpDecaySample struct {
 	alpha         float64
+	clock         Clock
 	count         int64
 	mutex         sync.Mutex
 	reservoirSize int
@@ -46,13 +65,20 @@ type ExpDecaySample struct {
 // NewExpDecaySample constructs a new exponentially-decaying sample with the
 // given reservoir size and alpha.
 func NewExpDecaySample(reservoirSize int, alpha float64) Sample {
+	return NewExpDecaySampleWithClock(reservoirSize, alpha, SystemClock)
+}
+
+// NewExpDecaySampleWithClock constructs a new exponentially-decaying sample
+// which takes the time from the given Clock.
+func NewExpDecaySampleWithClock(reservoirSize int, alpha float64, c Clock) Sample {
 	if UseNilMetrics {
 		return NilSample{}
 	}
 	s := &ExpDecaySample{
 		alpha:         alpha,
+		clock:         c,
 		reservoirSize: reservoirSize,
-		t0:            time.Now(),
+		t0:            c.Now(),
 		values:        newExpDecaySampleHeap(reservoirSize),
 	}
 	s.t1 = s.t0.Add(rescaleThreshold)
@@ -63,10 +89,7 @@ func NewExpDecaySample(reservoirSize int, alpha float64) Sample {
 func (s *ExpDecaySample) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.count = 0
-	s.t0 = time.Now()
-	s.t1 = s.t0.Add(rescaleThreshold)
-	s.values.Clear()
+	s.clear()
 }
 
 // Count returns the number of samples recorded, which may exceed the
@@ -116,15 +139,17 @@ func (s *ExpDecaySample) Size() int {
 func (s *ExpDecaySample) Snapshot() Sample {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	vals := s.values.Values()
-	values := make([]int64, len(vals))
-	for i, v := range vals {
-		values[i] = v.v
-	}
-	return &SampleSnapshot{
-		count:  s.count,
-		values: values,
-	}
+	return s.snapshot()
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *ExpDecaySample) SnapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := s.snapshot()
+	s.clear()
+	return snapshot
 }
 
 // StdDev returns the standard deviation of the values in the sample.
@@ -139,7 +164,7 @@ func (s *ExpDecaySample) Sum() int64 {
 
 // Update samples a new value.
 func (s *ExpDecaySample) Update(v int64) {
-	s.update(time.Now(), v)
+	s.update(s.clock.Now(), v)
 }
 
 // Values returns a copy of the values in the sample.
@@ -185,6 +210,64 @@ func (s *ExpDecaySample) update(t time.Time, v int64) {
 	}
 }
 
+// checkpoint returns the count, landmark and reservoir of the sample.
+func (s *ExpDecaySample) checkpoint() *persistedState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	vals := s.values.Values()
+	st := &persistedState{
+		Count:      s.count,
+		Start:      s.t0,
+		Values:     make([]int64, len(vals)),
+		Priorities: make([]float64, len(vals)),
+	}
+	for i, v := range vals {
+		st.Values[i], st.Priorities[i] = v.v, v.k
+	}
+	return st
+}
+
+// restore refills the sample from a checkpoint, rescaling the priorities to
+// the current landmark, unless anything has been sampled since it was
+// constructed or cleared.
+func (s *ExpDecaySample) restore(st *persistedState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 != s.count || len(st.Values) != len(st.Priorities) || nil != st.Digest || nil != st.HDR {
+		return
+	}
+	s.count = st.Count
+	scale := math.Exp(-s.alpha * s.t0.Sub(st.Start).Seconds())
+	for i, v := range st.Values {
+		if s.values.Size() == s.reservoirSize {
+			s.values.Pop()
+		}
+		s.values.Push(expDecaySample{k: st.Priorities[i] * scale, v: v})
+	}
+}
+
+// clear clears the sample.  It must be called with s.mutex held.
+func (s *ExpDecaySample) clear() {
+	s.count = 0
+	s.t0 = s.clock.Now()
+	s.t1 = s.t0.Add(rescaleThreshold)
+	s.values.Clear()
+}
+
+// snapshot returns a copy of the sample.  It must be called with s.mutex
+// held.
+func (s *ExpDecaySample) snapshot() *SampleSnapshot {
+	vals := s.values.Values()
+	values := make([]int64, len(vals))
+	for i, v := range vals {
+		values[i] = v.v
+	}
+	return &SampleSnapshot{
+		count:  s.count,
+		values: values,
+	}
+}
+
 // NilSample is a no-op Sample.
 type NilSample struct{}
 
@@ -217,6 +300,9 @@ func (NilSample) Size() int { return 0 }
 // Sample is a no-op.
 func (NilSample) Snapshot() Sample { return NilSample{} }
 
+// SnapshotAndClear is a no-op.
+func (NilSample) SnapshotAndClear() Sample { return NilSample{} }
+
 // StdDev is a no-op.
 func (NilSample) StdDev() float64 { return 0.0 }
 
@@ -296,6 +382,28 @@ func SamplePercentiles(values int64Slice, ps []float64) []float64 {
 	return scores
 }
 
+// mergeSamples combines the snapshots of two samples.  HDR histograms are
+// merged bucket by bucket and t-digests centroid by centroid so that they
+// stay compact; any other samples are combined by drawing values from each
+// in proportion to its count.
+func mergeSamples(a, b Sample) Sample {
+	if ha, ok := a.(*HDRSampleSnapshot); ok {
+		if hb, ok := b.Snapshot().(*HDRSampleSnapshot); ok {
+			h := ha.h.copy()
+			h.merge(hb.h)
+			return &HDRSampleSnapshot{h: h}
+		}
+	}
+	if da, ok := a.(*TDigestSampleSnapshot); ok {
+		if db, ok := b.Snapshot().(*TDigestSampleSnapshot); ok {
+			d := da.d.copy()
+			d.merge(db.d.digest())
+			return &TDigestSampleSnapshot{d: d}
+		}
+	}
+	return NewSampleSnapshot(a.Count(), a.Values()).Merge(b)
+}
+
 // SampleSnapshot is a read-only copy of another Sample.
 type SampleSnapshot struct {
 	count  int64
@@ -323,6 +431,52 @@ func (s *SampleSnapshot) Max() int64 { return SampleMax(s.values) }
 // Mean returns the mean value at the time the snapshot was taken.
 func (s *SampleSnapshot) Mean() float64 { return SampleMean(s.values) }
 
+// Merge returns a snapshot of both this snapshot and another Sample, whose
+// count is the sum of theirs.  It holds as many values as both together,
+// drawn from each in proportion to the count it stands for, so that a full
+// reservoir of a busy sample isn't outweighed by that of a quiet one.  Each
+// sample with values keeps at least one.
+func (s *SampleSnapshot) Merge(o Sample) *SampleSnapshot {
+	ov := o.Values()
+	values := make([]int64, 0, len(s.values)+len(ov))
+	n := mergedSize(s.count, o.Count(), len(s.values), len(ov))
+	values = append(values, resample(s.values, n)...)
+	values = append(values, resample(ov, cap(values)-n)...)
+	return NewSampleSnapshot(s.count+o.Count(), values)
+}
+
+// mergedSize returns how many of the values of a sample of count a, holding
+// na values, to keep when merging it with a sample of count b holding nb.
+func mergedSize(a, b int64, na, nb int) int {
+	if a <= 0 || b <= 0 || 0 == na || 0 == nb {
+		return na
+	}
+	n := int(float64(na+nb)*float64(a)/float64(a+b) + 0.5)
+	if n < 1 {
+		return 1
+	}
+	if n > na+nb-1 {
+		return na + nb - 1
+	}
+	return n
+}
+
+// resample returns n values spread evenly across the sorted values, repeating
+// some if n exceeds their number.
+func resample(values []int64, n int) []int64 {
+	if n == len(values) || 0 == len(values) {
+		return values
+	}
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Sort(int64Slice(sorted))
+	resampled := make([]int64, n)
+	for i := range resampled {
+		resampled[i] = sorted[(2*i+1)*len(sorted)/(2*n)]
+	}
+	return resampled
+}
+
 // Min returns the minimal value at the time the snapshot was taken.
 func (s *SampleSnapshot) Min() int64 { return SampleMin(s.values) }
 
@@ -344,6 +498,11 @@ func (s *SampleSnapshot) Size() int { return len(s.values) }
 // Snapshot returns the snapshot.
 func (s *SampleSnapshot) Snapshot() Sample { return s }
 
+// SnapshotAndClear panics.
+func (*SampleSnapshot) SnapshotAndClear() Sample {
+	panic("SnapshotAndClear called on a SampleSnapshot")
+}
+
 // StdDev returns the standard deviation of values at the time the snapshot was
 // taken.
 func (s *SampleSnapshot) StdDev() float64 { return SampleStdDev(s.values) }
@@ -489,6 +648,20 @@ func (s *UniformSample) Snapshot() Sample {
 	}
 }
 
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *UniformSample) SnapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &SampleSnapshot{
+		count:  s.count,
+		values: s.values,
+	}
+	s.count = 0
+	s.values = make([]int64, 0, s.reservoirSize)
+	return snapshot
+}
+
 // StdDev returns the standard deviation of the values in the sample.
 func (s *UniformSample) StdDev() float64 {
 	s.mutex.Lock()
@@ -534,6 +707,31 @@ func (s *UniformSample) Variance() float64 {
 	return SampleVariance(s.values)
 }
 
+// checkpoint returns the count and reservoir of the sample.
+func (s *UniformSample) checkpoint() *persistedState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := make([]int64, len(s.values))
+	copy(values, s.values)
+	return &persistedState{Count: s.count, Values: values}
+}
+
+// restore refills the sample from a checkpoint unless anything has been
+// sampled since it was constructed or cleared.
+func (s *UniformSample) restore(st *persistedState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 != s.count || nil != st.Digest || nil != st.HDR {
+		return
+	}
+	s.count = st.Count
+	values := st.Values
+	if len(values) > s.reservoirSize {
+		values = values[:s.reservoirSize]
+	}
+	s.values = append(s.values[:0], values...)
+}
+
 // expDecaySample represents an individual sample in a heap.
 type expDecaySample struct {
 	k float64
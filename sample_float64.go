@@ -8,6 +8,8 @@ import (
 	"time"
 )
 
+// SampleFloat64s maintain a statistically-significant selection of float64
+// values from a stream.
 type SampleFloat64 interface {
 	Clear()
 	Count() int64
@@ -18,6 +20,7 @@ type SampleFloat64 interface {
 	Percentiles([]float64) []float64
 	Size() int
 	Snapshot() SampleFloat64
+	SnapshotAndClear() SampleFloat64
 	StdDev() float64
 	Sum() float64
 	Update(float64)
@@ -25,8 +28,11 @@ type SampleFloat64 interface {
 	Variance() float64
 }
 
+// ExpDecaySampleFloat64 is an exponentially-decaying sample of float64 values
+// just like ExpDecaySample.
 type ExpDecaySampleFloat64 struct {
 	alpha         float64
+	clock         Clock
 	count         int64
 	mutex         sync.Mutex
 	reservoirSize int
@@ -37,10 +43,20 @@ type ExpDecaySampleFloat64 struct {
 // NewExpDecaySampleFloat64 constructs a new exponentially-decaying sample with the
 // given reservoir size and alpha.
 func NewExpDecaySampleFloat64(reservoirSize int, alpha float64) SampleFloat64 {
+	return NewExpDecaySampleFloat64WithClock(reservoirSize, alpha, SystemClock)
+}
+
+// NewExpDecaySampleFloat64WithClock constructs a new exponentially-decaying sample
+// which takes the time from the given Clock.
+func NewExpDecaySampleFloat64WithClock(reservoirSize int, alpha float64, c Clock) SampleFloat64 {
+	if UseNilMetrics {
+		return NilSampleFloat64{}
+	}
 	s := &ExpDecaySampleFloat64{
 		alpha:         alpha,
+		clock:         c,
 		reservoirSize: reservoirSize,
-		t0:            time.Now(),
+		t0:            c.Now(),
 		values:        newExpDecaySampleHeapFloat64(reservoirSize),
 	}
 	s.t1 = s.t0.Add(rescaleThreshold)
@@ -51,10 +67,7 @@ func NewExpDecaySampleFloat64(reservoirSize int, alpha float64) SampleFloat64 {
 func (s *ExpDecaySampleFloat64) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.count = 0
-	s.t0 = time.Now()
-	s.t1 = s.t0.Add(rescaleThreshold)
-	s.values.Clear()
+	s.clear()
 }
 
 // Count returns the number of samples recorded, which may exceed the
@@ -104,15 +117,17 @@ func (s *ExpDecaySampleFloat64) Size() int {
 func (s *ExpDecaySampleFloat64) Snapshot() SampleFloat64 {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	vals := s.values.Values()
-	values := make([]float64, len(vals))
-	for i, v := range vals {
-		values[i] = v.v
-	}
-	return &SampleSnapshotFloat64{
-		count:  s.count,
-		values: values,
-	}
+	return s.snapshot()
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *ExpDecaySampleFloat64) SnapshotAndClear() SampleFloat64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := s.snapshot()
+	s.clear()
+	return snapshot
 }
 
 // StdDev returns the standard deviation of the values in the sample.
@@ -127,7 +142,7 @@ func (s *ExpDecaySampleFloat64) Sum() float64 {
 
 // Update samples a new value.
 func (s *ExpDecaySampleFloat64) Update(v float64) {
-	s.update(time.Now(), v)
+	s.update(s.clock.Now(), v)
 }
 
 // Values returns a copy of the values in the sample.
@@ -173,6 +188,78 @@ func (s *ExpDecaySampleFloat64) update(t time.Time, v float64) {
 	}
 }
 
+// clear clears the sample.  It must be called with s.mutex held.
+func (s *ExpDecaySampleFloat64) clear() {
+	s.count = 0
+	s.t0 = s.clock.Now()
+	s.t1 = s.t0.Add(rescaleThreshold)
+	s.values.Clear()
+}
+
+// snapshot returns a copy of the sample.  It must be called with s.mutex
+// held.
+func (s *ExpDecaySampleFloat64) snapshot() *SampleSnapshotFloat64 {
+	vals := s.values.Values()
+	values := make([]float64, len(vals))
+	for i, v := range vals {
+		values[i] = v.v
+	}
+	return &SampleSnapshotFloat64{
+		count:  s.count,
+		values: values,
+	}
+}
+
+// NilSampleFloat64 is a no-op SampleFloat64.
+type NilSampleFloat64 struct{}
+
+// Clear is a no-op.
+func (NilSampleFloat64) Clear() {}
+
+// Count is a no-op.
+func (NilSampleFloat64) Count() int64 { return 0 }
+
+// Max is a no-op.
+func (NilSampleFloat64) Max() float64 { return 0.0 }
+
+// Mean is a no-op.
+func (NilSampleFloat64) Mean() float64 { return 0.0 }
+
+// Min is a no-op.
+func (NilSampleFloat64) Min() float64 { return 0.0 }
+
+// Percentile is a no-op.
+func (NilSampleFloat64) Percentile(p float64) float64 { return 0.0 }
+
+// Percentiles is a no-op.
+func (NilSampleFloat64) Percentiles(ps []float64) []float64 {
+	return make([]float64, len(ps))
+}
+
+// Size is a no-op.
+func (NilSampleFloat64) Size() int { return 0 }
+
+// Snapshot is a no-op.
+func (NilSampleFloat64) Snapshot() SampleFloat64 { return NilSampleFloat64{} }
+
+// SnapshotAndClear is a no-op.
+func (NilSampleFloat64) SnapshotAndClear() SampleFloat64 { return NilSampleFloat64{} }
+
+// StdDev is a no-op.
+func (NilSampleFloat64) StdDev() float64 { return 0.0 }
+
+// Sum is a no-op.
+func (NilSampleFloat64) Sum() float64 { return 0.0 }
+
+// Update is a no-op.
+func (NilSampleFloat64) Update(v float64) {}
+
+// Values is a no-op.
+func (NilSampleFloat64) Values() []float64 { return []float64{} }
+
+// Variance is a no-op.
+func (NilSampleFloat64) Variance() float64 { return 0.0 }
+
 // SampleMaxFloat64 returns the maximum value of the slice of float64.
 func SampleMaxFloat64(values []float64) float64 {
 	if 0 == len(values) {
@@ -237,6 +324,20 @@ func SamplePercentilesFloat64(values float64Slice, ps []float64) []float64 {
 	return scores
 }
 
+// mergeSamplesFloat64 combines the snapshots of two samples in the same way
+// as mergeSamples.
+func mergeSamplesFloat64(a, b SampleFloat64) SampleFloat64 {
+	if da, ok := a.(*TDigestSampleSnapshotFloat64); ok {
+		if db, ok := b.Snapshot().(*TDigestSampleSnapshotFloat64); ok {
+			d := da.d.copy()
+			d.merge(db.d.digest())
+			return &TDigestSampleSnapshotFloat64{d: d}
+		}
+	}
+	s := &SampleSnapshotFloat64{count: a.Count(), values: a.Values()}
+	return s.Merge(b)
+}
+
 // SampleSnapshotFloat64 is a read-only copy of another Sample.
 type SampleSnapshotFloat64 struct {
 	count  int64
@@ -257,6 +358,34 @@ func (s *SampleSnapshotFloat64) Max() float64 { return SampleMaxFloat64(s.values
 // Mean returns the mean value at the time the snapshot was taken.
 func (s *SampleSnapshotFloat64) Mean() float64 { return SampleMeanFloat64(s.values) }
 
+// Merge returns a snapshot of both this snapshot and another SampleFloat64,
+// whose count is the sum of theirs, drawing values from each in proportion to
+// its count just like SampleSnapshot.Merge.
+func (s *SampleSnapshotFloat64) Merge(o SampleFloat64) *SampleSnapshotFloat64 {
+	ov := o.Values()
+	values := make([]float64, 0, len(s.values)+len(ov))
+	n := mergedSize(s.count, o.Count(), len(s.values), len(ov))
+	values = append(values, resampleFloat64(s.values, n)...)
+	values = append(values, resampleFloat64(ov, cap(values)-n)...)
+	return &SampleSnapshotFloat64{count: s.count + o.Count(), values: values}
+}
+
+// resampleFloat64 returns n values spread evenly across the sorted values,
+// repeating some if n exceeds their number.
+func resampleFloat64(values []float64, n int) []float64 {
+	if n == len(values) || 0 == len(values) {
+		return values
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	resampled := make([]float64, n)
+	for i := range resampled {
+		resampled[i] = sorted[(2*i+1)*len(sorted)/(2*n)]
+	}
+	return resampled
+}
+
 // Min returns the minimal value at the time the snapshot was taken.
 func (s *SampleSnapshotFloat64) Min() float64 { return SampleMinFloat64(s.values) }
 
@@ -278,6 +407,11 @@ func (s *SampleSnapshotFloat64) Size() int { return len(s.values) }
 // Snapshot returns the snapshot.
 func (s *SampleSnapshotFloat64) Snapshot() SampleFloat64 { return s }
 
+// SnapshotAndClear panics.
+func (*SampleSnapshotFloat64) SnapshotAndClear() SampleFloat64 {
+	panic("SnapshotAndClear called on a SampleSnapshotFloat64")
+}
+
 // StdDev returns the standard deviation of values at the time the snapshot was
 // taken.
 func (s *SampleSnapshotFloat64) StdDev() float64 { return SampleStdDevFloat64(s.values) }
@@ -341,6 +475,9 @@ type UniformSampleFloat64 struct {
 // NewUniformSampleFloat64 constructs a new uniform sample with the given reservoir
 // size.
 func NewUniformSampleFloat64(reservoirSize int) SampleFloat64 {
+	if UseNilMetrics {
+		return NilSampleFloat64{}
+	}
 	return &UniformSampleFloat64{
 		reservoirSize: reservoirSize,
 		values:        make([]float64, 0, reservoirSize),
@@ -420,6 +557,20 @@ func (s *UniformSampleFloat64) Snapshot() SampleFloat64 {
 	}
 }
 
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *UniformSampleFloat64) SnapshotAndClear() SampleFloat64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &SampleSnapshotFloat64{
+		count:  s.count,
+		values: s.values,
+	}
+	s.count = 0
+	s.values = make([]float64, 0, s.reservoirSize)
+	return snapshot
+}
+
 // StdDev returns the standard deviation of the values in the sample.
 func (s *UniformSampleFloat64) StdDev() float64 {
 	s.mutex.Lock()
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"math"
 	"math/rand"
 	"runtime"
 	"testing"
@@ -361,3 +362,76 @@ func TestUniformSampleConcurrentUpdateCount(t *testing.T) {
 	}
 	quit <- struct{}{}
 }
+
+func TestSampleSnapshotMerge(t *testing.T) {
+	a := NewSampleSnapshot(10, []int64{1, 2})
+	b := NewUniformSample(100)
+	b.Update(3)
+	s := a.Merge(b)
+	if count := s.Count(); 11 != count {
+		t.Errorf("s.Count(): 11 != %v\n", count)
+	}
+	if values := s.Values(); 3 != len(values) || 1 != values[0] || 3 != values[2] {
+		t.Errorf("s.Values(): %v\n", values)
+	}
+	if values := a.Values(); 2 != len(values) {
+		t.Errorf("a.Values(): %v\n", values)
+	}
+}
+
+func TestSampleSnapshotMergeWeighted(t *testing.T) {
+	a := NewSampleSnapshot(1000, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	b := NewSampleSnapshot(10, []int64{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000})
+	s := a.Merge(b)
+	if count, size := s.Count(), s.Size(); 1010 != count || 20 != size {
+		t.Errorf("s.Count(), s.Size(): %v, %v\n", count, size)
+	}
+	if p90, max := s.Percentile(0.9), s.Max(); 10 != p90 || 1000 != max {
+		t.Errorf("s.Percentile(0.9), s.Max(): %v, %v\n", p90, max)
+	}
+}
+
+func TestSampleSnapshotMergeHDR(t *testing.T) {
+	a, b := NewHDRSample(1, 1000000, 3), NewHDRSample(1, 1000, 2)
+	for i := 0; i < 1000; i++ {
+		a.Update(10)
+	}
+	b.Update(1000)
+	h := NewHistogram(a).Snapshot().(*HistogramSnapshot).Merge(NewHistogram(b))
+	if count, sum := h.Count(), h.Sum(); 1001 != count || 11000 != sum {
+		t.Errorf("h.Count(), h.Sum(): %v, %v\n", count, sum)
+	}
+	if p50, p999, min, max := h.Percentile(0.5), h.Percentile(0.9999), h.Min(), h.Max(); 10 != p50 || 1000 != p999 || 10 != min || 1000 != max {
+		t.Errorf("h.Percentile(0.5), h.Percentile(0.9999), h.Min(), h.Max(): %v, %v, %v, %v\n", p50, p999, min, max)
+	}
+	if mean := h.Mean(); 11000.0/1001 != mean {
+		t.Errorf("h.Mean(): %v\n", mean)
+	}
+	if stdDev := h.StdDev(); math.Abs(stdDev-31.3) > 0.1 {
+		t.Errorf("h.StdDev(): %v\n", stdDev)
+	}
+	if _, ok := h.Sample().(*HDRSampleSnapshot); !ok {
+		t.Errorf("h.Sample(): %T\n", h.Sample())
+	}
+}
+
+func TestSampleSnapshotAndClear(t *testing.T) {
+	for _, s := range []Sample{
+		NewExpDecaySample(100, 0.015),
+		NewUniformSample(100),
+		NewSlidingWindowSample(100),
+		NewSlidingTimeWindowSample(time.Minute, time.Second),
+		NewHDRSample(1, 1000, 3),
+		NewTDigestSample(100),
+	} {
+		s.Update(47)
+		snapshot := s.SnapshotAndClear()
+		s.Update(1)
+		if count, max := snapshot.Count(), snapshot.Max(); 1 != count || 47 != max {
+			t.Errorf("%T snapshot.Count(), snapshot.Max(): %v, %v\n", s, count, max)
+		}
+		if count, max := s.Count(), s.Max(); 1 != count || 1 != max {
+			t.Errorf("%T s.Count(), s.Max(): %v, %v\n", s, count, max)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SlidingTimeWindowSample is a sample of every value recorded within a
+// window of time, such as the last minute, so that its statistics describe
+// exactly that window.  Values are kept in a ring of buckets each covering
+// resolution of time and are forgotten a whole bucket at a time, so a value
+// leaves the sample between window - resolution and window after it was
+// recorded.  Memory use grows with the number of values in the window.
+type SlidingTimeWindowSample struct {
+	buckets    []timeWindowBucket
+	clock      Clock
+	count      int64
+	mutex      sync.Mutex
+	resolution time.Duration
+	start      time.Time
+}
+
+// noTick marks a bucket which holds no values.
+const noTick = math.MinInt64
+
+type timeWindowBucket struct {
+	tick   int64
+	values []int64
+}
+
+// NewSlidingTimeWindowSample constructs a new sliding time-window sample
+// which keeps the values recorded within window, forgetting them resolution
+// at a time.
+func NewSlidingTimeWindowSample(window, resolution time.Duration) Sample {
+	return NewSlidingTimeWindowSampleWithClock(window, resolution, SystemClock)
+}
+
+// NewSlidingTimeWindowSampleWithClock constructs a new sliding time-window
+// sample which takes the time from the given Clock.
+func NewSlidingTimeWindowSampleWithClock(window, resolution time.Duration, c Clock) Sample {
+	if UseNilMetrics {
+		return NilSample{}
+	}
+	if resolution <= 0 {
+		resolution = time.Second
+	}
+	n := int((window + resolution - 1) / resolution)
+	if n < 1 {
+		n = 1
+	}
+	s := &SlidingTimeWindowSample{
+		buckets:    make([]timeWindowBucket, n),
+		clock:      c,
+		resolution: resolution,
+		start:      c.Now(),
+	}
+	for i := range s.buckets {
+		s.buckets[i].tick = noTick
+	}
+	return s
+}
+
+// Clear clears all samples.
+func (s *SlidingTimeWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count = 0
+	for i := range s.buckets {
+		s.buckets[i] = timeWindowBucket{tick: noTick}
+	}
+}
+
+// Count returns the number of samples recorded, which may exceed the number
+// still within the window.
+func (s *SlidingTimeWindowSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value within the window.
+func (s *SlidingTimeWindowSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMax(s.values())
+}
+
+// Mean returns the mean of the values within the window.
+func (s *SlidingTimeWindowSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMean(s.values())
+}
+
+// Min returns the minimum value within the window.
+func (s *SlidingTimeWindowSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMin(s.values())
+}
+
+// Percentile returns an arbitrary percentile of values within the window.
+func (s *SlidingTimeWindowSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentile(s.values(), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values within the
+// window.
+func (s *SlidingTimeWindowSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentiles(s.values(), ps)
+}
+
+// Size returns the number of values within the window.
+func (s *SlidingTimeWindowSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.values())
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *SlidingTimeWindowSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &SampleSnapshot{
+		count:  s.count,
+		values: s.values(),
+	}
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *SlidingTimeWindowSample) SnapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &SampleSnapshot{
+		count:  s.count,
+		values: s.values(),
+	}
+	s.count = 0
+	for i := range s.buckets {
+		s.buckets[i] = timeWindowBucket{tick: noTick}
+	}
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values within the window.
+func (s *SlidingTimeWindowSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleStdDev(s.values())
+}
+
+// Sum returns the sum of the values within the window.
+func (s *SlidingTimeWindowSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleSum(s.values())
+}
+
+// Update samples a new value.
+func (s *SlidingTimeWindowSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	tick := s.tick()
+	b := &s.buckets[s.index(tick)]
+	if b.tick != tick {
+		b.tick = tick
+		b.values = b.values[:0]
+	}
+	b.values = append(b.values, v)
+}
+
+// Values returns a copy of the values within the window, oldest first.
+func (s *SlidingTimeWindowSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.values()
+}
+
+// Variance returns the variance of the values within the window.
+func (s *SlidingTimeWindowSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleVariance(s.values())
+}
+
+// index returns the bucket which holds the given tick, which may be negative
+// when the clock has moved backwards.
+func (s *SlidingTimeWindowSample) index(tick int64) int {
+	n := int64(len(s.buckets))
+	return int((tick%n + n) % n)
+}
+
+// tick returns the number of whole resolutions since the sample was
+// constructed, counted from the construction time rather than the Unix epoch
+// so that clocks reading before 1970 work.
+func (s *SlidingTimeWindowSample) tick() int64 {
+	d := s.clock.Now().Sub(s.start)
+	tick := int64(d / s.resolution)
+	if d < 0 && 0 != d%s.resolution {
+		tick--
+	}
+	return tick
+}
+
+// values returns a new slice of the values in buckets which are still within
+// the window.  It must be called with s.mutex held.
+func (s *SlidingTimeWindowSample) values() []int64 {
+	n := int64(len(s.buckets))
+	tick := s.tick()
+	size := 0
+	for _, b := range s.buckets {
+		if tick-n < b.tick {
+			size += len(b.values)
+		}
+	}
+	values := make([]int64, 0, size)
+	for t := tick - n + 1; t <= tick; t++ {
+		if b := &s.buckets[s.index(t)]; t == b.tick {
+			values = append(values, b.values...)
+		}
+	}
+	return values
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func BenchmarkSlidingTimeWindowSample(b *testing.B) {
+	benchmarkSample(b, NewSlidingTimeWindowSample(time.Minute, time.Second))
+}
+
+func TestSlidingTimeWindowSample(t *testing.T) {
+	c := NewManualClock(time.Unix(1000, 0))
+	s := NewSlidingTimeWindowSampleWithClock(time.Minute, time.Second, c)
+	s.Update(1000)
+	for i := 1; i <= 100; i++ {
+		c.Add(500 * time.Millisecond)
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 101 != count {
+		t.Errorf("s.Count(): 101 != %v\n", count)
+	}
+	if max := s.Max(); 1000 != max {
+		t.Errorf("s.Max(): 1000 != %v\n", max)
+	}
+	c.Add(10 * time.Second)
+	if max := s.Max(); 100 != max {
+		t.Errorf("s.Max() after the spike left the window: 100 != %v\n", max)
+	}
+	if min := s.Min(); 2 != min {
+		t.Errorf("s.Min(): 2 != %v\n", min)
+	}
+	if size := s.Size(); 99 != size {
+		t.Errorf("s.Size(): 99 != %v\n", size)
+	}
+	c.Add(time.Minute)
+	if size := s.Size(); 0 != size {
+		t.Errorf("s.Size(): 0 != %v\n", size)
+	}
+	if count := s.Count(); 101 != count {
+		t.Errorf("s.Count(): 101 != %v\n", count)
+	}
+}
+
+func TestSlidingTimeWindowSampleExpiry(t *testing.T) {
+	c := NewManualClock(time.Unix(0, 0))
+	s := NewSlidingTimeWindowSampleWithClock(time.Minute, time.Second, c)
+	c.Add(500 * time.Millisecond)
+	s.Update(47)
+	c.Add(59 * time.Second)
+	if values := s.Values(); 1 != len(values) || 47 != values[0] {
+		t.Errorf("s.Values() after 59s: %v\n", values)
+	}
+	c.Add(time.Second)
+	if values := s.Values(); 0 != len(values) {
+		t.Errorf("s.Values() after 60s: %v\n", values)
+	}
+}
+
+func TestSlidingTimeWindowSampleSnapshot(t *testing.T) {
+	c := NewManualClock(time.Now())
+	s := NewSlidingTimeWindowSampleWithClock(10*time.Second, time.Second, c)
+	s.Update(1)
+	s.Update(2)
+	snapshot := s.Snapshot()
+	c.Add(time.Minute)
+	s.Update(3)
+	if values := snapshot.Values(); 2 != len(values) || 1 != values[0] || 2 != values[1] {
+		t.Errorf("snapshot.Values(): %v\n", values)
+	}
+	if values := s.Values(); 1 != len(values) || 3 != values[0] {
+		t.Errorf("s.Values(): %v\n", values)
+	}
+	s.Clear()
+	if count, size := s.Count(), s.Size(); 0 != count || 0 != size {
+		t.Errorf("s.Count(), s.Size(): %v, %v\n", count, size)
+	}
+}
+
+func TestSlidingTimeWindowSampleZeroTime(t *testing.T) {
+	c := NewManualClock(time.Time{})
+	s := NewSlidingTimeWindowSampleWithClock(time.Minute, time.Second, c)
+	s.Update(1)
+	c.Add(-1500 * time.Millisecond)
+	s.Update(2)
+	if values := s.Values(); 1 != len(values) || 2 != values[0] {
+		t.Errorf("s.Values() after moving backwards: %v\n", values)
+	}
+	c.Add(1500 * time.Millisecond)
+	if values := s.Values(); 2 != len(values) || 2 != values[0] || 1 != values[1] {
+		t.Errorf("s.Values(): %v\n", values)
+	}
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import "sync"
+
+// SlidingWindowSample is a sample of exactly the last reservoirSize values
+// recorded, kept in a ring buffer so that each update is a single store.
+type SlidingWindowSample struct {
+	count  int64
+	mutex  sync.Mutex
+	values []int64
+}
+
+// NewSlidingWindowSample constructs a new sliding window sample which keeps
+// the last reservoirSize values.
+func NewSlidingWindowSample(reservoirSize int) Sample {
+	if UseNilMetrics {
+		return NilSample{}
+	}
+	return &SlidingWindowSample{values: make([]int64, reservoirSize)}
+}
+
+// Clear clears all samples.
+func (s *SlidingWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count = 0
+}
+
+// Count returns the number of samples recorded, which may exceed the
+// reservoir size.
+func (s *SlidingWindowSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum of the last values recorded.
+func (s *SlidingWindowSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMax(s.window())
+}
+
+// Mean returns the mean of the last values recorded.
+func (s *SlidingWindowSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMean(s.window())
+}
+
+// Min returns the minimum of the last values recorded.
+func (s *SlidingWindowSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMin(s.window())
+}
+
+// Percentile returns an arbitrary percentile of the last values recorded.
+func (s *SlidingWindowSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentile(s.ordered(), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the last values
+// recorded.
+func (s *SlidingWindowSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentiles(s.ordered(), ps)
+}
+
+// Size returns the size of the sample, which is at most the reservoir size.
+func (s *SlidingWindowSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.window())
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *SlidingWindowSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &SampleSnapshot{
+		count:  s.count,
+		values: s.ordered(),
+	}
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *SlidingWindowSample) SnapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &SampleSnapshot{
+		count:  s.count,
+		values: s.ordered(),
+	}
+	s.count = 0
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the last values recorded.
+func (s *SlidingWindowSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleStdDev(s.window())
+}
+
+// Sum returns the sum of the last values recorded.
+func (s *SlidingWindowSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleSum(s.window())
+}
+
+// Update samples a new value, replacing the oldest once the reservoir is
+// full.
+func (s *SlidingWindowSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == len(s.values) {
+		return
+	}
+	s.values[int(s.count%int64(len(s.values)))] = v
+	s.count++
+}
+
+// Values returns a copy of the last values recorded, oldest first.
+func (s *SlidingWindowSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ordered()
+}
+
+// Variance returns the variance of the last values recorded.
+func (s *SlidingWindowSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleVariance(s.window())
+}
+
+// window returns the part of the ring buffer which holds values, in no
+// particular order.  It must be called with s.mutex held.
+func (s *SlidingWindowSample) window() []int64 {
+	if s.count < int64(len(s.values)) {
+		return s.values[:s.count]
+	}
+	return s.values
+}
+
+// ordered returns a copy of the values in the ring buffer, oldest first.  It
+// must be called with s.mutex held.
+func (s *SlidingWindowSample) ordered() []int64 {
+	window := s.window()
+	values := make([]int64, 0, len(window))
+	if len(window) < len(s.values) {
+		return append(values, window...)
+	}
+	i := int(s.count % int64(len(s.values)))
+	values = append(values, s.values[i:]...)
+	return append(values, s.values[:i]...)
+}
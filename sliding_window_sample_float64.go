@@ -0,0 +1,163 @@
+package metrics
+
+import "sync"
+
+// SlidingWindowSampleFloat64 is a sliding window sample of float64 values just
+// like SlidingWindowSample.
+type SlidingWindowSampleFloat64 struct {
+	count  int64
+	mutex  sync.Mutex
+	values []float64
+}
+
+// NewSlidingWindowSampleFloat64 constructs a new sliding window sample of
+// float64 values which keeps the last reservoirSize values.
+func NewSlidingWindowSampleFloat64(reservoirSize int) SampleFloat64 {
+	if UseNilMetrics {
+		return NilSampleFloat64{}
+	}
+	return &SlidingWindowSampleFloat64{values: make([]float64, reservoirSize)}
+}
+
+// Clear clears all samples.
+func (s *SlidingWindowSampleFloat64) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count = 0
+}
+
+// Count returns the number of samples recorded, which may exceed the
+// reservoir size.
+func (s *SlidingWindowSampleFloat64) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum of the last values recorded.
+func (s *SlidingWindowSampleFloat64) Max() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMaxFloat64(s.window())
+}
+
+// Mean returns the mean of the last values recorded.
+func (s *SlidingWindowSampleFloat64) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMeanFloat64(s.window())
+}
+
+// Min returns the minimum of the last values recorded.
+func (s *SlidingWindowSampleFloat64) Min() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMinFloat64(s.window())
+}
+
+// Percentile returns an arbitrary percentile of the last values recorded.
+func (s *SlidingWindowSampleFloat64) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentileFloat64(s.ordered(), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the last values
+// recorded.
+func (s *SlidingWindowSampleFloat64) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentilesFloat64(s.ordered(), ps)
+}
+
+// Size returns the size of the sample, which is at most the reservoir size.
+func (s *SlidingWindowSampleFloat64) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.window())
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *SlidingWindowSampleFloat64) Snapshot() SampleFloat64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &SampleSnapshotFloat64{
+		count:  s.count,
+		values: s.ordered(),
+	}
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *SlidingWindowSampleFloat64) SnapshotAndClear() SampleFloat64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &SampleSnapshotFloat64{
+		count:  s.count,
+		values: s.ordered(),
+	}
+	s.count = 0
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the last values recorded.
+func (s *SlidingWindowSampleFloat64) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleStdDevFloat64(s.window())
+}
+
+// Sum returns the sum of the last values recorded.
+func (s *SlidingWindowSampleFloat64) Sum() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleSumFloat64(s.window())
+}
+
+// Update samples a new value, replacing the oldest once the reservoir is
+// full.
+func (s *SlidingWindowSampleFloat64) Update(v float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == len(s.values) {
+		return
+	}
+	s.values[int(s.count%int64(len(s.values)))] = v
+	s.count++
+}
+
+// Values returns a copy of the last values recorded, oldest first.
+func (s *SlidingWindowSampleFloat64) Values() []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ordered()
+}
+
+// Variance returns the variance of the last values recorded.
+func (s *SlidingWindowSampleFloat64) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleVarianceFloat64(s.window())
+}
+
+// window returns the part of the ring buffer which holds values, in no
+// particular order.  It must be called with s.mutex held.
+func (s *SlidingWindowSampleFloat64) window() []float64 {
+	if s.count < int64(len(s.values)) {
+		return s.values[:s.count]
+	}
+	return s.values
+}
+
+// ordered returns a copy of the values in the ring buffer, oldest first.  It
+// must be called with s.mutex held.
+func (s *SlidingWindowSampleFloat64) ordered() []float64 {
+	window := s.window()
+	values := make([]float64, 0, len(window))
+	if len(window) < len(s.values) {
+		return append(values, window...)
+	}
+	i := int(s.count % int64(len(s.values)))
+	values = append(values, s.values[i:]...)
+	return append(values, s.values[:i]...)
+}
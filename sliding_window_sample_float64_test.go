@@ -0,0 +1,23 @@
+package metrics
+
+import "testing"
+
+func TestSlidingWindowSampleFloat64(t *testing.T) {
+	h := NewHistogramFloat64(NewSlidingWindowSampleFloat64(4))
+	for _, v := range []float64{100, 0.5, 1.5, 2.5, 3.5} {
+		h.Update(v)
+	}
+	snapshot := h.Snapshot()
+	if count := snapshot.Count(); 5 != count {
+		t.Errorf("snapshot.Count(): 5 != %v\n", count)
+	}
+	if max := snapshot.Max(); 3.5 != max {
+		t.Errorf("snapshot.Max(): 3.5 != %v\n", max)
+	}
+	if sum := snapshot.Sum(); 8 != sum {
+		t.Errorf("snapshot.Sum(): 8 != %v\n", sum)
+	}
+	if values := snapshot.Sample().Values(); 0.5 != values[0] || 3.5 != values[3] {
+		t.Errorf("snapshot.Sample().Values(): %v\n", values)
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import "testing"
+
+func BenchmarkSlidingWindowSample(b *testing.B) {
+	benchmarkSample(b, NewSlidingWindowSample(1028))
+}
+
+func TestSlidingWindowSample(t *testing.T) {
+	s := NewSlidingWindowSample(100)
+	for i := 1; i <= 1000; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 1000 != count {
+		t.Errorf("s.Count(): 1000 != %v\n", count)
+	}
+	if size := s.Size(); 100 != size {
+		t.Errorf("s.Size(): 100 != %v\n", size)
+	}
+	if min, max := s.Min(), s.Max(); 901 != min || 1000 != max {
+		t.Errorf("s.Min(), s.Max(): %v, %v\n", min, max)
+	}
+	if mean := s.Mean(); 950.5 != mean {
+		t.Errorf("s.Mean(): 950.5 != %v\n", mean)
+	}
+	values := s.Values()
+	for i, v := range values {
+		if int64(901+i) != v {
+			t.Fatalf("s.Values(): %v\n", values)
+		}
+	}
+	if p50 := s.Percentile(0.5); 950.5 != p50 {
+		t.Errorf("s.Percentile(0.5): 950.5 != %v\n", p50)
+	}
+	if values := s.Values(); 901 != values[0] {
+		t.Errorf("s.Values() reordered by s.Percentile: %v\n", values)
+	}
+}
+
+func TestSlidingWindowSamplePartial(t *testing.T) {
+	s := NewSlidingWindowSample(100)
+	s.Update(3)
+	s.Update(1)
+	s.Update(2)
+	snapshot := s.Snapshot()
+	s.Clear()
+	if values := snapshot.Values(); 3 != len(values) || 3 != values[0] || 2 != values[2] {
+		t.Errorf("snapshot.Values(): %v\n", values)
+	}
+	if count, size := s.Count(), s.Size(); 0 != count || 0 != size {
+		t.Errorf("s.Count(), s.Size(): %v, %v\n", count, size)
+	}
+}
@@ -2,22 +2,51 @@
 package stathat
 
 import (
+	"context"
+	"time"
+
 	"github.com/rcrowley/go-metrics"
 	"github.com/stathat/go"
-	"log"
-	"time"
 )
 
 func Stathat(r metrics.Registry, d time.Duration, userkey string) {
-	for {
-		if err := sh(r, userkey); nil != err {
-			log.Println(err)
-		}
-		time.Sleep(d)
-	}
+	StathatContext(context.Background(), r, d, userkey, nil)
+}
+
+// StathatContext is just like Stathat, but it returns after a final flush
+// once ctx is done and passes each failed flush to onError instead of logging
+// it.
+func StathatContext(ctx context.Context, r metrics.Registry, d time.Duration, userkey string, onError func(error)) {
+	StathatContextWithOptions(ctx, r, d, userkey, metrics.OutputOptions{}, onError)
+}
+
+// StathatContextWithOptions is just like StathatContext, but it posts the
+// percentiles and fields chosen by o, under names such as
+// "latency.999-percentile", and timings in o.DurationUnit.
+func StathatContextWithOptions(ctx context.Context, r metrics.Registry, d time.Duration, userkey string, o metrics.OutputOptions, onError func(error)) {
+	metrics.RunReporter(ctx, d, func() error { return sh(r, userkey, o) }, onError)
 }
 
-func sh(r metrics.Registry, userkey string) error {
+func sh(r metrics.Registry, userkey string, o metrics.OutputOptions) error {
+	o = o.WithDefaults()
+	du := float64(o.DurationUnit)
+	count := func(name string, n int64) {
+		if o.Has(metrics.FieldCount) {
+			stathat.PostEZCount(name+".count", userkey, int(n))
+		}
+	}
+	value := func(f metrics.Fields, name string, v float64) {
+		if o.Has(f) {
+			stathat.PostEZValue(name, userkey, v)
+		}
+	}
+	percentiles := func(name string, s interface{ Percentiles([]float64) []float64 }, div float64) {
+		if o.Has(metrics.FieldPercentiles) {
+			for i, p := range s.Percentiles(o.Percentiles) {
+				stathat.PostEZValue(name+"."+metrics.PercentileKey(o.Percentiles[i])+"-percentile", userkey, p/div)
+			}
+		}
+	}
 	r.Each(func(name string, i interface{}) {
 		switch metric := i.(type) {
 		case metrics.Counter:
@@ -28,41 +57,39 @@ func sh(r metrics.Registry, userkey string) error {
 			stathat.PostEZValue(name, userkey, float64(metric.Value()))
 		case metrics.Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			stathat.PostEZCount(name+".count", userkey, int(h.Count()))
-			stathat.PostEZValue(name+".min", userkey, float64(h.Min()))
-			stathat.PostEZValue(name+".max", userkey, float64(h.Max()))
-			stathat.PostEZValue(name+".mean", userkey, float64(h.Mean()))
-			stathat.PostEZValue(name+".std-dev", userkey, float64(h.StdDev()))
-			stathat.PostEZValue(name+".50-percentile", userkey, float64(ps[0]))
-			stathat.PostEZValue(name+".75-percentile", userkey, float64(ps[1]))
-			stathat.PostEZValue(name+".95-percentile", userkey, float64(ps[2]))
-			stathat.PostEZValue(name+".99-percentile", userkey, float64(ps[3]))
-			stathat.PostEZValue(name+".999-percentile", userkey, float64(ps[4]))
+			count(name, h.Count())
+			value(metrics.FieldMin, name+".min", float64(h.Min()))
+			value(metrics.FieldMax, name+".max", float64(h.Max()))
+			value(metrics.FieldMean, name+".mean", h.Mean())
+			value(metrics.FieldStdDev, name+".std-dev", h.StdDev())
+			percentiles(name, h, 1)
+		case metrics.HistogramFloat64:
+			h := metric.Snapshot()
+			count(name, h.Count())
+			value(metrics.FieldMin, name+".min", h.Min())
+			value(metrics.FieldMax, name+".max", h.Max())
+			value(metrics.FieldMean, name+".mean", h.Mean())
+			value(metrics.FieldStdDev, name+".std-dev", h.StdDev())
+			percentiles(name, h, 1)
 		case metrics.Meter:
 			m := metric.Snapshot()
-			stathat.PostEZCount(name+".count", userkey, int(m.Count()))
-			stathat.PostEZValue(name+".one-minute", userkey, float64(m.Rate1()))
-			stathat.PostEZValue(name+".five-minute", userkey, float64(m.Rate5()))
-			stathat.PostEZValue(name+".fifteen-minute", userkey, float64(m.Rate15()))
-			stathat.PostEZValue(name+".mean", userkey, float64(m.RateMean()))
+			count(name, m.Count())
+			value(metrics.FieldRates, name+".one-minute", m.Rate1())
+			value(metrics.FieldRates, name+".five-minute", m.Rate5())
+			value(metrics.FieldRates, name+".fifteen-minute", m.Rate15())
+			value(metrics.FieldRates, name+".mean", m.RateMean())
 		case metrics.Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			stathat.PostEZCount(name+".count", userkey, int(t.Count()))
-			stathat.PostEZValue(name+".min", userkey, float64(t.Min()))
-			stathat.PostEZValue(name+".max", userkey, float64(t.Max()))
-			stathat.PostEZValue(name+".mean", userkey, float64(t.Mean()))
-			stathat.PostEZValue(name+".std-dev", userkey, float64(t.StdDev()))
-			stathat.PostEZValue(name+".50-percentile", userkey, float64(ps[0]))
-			stathat.PostEZValue(name+".75-percentile", userkey, float64(ps[1]))
-			stathat.PostEZValue(name+".95-percentile", userkey, float64(ps[2]))
-			stathat.PostEZValue(name+".99-percentile", userkey, float64(ps[3]))
-			stathat.PostEZValue(name+".999-percentile", userkey, float64(ps[4]))
-			stathat.PostEZValue(name+".one-minute", userkey, float64(t.Rate1()))
-			stathat.PostEZValue(name+".five-minute", userkey, float64(t.Rate5()))
-			stathat.PostEZValue(name+".fifteen-minute", userkey, float64(t.Rate15()))
-			stathat.PostEZValue(name+".mean-rate", userkey, float64(t.RateMean()))
+			count(name, t.Count())
+			value(metrics.FieldMin, name+".min", float64(t.Min())/du)
+			value(metrics.FieldMax, name+".max", float64(t.Max())/du)
+			value(metrics.FieldMean, name+".mean", t.Mean()/du)
+			value(metrics.FieldStdDev, name+".std-dev", t.StdDev()/du)
+			percentiles(name, t, du)
+			value(metrics.FieldRates, name+".one-minute", t.Rate1())
+			value(metrics.FieldRates, name+".five-minute", t.Rate5())
+			value(metrics.FieldRates, name+".fifteen-minute", t.Rate15())
+			value(metrics.FieldRates, name+".mean-rate", t.RateMean())
 		}
 	})
 	return nil
@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsDConfig provides a container with configuration parameters for
+// the StatsD exporter
+type StatsDConfig struct {
+	Addr          *net.UDPAddr  // Network address to send datagrams to
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	DurationUnit  time.Duration // Time conversion unit for durations
+	Prefix        string        // Prefix to be prepended to metric names
+	Percentiles   []float64     // Percentiles to export from timers and histograms
+	MaxPacketSize int           // Largest datagram to send, 1432 bytes if zero
+	DogStatsD     bool          // Send tags with the DogStatsD extension
+}
+
+// StatsD is a blocking exporter function which reports metrics in r
+// to a StatsD server located at addr, flushing them every d duration
+// and prepending metric names with prefix.
+func StatsD(r Registry, d time.Duration, prefix string, addr *net.UDPAddr) {
+	StatsDWithConfig(StatsDConfig{
+		Addr:          addr,
+		Registry:      r,
+		FlushInterval: d,
+		DurationUnit:  time.Millisecond,
+		Prefix:        prefix,
+		Percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
+	})
+}
+
+// StatsDWithConfig is a blocking exporter function just like StatsD,
+// but it takes a StatsDConfig instead.
+func StatsDWithConfig(c StatsDConfig) {
+	StatsDContext(context.Background(), c, nil)
+}
+
+// StatsDContext is a blocking exporter function just like StatsDWithConfig,
+// but it returns after a final flush once ctx is done and passes each failed
+// flush to onError instead of logging it.
+func StatsDContext(ctx context.Context, c StatsDConfig, onError func(error)) {
+	s := NewStatsDReporter(c)
+	defer s.Close()
+	RunReporter(ctx, c.FlushInterval, s.Flush, onError)
+}
+
+// StatsDReporter sends the metrics in a registry to StatsD.  It remembers
+// what it sent on the previous flush so that counters, meters and the counts
+// of histograms and timers are sent as deltas, as StatsD expects.
+//
+// Histograms and timers are summarised before they are sent: each of the
+// min, max, mean, standard deviation and configured percentiles is sent as a
+// gauge, so that the server does not aggregate the statistics again.
+type StatsDReporter struct {
+	c      StatsDConfig
+	conn   *net.UDPConn
+	counts map[string]int64
+}
+
+// NewStatsDReporter constructs a new StatsDReporter.
+func NewStatsDReporter(c StatsDConfig) *StatsDReporter {
+	if 0 == c.DurationUnit {
+		c.DurationUnit = time.Millisecond
+	}
+	if 0 == c.MaxPacketSize {
+		c.MaxPacketSize = 1432
+	}
+	return &StatsDReporter{c: c, counts: make(map[string]int64)}
+}
+
+// Flush sends every metric in the registry, packing as many lines as fit
+// into each datagram.  It returns the first error encountered.
+func (s *StatsDReporter) Flush() error {
+	if nil == s.conn {
+		conn, err := net.DialUDP("udp", nil, s.c.Addr)
+		if nil != err {
+			return err
+		}
+		s.conn = conn
+	}
+	w := &packetWriter{conn: s.conn, size: s.c.MaxPacketSize}
+	du := float64(s.c.DurationUnit)
+	seen := make(map[string]bool, len(s.counts))
+	delta := func(key string, count int64) int64 {
+		seen[key] = true
+		d := count - s.counts[key]
+		s.counts[key] = count
+		return d
+	}
+	s.c.Registry.EachTagged(func(name string, tags Tags, i interface{}) {
+		key := MetricID{name, tags}.String()
+		var suffix string
+		if s.c.DogStatsD {
+			suffix = statsDTags(tags)
+		} else {
+			name = graphiteName(name, tags)
+		}
+		if "" != s.c.Prefix {
+			name = s.c.Prefix + "." + name
+		}
+		name = statsDReplacer.Replace(name)
+		line := func(name, value, typ string) {
+			w.add(name + ":" + value + "|" + typ + suffix)
+		}
+		gauge := func(name, value string) {
+			if strings.HasPrefix(value, "-") {
+				// A signed gauge value is a relative change in StatsD, so
+				// a negative value has to be set from zero.
+				line(name, "0", "g")
+			}
+			line(name, value, "g")
+		}
+		switch metric := i.(type) {
+		case Counter:
+			line(name, strconv.FormatInt(delta(key, metric.Count()), 10), "c")
+		case Gauge:
+			gauge(name, strconv.FormatInt(metric.Value(), 10))
+		case GaugeFloat64:
+			gauge(name, strconv.FormatFloat(metric.Value(), 'f', -1, 64))
+		case Histogram:
+			h := metric.Snapshot()
+			ps := h.Percentiles(s.c.Percentiles)
+			line(name+".count", strconv.FormatInt(delta(key, h.Count()), 10), "c")
+			if 0 == h.Count() {
+				break
+			}
+			gauge(name+".min", strconv.FormatInt(h.Min(), 10))
+			gauge(name+".max", strconv.FormatInt(h.Max(), 10))
+			gauge(name+".mean", statsDFloat(h.Mean()))
+			gauge(name+".std-dev", statsDFloat(h.StdDev()))
+			for psIdx, psKey := range s.c.Percentiles {
+				psName := PercentileKey(psKey)
+				gauge(name+"."+psName+"-percentile", statsDFloat(ps[psIdx]))
+			}
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			ps := h.Percentiles(s.c.Percentiles)
+			line(name+".count", strconv.FormatInt(delta(key, h.Count()), 10), "c")
+			if 0 == h.Count() {
+				break
+			}
+			gauge(name+".min", statsDFloat(h.Min()))
+			gauge(name+".max", statsDFloat(h.Max()))
+			gauge(name+".mean", statsDFloat(h.Mean()))
+			gauge(name+".std-dev", statsDFloat(h.StdDev()))
+			for psIdx, psKey := range s.c.Percentiles {
+				psName := PercentileKey(psKey)
+				gauge(name+"."+psName+"-percentile", statsDFloat(ps[psIdx]))
+			}
+		case Meter:
+			m := metric.Snapshot()
+			line(name, strconv.FormatInt(delta(key, m.Count()), 10), "c")
+		case Timer:
+			t := metric.Snapshot()
+			ps := t.Percentiles(s.c.Percentiles)
+			line(name+".count", strconv.FormatInt(delta(key, t.Count()), 10), "c")
+			if 0 == t.Count() {
+				break
+			}
+			gauge(name+".min", statsDFloat(float64(t.Min())/du))
+			gauge(name+".max", statsDFloat(float64(t.Max())/du))
+			gauge(name+".mean", statsDFloat(t.Mean()/du))
+			gauge(name+".std-dev", statsDFloat(t.StdDev()/du))
+			for psIdx, psKey := range s.c.Percentiles {
+				psName := PercentileKey(psKey)
+				gauge(name+"."+psName+"-percentile", statsDFloat(ps[psIdx]/du))
+			}
+		}
+	})
+	for key := range s.counts {
+		if !seen[key] {
+			delete(s.counts, key)
+		}
+	}
+	w.flush()
+	return w.err
+}
+
+// Close closes the reporter's socket.
+func (s *StatsDReporter) Close() error {
+	if nil == s.conn {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+var statsDReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", "\n", "_")
+
+var statsDTagReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "\n", "_")
+
+// statsDTags renders tags with the DogStatsD extension, in sorted key order.
+func statsDTags(tags Tags) string {
+	if 0 == len(tags) {
+		return ""
+	}
+	list := make([]string, 0, len(tags))
+	for _, k := range tags.Keys() {
+		list = append(list, statsDTagReplacer.Replace(k)+":"+statsDTagReplacer.Replace(tags[k]))
+	}
+	return "|#" + strings.Join(list, ",")
+}
+
+func statsDFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// packetWriter packs newline-separated lines into datagrams no larger than
+// size bytes.  A single line longer than size is sent on its own.
+type packetWriter struct {
+	conn net.Conn
+	size int
+	buf  bytes.Buffer
+	err  error
+}
+
+func (w *packetWriter) add(line string) {
+	if 0 < w.buf.Len() && w.buf.Len()+1+len(line) > w.size {
+		w.flush()
+	}
+	if 0 < w.buf.Len() {
+		w.buf.WriteByte('\n')
+	}
+	w.buf.WriteString(line)
+}
+
+func (w *packetWriter) flush() {
+	if 0 == w.buf.Len() {
+		return
+	}
+	if _, err := w.conn.Write(w.buf.Bytes()); nil != err && nil == w.err {
+		w.err = err
+	}
+	w.buf.Reset()
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleStatsD() {
+	addr, _ := net.ResolveUDPAddr("udp", ":8125")
+	go StatsD(DefaultRegistry, 1*time.Second, "some.prefix", addr)
+}
+
+func newStatsDTestServer(t *testing.T) *net.UDPConn {
+	addr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	conn, err := net.ListenUDP("udp", addr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func readStatsDPackets(t *testing.T, conn *net.UDPConn) []string {
+	var packets []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if nil != err {
+			return packets
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+}
+
+func TestStatsDCounterDelta(t *testing.T) {
+	conn := newStatsDTestServer(t)
+	defer conn.Close()
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	s := NewStatsDReporter(StatsDConfig{
+		Addr:     conn.LocalAddr().(*net.UDPAddr),
+		Registry: r,
+		Prefix:   "app",
+	})
+	defer s.Close()
+	c.Inc(5)
+	if err := s.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	c.Inc(2)
+	if err := s.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	packets := readStatsDPackets(t, conn)
+	if 2 != len(packets) || "app.foo:5|c" != packets[0] || "app.foo:2|c" != packets[1] {
+		t.Fatal(packets)
+	}
+}
+
+func TestStatsDGaugeAndTags(t *testing.T) {
+	conn := newStatsDTestServer(t)
+	defer conn.Close()
+	r := NewRegistry()
+	g := NewGauge()
+	r.RegisterTagged("temp", Tags{"room": "a"}, g)
+	g.Update(-3)
+	s := NewStatsDReporter(StatsDConfig{
+		Addr:      conn.LocalAddr().(*net.UDPAddr),
+		Registry:  r,
+		DogStatsD: true,
+	})
+	defer s.Close()
+	if err := s.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	packets := readStatsDPackets(t, conn)
+	if 1 != len(packets) || "temp:0|g|#room:a\ntemp:-3|g|#room:a" != packets[0] {
+		t.Fatal(packets)
+	}
+}
+
+func TestStatsDPacking(t *testing.T) {
+	conn := newStatsDTestServer(t)
+	defer conn.Close()
+	r := NewRegistry()
+	tm := NewRegisteredTimer("latency", r)
+	tm.Update(2 * time.Millisecond)
+	s := NewStatsDReporter(StatsDConfig{
+		Addr:          conn.LocalAddr().(*net.UDPAddr),
+		Registry:      r,
+		Percentiles:   []float64{0.5, 0.99},
+		MaxPacketSize: 64,
+	})
+	defer s.Close()
+	if err := s.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	packets := readStatsDPackets(t, conn)
+	var lines []string
+	for _, p := range packets {
+		if 64 < len(p) {
+			t.Fatal(p)
+		}
+		lines = append(lines, strings.Split(p, "\n")...)
+	}
+	if 1 == len(packets) || 7 != len(lines) {
+		t.Fatal(packets)
+	}
+	if "latency.count:1|c" != lines[0] || "latency.99-percentile:2.00|g" != lines[6] {
+		t.Fatal(lines)
+	}
+}
+
+func TestStatsDHistogramGauges(t *testing.T) {
+	conn := newStatsDTestServer(t)
+	defer conn.Close()
+	r := NewRegistry()
+	h := NewRegisteredHistogram("size", r, NewUniformSample(10))
+	h.Update(-2)
+	h.Update(4)
+	s := NewStatsDReporter(StatsDConfig{
+		Addr:        conn.LocalAddr().(*net.UDPAddr),
+		Registry:    r,
+		Percentiles: []float64{0.5},
+	})
+	defer s.Close()
+	if err := s.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	packets := readStatsDPackets(t, conn)
+	expected := "size.count:2|c\nsize.min:0|g\nsize.min:-2|g\nsize.max:4|g\nsize.mean:1.00|g\nsize.std-dev:3.00|g\nsize.50-percentile:1.00|g"
+	if 1 != len(packets) || expected != packets[0] {
+		t.Fatal(packets)
+	}
+}
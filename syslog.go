@@ -3,76 +3,110 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"log/syslog"
+	"strings"
 	"time"
 )
 
 // Output each metric in the given registry to syslog periodically using
 // the given syslogger.
 func Syslog(r Registry, d time.Duration, w *syslog.Writer) {
-	for _ = range time.Tick(d) {
-		r.Each(func(name string, i interface{}) {
-			switch metric := i.(type) {
-			case Counter:
-				w.Info(fmt.Sprintf("counter %s: count: %d", name, metric.Count()))
-			case Gauge:
-				w.Info(fmt.Sprintf("gauge %s: value: %d", name, metric.Value()))
-			case GaugeFloat64:
-				w.Info(fmt.Sprintf("gauge %s: value: %f", name, metric.Value()))
-			case Healthcheck:
-				metric.Check()
-				w.Info(fmt.Sprintf("healthcheck %s: error: %v", name, metric.Error()))
-			case Histogram:
-				h := metric.Snapshot()
-				ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				w.Info(fmt.Sprintf(
-					"histogram %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f median: %.2f 75%%: %.2f 95%%: %.2f 99%%: %.2f 99.9%%: %.2f",
-					name,
-					h.Count(),
-					h.Min(),
-					h.Max(),
-					h.Mean(),
-					h.StdDev(),
-					ps[0],
-					ps[1],
-					ps[2],
-					ps[3],
-					ps[4],
-				))
-			case Meter:
-				m := metric.Snapshot()
-				w.Info(fmt.Sprintf(
-					"meter %s: count: %d 1-min: %.2f 5-min: %.2f 15-min: %.2f mean: %.2f",
-					name,
-					m.Count(),
-					m.Rate1(),
-					m.Rate5(),
-					m.Rate15(),
-					m.RateMean(),
-				))
-			case Timer:
-				t := metric.Snapshot()
-				ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				w.Info(fmt.Sprintf(
-					"timer %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f median: %.2f 75%%: %.2f 95%%: %.2f 99%%: %.2f 99.9%%: %.2f 1-min: %.2f 5-min: %.2f 15-min: %.2f mean-rate: %.2f",
-					name,
-					t.Count(),
-					t.Min(),
-					t.Max(),
-					t.Mean(),
-					t.StdDev(),
-					ps[0],
-					ps[1],
-					ps[2],
-					ps[3],
-					ps[4],
-					t.Rate1(),
-					t.Rate5(),
-					t.Rate15(),
-					t.RateMean(),
-				))
-			}
-		})
+	SyslogContext(context.Background(), r, d, w, nil)
+}
+
+// SyslogContext is just like Syslog, but it returns after a final flush once
+// ctx is done and passes each failed flush to onError instead of logging it.
+func SyslogContext(ctx context.Context, r Registry, d time.Duration, w *syslog.Writer, onError func(error)) {
+	SyslogContextWithOptions(ctx, r, d, w, OutputOptions{}, onError)
+}
+
+// SyslogContextWithOptions is just like SyslogContext, but it writes the
+// percentiles and fields chosen by o and timings in o.DurationUnit.
+func SyslogContextWithOptions(ctx context.Context, r Registry, d time.Duration, w *syslog.Writer, o OutputOptions, onError func(error)) {
+	RunReporter(ctx, d, func() error { return syslogOnce(r, w, o) }, onError)
+}
+
+// syslogOnce writes each metric to syslog, returning the first error.
+func syslogOnce(r Registry, w *syslog.Writer, o OutputOptions) error {
+	o = o.WithDefaults()
+	du := float64(o.DurationUnit)
+	var err error
+	info := func(m string) {
+		if e := w.Info(m); nil != e && nil == err {
+			err = e
+		}
 	}
+	r.Each(func(name string, i interface{}) {
+		var fields []string
+		add := func(f Fields, format string, v ...interface{}) {
+			if o.Has(f) {
+				fields = append(fields, fmt.Sprintf(format, v...))
+			}
+		}
+		percentiles := func(s interface{ Percentiles([]float64) []float64 }, div float64) {
+			if o.Has(FieldPercentiles) {
+				for i, p := range s.Percentiles(o.Percentiles) {
+					fields = append(fields, fmt.Sprintf("%s: %.2f", PercentileLabel(o.Percentiles[i]), p/div))
+				}
+			}
+		}
+		switch metric := i.(type) {
+		case Counter:
+			info(fmt.Sprintf("counter %s: count: %d", name, metric.Count()))
+		case Gauge:
+			info(fmt.Sprintf("gauge %s: value: %d", name, metric.Value()))
+		case GaugeFloat64:
+			info(fmt.Sprintf("gauge %s: value: %f", name, metric.Value()))
+		case Healthcheck:
+			metric.Check()
+			info(fmt.Sprintf("healthcheck %s: error: %v", name, metric.Error()))
+		case Histogram:
+			h := metric.Snapshot()
+			add(FieldCount, "count: %d", h.Count())
+			add(FieldMin, "min: %d", h.Min())
+			add(FieldMax, "max: %d", h.Max())
+			add(FieldMean, "mean: %.2f", h.Mean())
+			add(FieldStdDev, "stddev: %.2f", h.StdDev())
+			percentiles(h, 1)
+			info(fmt.Sprintf("histogram %s: %s", name, strings.Join(fields, " ")))
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			add(FieldCount, "count: %d", h.Count())
+			add(FieldMin, "min: %f", h.Min())
+			add(FieldMax, "max: %f", h.Max())
+			add(FieldMean, "mean: %.2f", h.Mean())
+			add(FieldStdDev, "stddev: %.2f", h.StdDev())
+			percentiles(h, 1)
+			info(fmt.Sprintf("histogram %s: %s", name, strings.Join(fields, " ")))
+		case Meter:
+			m := metric.Snapshot()
+			add(FieldCount, "count: %d", m.Count())
+			add(FieldRates, "1-min: %.2f", m.Rate1())
+			add(FieldRates, "5-min: %.2f", m.Rate5())
+			add(FieldRates, "15-min: %.2f", m.Rate15())
+			add(FieldRates, "mean: %.2f", m.RateMean())
+			info(fmt.Sprintf("meter %s: %s", name, strings.Join(fields, " ")))
+		case Timer:
+			t := metric.Snapshot()
+			add(FieldCount, "count: %d", t.Count())
+			if 1 == du {
+				add(FieldMin, "min: %d", t.Min())
+				add(FieldMax, "max: %d", t.Max())
+			} else {
+				add(FieldMin, "min: %.2f", float64(t.Min())/du)
+				add(FieldMax, "max: %.2f", float64(t.Max())/du)
+			}
+			add(FieldMean, "mean: %.2f", t.Mean()/du)
+			add(FieldStdDev, "stddev: %.2f", t.StdDev()/du)
+			percentiles(t, du)
+			add(FieldRates, "1-min: %.2f", t.Rate1())
+			add(FieldRates, "5-min: %.2f", t.Rate5())
+			add(FieldRates, "15-min: %.2f", t.Rate15())
+			add(FieldRates, "mean-rate: %.2f", t.RateMean())
+			info(fmt.Sprintf("timer %s: %s", name, strings.Join(fields, " ")))
+		}
+	})
+	return err
 }
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Tags hold the key/value pairs which, along with a name, identify a
+// labelled metric.
+type Tags map[string]string
+
+// Copy returns a copy of the tags so that later changes to the receiver are
+// not observed by the copy.
+func (t Tags) Copy() Tags {
+	if 0 == len(t) {
+		return nil
+	}
+	tags := make(Tags, len(t))
+	for k, v := range t {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Keys returns the tag keys in sorted order.
+func (t Tags) Keys() []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns the canonical form of the tags, which is "{k1=v1,k2=v2}"
+// with keys in sorted order, or the empty string if there are no tags.
+// Backslashes, commas, equals signs and braces in keys and values are
+// escaped with a backslash.
+func (t Tags) String() string {
+	if 0 == len(t) {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range t.Keys() {
+		if 0 < i {
+			b.WriteByte(',')
+		}
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(t[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// MetricID is the identity of a metric in a Registry: its name plus an
+// optional set of tags.
+type MetricID struct {
+	Name string
+	Tags Tags
+}
+
+// String returns the canonical form of the identity, which is the name
+// followed by the canonical form of the tags.  Backslashes and braces in the
+// name are escaped with a backslash so that no two identities share a
+// canonical form.  Untagged metrics are otherwise identified by their name
+// alone.
+func (id MetricID) String() string {
+	return nameEscaper.Replace(id.Name) + id.Tags.String()
+}
+
+var (
+	nameEscaper   = strings.NewReplacer(`\`, `\\`, "{", `\{`, "}", `\}`)
+	nameUnescaper = strings.NewReplacer(`\\`, `\`, `\{`, "{", `\}`, "}")
+	tagEscaper    = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, "{", `\{`, "}", `\}`)
+)
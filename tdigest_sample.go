@@ -0,0 +1,459 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Centroid is a cluster of values in a t-digest, summarised by their mean and
+// how many of them there are.
+type Centroid struct {
+	Mean  float64 `json:"mean"`
+	Count int64   `json:"count"`
+}
+
+// Digest is the exported form of a t-digest: its centroids in ascending order
+// of mean along with the exact minimum and maximum of the values they hold,
+// which the extreme centroids only approximate.
+type Digest struct {
+	Centroids []Centroid `json:"centroids"`
+	Min       float64    `json:"min"`
+	Max       float64    `json:"max"`
+}
+
+// TDigestSample is a sample backed by a t-digest, which clusters values into
+// centroids that are smallest near the extremes, so that tail percentiles are
+// accurate while memory stays bounded by the compression.  Digests of the
+// same stream taken by several processes or shards can be combined by passing
+// the Digest of each to Merge.
+//
+// <https://github.com/tdunning/t-digest>
+type TDigestSample struct {
+	mutex sync.Mutex
+	d     *tdigest
+}
+
+// NewTDigestSample constructs a new t-digest sample with the given
+// compression.  Higher compression keeps more centroids and gives more
+// accurate percentiles; 100 is a good default.
+func NewTDigestSample(compression float64) Sample {
+	if UseNilMetrics {
+		return NilSample{}
+	}
+	return &TDigestSample{d: newTDigest(compression)}
+}
+
+// Digest returns the centroids, minimum and maximum of the digest.
+func (s *TDigestSample) Digest() Digest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.digest()
+}
+
+// Clear clears all samples.
+func (s *TDigestSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.clear()
+}
+
+// Count returns the number of samples recorded, including those merged.
+func (s *TDigestSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.count
+}
+
+// Max returns the maximum value in the sample.
+func (s *TDigestSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return int64(s.d.max)
+}
+
+// Mean returns the mean of the values in the sample.
+func (s *TDigestSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.mean()
+}
+
+// Merge adds another digest, such as one returned by the Digest method of a
+// TDigestSample in another process, to this one.
+func (s *TDigestSample) Merge(d Digest) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.merge(d)
+}
+
+// Min returns the minimum value in the sample.
+func (s *TDigestSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return int64(s.d.min)
+}
+
+// Percentile returns an arbitrary percentile of values in the sample.
+func (s *TDigestSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.quantile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// sample.
+func (s *TDigestSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.quantiles(ps)
+}
+
+// Size returns the number of centroids in the digest.
+func (s *TDigestSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.compress()
+	return len(s.d.centroids)
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *TDigestSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &TDigestSampleSnapshot{d: s.d.copy()}
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *TDigestSample) SnapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &TDigestSampleSnapshot{d: s.d.copy()}
+	s.d.clear()
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (s *TDigestSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return math.Sqrt(s.d.variance())
+}
+
+// Sum returns the sum of the values in the sample.
+func (s *TDigestSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return int64(math.Floor(s.d.sum + 0.5))
+}
+
+// Update samples a new value.
+func (s *TDigestSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.add(float64(v), 1)
+}
+
+// Values returns the rounded mean of each centroid in ascending order.
+func (s *TDigestSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.int64Values()
+}
+
+// Variance returns the variance of the values in the sample, estimated from
+// the centroids.
+func (s *TDigestSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.variance()
+}
+
+// checkpoint returns the digest.
+func (s *TDigestSample) checkpoint() *persistedState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	d := s.d.digest()
+	return &persistedState{Count: s.d.count, Digest: &d}
+}
+
+// restore merges the digest of a checkpoint into the sample.
+func (s *TDigestSample) restore(st *persistedState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if nil != st.Digest {
+		s.d.merge(*st.Digest)
+	}
+}
+
+// TDigestSampleSnapshot is a read-only copy of a TDigestSample.
+type TDigestSampleSnapshot struct {
+	d *tdigest
+}
+
+// Digest returns the centroids, minimum and maximum of the digest at the time
+// the snapshot was taken.
+func (s *TDigestSampleSnapshot) Digest() Digest { return s.d.digest() }
+
+// Clear panics.
+func (*TDigestSampleSnapshot) Clear() {
+	panic("Clear called on a TDigestSampleSnapshot")
+}
+
+// Count returns the count of inputs at the time the snapshot was taken.
+func (s *TDigestSampleSnapshot) Count() int64 { return s.d.count }
+
+// Max returns the maximal value at the time the snapshot was taken.
+func (s *TDigestSampleSnapshot) Max() int64 { return int64(s.d.max) }
+
+// Mean returns the mean value at the time the snapshot was taken.
+func (s *TDigestSampleSnapshot) Mean() float64 { return s.d.mean() }
+
+// Min returns the minimal value at the time the snapshot was taken.
+func (s *TDigestSampleSnapshot) Min() int64 { return int64(s.d.min) }
+
+// Percentile returns an arbitrary percentile of values at the time the
+// snapshot was taken.
+func (s *TDigestSampleSnapshot) Percentile(p float64) float64 {
+	return s.d.quantile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values at the time
+// the snapshot was taken.
+func (s *TDigestSampleSnapshot) Percentiles(ps []float64) []float64 {
+	return s.d.quantiles(ps)
+}
+
+// Size returns the number of centroids at the time the snapshot was taken.
+func (s *TDigestSampleSnapshot) Size() int { return len(s.d.centroids) }
+
+// Snapshot returns the snapshot.
+func (s *TDigestSampleSnapshot) Snapshot() Sample { return s }
+
+// SnapshotAndClear panics.
+func (*TDigestSampleSnapshot) SnapshotAndClear() Sample {
+	panic("SnapshotAndClear called on a TDigestSampleSnapshot")
+}
+
+// StdDev returns the standard deviation of values at the time the snapshot
+// was taken.
+func (s *TDigestSampleSnapshot) StdDev() float64 { return math.Sqrt(s.d.variance()) }
+
+// Sum returns the sum of values at the time the snapshot was taken.
+func (s *TDigestSampleSnapshot) Sum() int64 { return int64(math.Floor(s.d.sum + 0.5)) }
+
+// Update panics.
+func (*TDigestSampleSnapshot) Update(int64) {
+	panic("Update called on a TDigestSampleSnapshot")
+}
+
+// Values returns the rounded mean of each centroid at the time the snapshot
+// was taken.
+func (s *TDigestSampleSnapshot) Values() []int64 { return s.d.int64Values() }
+
+// Variance returns the variance of values at the time the snapshot was taken.
+func (s *TDigestSampleSnapshot) Variance() float64 { return s.d.variance() }
+
+// tdigest is the unsynchronized merging t-digest behind TDigestSample and
+// TDigestSampleFloat64.  New values are buffered and merged into the sorted
+// centroids once the buffer fills or the digest is read.  Adjacent centroids
+// are merged as long as the result spans no more than one unit of the scale
+// function k(q) = compression / 2pi * asin(2q - 1), q being the fraction of
+// values below, which keeps at most about compression centroids.
+type tdigest struct {
+	compression float64
+	centroids   []Centroid
+	unmerged    []Centroid
+	count       int64
+	min, max    float64
+	sum         float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	if compression < 1 {
+		compression = 1
+	}
+	return &tdigest{compression: compression}
+}
+
+func (d *tdigest) add(mean float64, count int64) {
+	if count <= 0 {
+		return
+	}
+	if 0 == d.count || mean < d.min {
+		d.min = mean
+	}
+	if 0 == d.count || mean > d.max {
+		d.max = mean
+	}
+	d.count += count
+	d.sum += mean * float64(count)
+	d.unmerged = append(d.unmerged, Centroid{mean, count})
+	if len(d.unmerged) >= int(5*d.compression) {
+		d.compress()
+	}
+}
+
+// merge adds the centroids of another digest, keeping its exact minimum and
+// maximum rather than those of its extreme centroids.  The exact ones are
+// ignored unless they bound the centroids, as those of a Digest built without
+// them, or with no values at all, don't.
+func (d *tdigest) merge(o Digest) {
+	min, max, count := d.min, d.max, d.count
+	omin, omax := math.Inf(1), math.Inf(-1)
+	for _, c := range o.Centroids {
+		if 0 < c.Count {
+			omin, omax = math.Min(omin, c.Mean), math.Max(omax, c.Mean)
+		}
+		d.add(c.Mean, c.Count)
+	}
+	if count == d.count || o.Min > omin || o.Max < omax {
+		return
+	}
+	d.min, d.max = o.Min, o.Max
+	if 0 != count {
+		d.min, d.max = math.Min(min, o.Min), math.Max(max, o.Max)
+	}
+}
+
+// digest returns the exported form of the digest.
+func (d *tdigest) digest() Digest {
+	return Digest{Centroids: d.centroidsCopy(), Min: d.min, Max: d.max}
+}
+
+func (d *tdigest) clear() {
+	d.centroids, d.unmerged = nil, nil
+	d.count, d.min, d.max, d.sum = 0, 0, 0, 0
+}
+
+func (d *tdigest) copy() *tdigest {
+	d.compress()
+	c := *d
+	c.centroids = d.centroidsCopy()
+	c.unmerged = nil
+	return &c
+}
+
+func (d *tdigest) centroidsCopy() []Centroid {
+	d.compress()
+	cs := make([]Centroid, len(d.centroids))
+	copy(cs, d.centroids)
+	return cs
+}
+
+func (d *tdigest) compress() {
+	if 0 == len(d.unmerged) {
+		return
+	}
+	all := append(d.centroids, d.unmerged...)
+	sort.Stable(centroidSlice(all))
+	total := float64(d.count)
+	merged := make([]Centroid, 0, len(d.centroids)+1)
+	cur := all[0]
+	var soFar float64
+	kLeft := d.k(0)
+	for _, c := range all[1:] {
+		proposed := float64(cur.Count + c.Count)
+		if d.k((soFar+proposed)/total)-kLeft <= 1 {
+			cur.Mean += (c.Mean - cur.Mean) * float64(c.Count) / proposed
+			cur.Count += c.Count
+			continue
+		}
+		soFar += float64(cur.Count)
+		kLeft = d.k(soFar / total)
+		merged = append(merged, cur)
+		cur = c
+	}
+	d.centroids = append(merged, cur)
+	d.unmerged = d.unmerged[:0]
+}
+
+func (d *tdigest) k(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (d *tdigest) mean() float64 {
+	if 0 == d.count {
+		return 0.0
+	}
+	return d.sum / float64(d.count)
+}
+
+// quantile interpolates between the means of adjacent centroids, each of
+// which is taken to sit at the middle of the values it holds, and between
+// the extreme centroids and the exact minimum and maximum.
+func (d *tdigest) quantile(q float64) float64 {
+	d.compress()
+	if 0 == d.count {
+		return 0.0
+	}
+	cs := d.centroids
+	total := float64(d.count)
+	index := q * total
+	if index < 1 {
+		return d.min
+	}
+	if index > total-1 {
+		return d.max
+	}
+	soFar := float64(cs[0].Count) / 2
+	if index < soFar {
+		return d.min + (index-0.5)/(soFar-0.5)*(cs[0].Mean-d.min)
+	}
+	for i := 0; i < len(cs)-1; i++ {
+		dw := float64(cs[i].Count+cs[i+1].Count) / 2
+		if soFar+dw > index {
+			return cs[i].Mean + (index-soFar)/dw*(cs[i+1].Mean-cs[i].Mean)
+		}
+		soFar += dw
+	}
+	last := cs[len(cs)-1]
+	return last.Mean + (index-soFar)/(total-0.5-soFar)*(d.max-last.Mean)
+}
+
+func (d *tdigest) quantiles(qs []float64) []float64 {
+	scores := make([]float64, len(qs))
+	for i, q := range qs {
+		scores[i] = d.quantile(q)
+	}
+	return scores
+}
+
+func (d *tdigest) variance() float64 {
+	d.compress()
+	if 0 == d.count {
+		return 0.0
+	}
+	m := d.mean()
+	var sum float64
+	for _, c := range d.centroids {
+		delta := c.Mean - m
+		sum += float64(c.Count) * delta * delta
+	}
+	return sum / float64(d.count)
+}
+
+func (d *tdigest) int64Values() []int64 {
+	d.compress()
+	values := make([]int64, len(d.centroids))
+	for i, c := range d.centroids {
+		values[i] = int64(math.Floor(c.Mean + 0.5))
+	}
+	return values
+}
+
+func (d *tdigest) float64Values() []float64 {
+	d.compress()
+	values := make([]float64, len(d.centroids))
+	for i, c := range d.centroids {
+		values[i] = c.Mean
+	}
+	return values
+}
+
+type centroidSlice []Centroid
+
+func (p centroidSlice) Len() int           { return len(p) }
+func (p centroidSlice) Less(i, j int) bool { return p[i].Mean < p[j].Mean }
+func (p centroidSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+)
+
+// TDigestSampleFloat64 is a t-digest sample of float64 values just like
+// TDigestSample.
+type TDigestSampleFloat64 struct {
+	mutex sync.Mutex
+	d     *tdigest
+}
+
+// NewTDigestSampleFloat64 constructs a new t-digest sample of float64 values
+// with the given compression.
+func NewTDigestSampleFloat64(compression float64) SampleFloat64 {
+	if UseNilMetrics {
+		return NilSampleFloat64{}
+	}
+	return &TDigestSampleFloat64{d: newTDigest(compression)}
+}
+
+// Digest returns the centroids, minimum and maximum of the digest.
+func (s *TDigestSampleFloat64) Digest() Digest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.digest()
+}
+
+// Clear clears all samples.
+func (s *TDigestSampleFloat64) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.clear()
+}
+
+// Count returns the number of samples recorded, including those merged.
+func (s *TDigestSampleFloat64) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.count
+}
+
+// Max returns the maximum value in the sample.
+func (s *TDigestSampleFloat64) Max() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.max
+}
+
+// Mean returns the mean of the values in the sample.
+func (s *TDigestSampleFloat64) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.mean()
+}
+
+// Merge adds another digest to this one.
+func (s *TDigestSampleFloat64) Merge(d Digest) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.merge(d)
+}
+
+// Min returns the minimum value in the sample.
+func (s *TDigestSampleFloat64) Min() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.min
+}
+
+// Percentile returns an arbitrary percentile of values in the sample.
+func (s *TDigestSampleFloat64) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.quantile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// sample.
+func (s *TDigestSampleFloat64) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.quantiles(ps)
+}
+
+// Size returns the number of centroids in the digest.
+func (s *TDigestSampleFloat64) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.compress()
+	return len(s.d.centroids)
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *TDigestSampleFloat64) Snapshot() SampleFloat64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &TDigestSampleSnapshotFloat64{d: s.d.copy()}
+}
+
+// SnapshotAndClear returns a read-only copy of the sample and clears it under
+// a single lock, so that no value is lost between the two.
+func (s *TDigestSampleFloat64) SnapshotAndClear() SampleFloat64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &TDigestSampleSnapshotFloat64{d: s.d.copy()}
+	s.d.clear()
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (s *TDigestSampleFloat64) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return math.Sqrt(s.d.variance())
+}
+
+// Sum returns the sum of the values in the sample.
+func (s *TDigestSampleFloat64) Sum() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.sum
+}
+
+// Update samples a new value.
+func (s *TDigestSampleFloat64) Update(v float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.d.add(v, 1)
+}
+
+// Values returns the mean of each centroid in ascending order.
+func (s *TDigestSampleFloat64) Values() []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.float64Values()
+}
+
+// Variance returns the variance of the values in the sample, estimated from
+// the centroids.
+func (s *TDigestSampleFloat64) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.d.variance()
+}
+
+// TDigestSampleSnapshotFloat64 is a read-only copy of a TDigestSample.
+type TDigestSampleSnapshotFloat64 struct {
+	d *tdigest
+}
+
+// Digest returns the centroids, minimum and maximum of the digest at the time
+// the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Digest() Digest { return s.d.digest() }
+
+// Clear panics.
+func (*TDigestSampleSnapshotFloat64) Clear() {
+	panic("Clear called on a TDigestSampleSnapshotFloat64")
+}
+
+// Count returns the count of inputs at the time the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Count() int64 { return s.d.count }
+
+// Max returns the maximal value at the time the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Max() float64 { return s.d.max }
+
+// Mean returns the mean value at the time the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Mean() float64 { return s.d.mean() }
+
+// Min returns the minimal value at the time the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Min() float64 { return s.d.min }
+
+// Percentile returns an arbitrary percentile of values at the time the
+// snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Percentile(p float64) float64 {
+	return s.d.quantile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values at the time
+// the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Percentiles(ps []float64) []float64 {
+	return s.d.quantiles(ps)
+}
+
+// Size returns the number of centroids at the time the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Size() int { return len(s.d.centroids) }
+
+// Snapshot returns the snapshot.
+func (s *TDigestSampleSnapshotFloat64) Snapshot() SampleFloat64 { return s }
+
+// SnapshotAndClear panics.
+func (*TDigestSampleSnapshotFloat64) SnapshotAndClear() SampleFloat64 {
+	panic("SnapshotAndClear called on a TDigestSampleSnapshotFloat64")
+}
+
+// StdDev returns the standard deviation of values at the time the snapshot
+// was taken.
+func (s *TDigestSampleSnapshotFloat64) StdDev() float64 { return math.Sqrt(s.d.variance()) }
+
+// Sum returns the sum of values at the time the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Sum() float64 { return s.d.sum }
+
+// Update panics.
+func (*TDigestSampleSnapshotFloat64) Update(float64) {
+	panic("Update called on a TDigestSampleSnapshotFloat64")
+}
+
+// Values returns the mean of each centroid at the time the snapshot was
+// taken.
+func (s *TDigestSampleSnapshotFloat64) Values() []float64 { return s.d.float64Values() }
+
+// Variance returns the variance of values at the time the snapshot was taken.
+func (s *TDigestSampleSnapshotFloat64) Variance() float64 { return s.d.variance() }
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTDigestSampleFloat64(t *testing.T) {
+	h := NewHistogramFloat64(NewTDigestSampleFloat64(100))
+	for i := 1; i <= 1000; i++ {
+		h.Update(float64(i) / 10)
+	}
+	snapshot := h.Snapshot()
+	h.Clear()
+	if count := snapshot.Count(); 1000 != count {
+		t.Errorf("snapshot.Count(): 1000 != %v\n", count)
+	}
+	if min, max := snapshot.Min(), snapshot.Max(); 0.1 != min || 100 != max {
+		t.Errorf("snapshot.Min(), snapshot.Max(): %v, %v\n", min, max)
+	}
+	if p99 := snapshot.Percentile(0.99); 0.2 < math.Abs(99-p99) {
+		t.Errorf("snapshot.Percentile(0.99): 99 != %v\n", p99)
+	}
+	if count := h.Count(); 0 != count {
+		t.Errorf("h.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestTDigestSampleFloat64Merge(t *testing.T) {
+	a, b := NewTDigestSampleFloat64(100).(*TDigestSampleFloat64), NewTDigestSample(100).(*TDigestSample)
+	a.Update(1.5)
+	b.Update(3)
+	a.Merge(b.Digest())
+	if count := a.Count(); 2 != count {
+		t.Errorf("a.Count(): 2 != %v\n", count)
+	}
+	if max := a.Max(); 3 != max {
+		t.Errorf("a.Max(): 3 != %v\n", max)
+	}
+}
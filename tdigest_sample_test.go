@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func BenchmarkTDigestSample(b *testing.B) {
+	benchmarkSample(b, NewTDigestSample(100))
+}
+
+func TestTDigestSample(t *testing.T) {
+	s := NewTDigestSample(100)
+	for i := 1; i <= 100; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 100 != count {
+		t.Errorf("s.Count(): 100 != %v\n", count)
+	}
+	if min, max := s.Min(), s.Max(); 1 != min || 100 != max {
+		t.Errorf("s.Min(), s.Max(): %v, %v\n", min, max)
+	}
+	if mean := s.Mean(); 50.5 != mean {
+		t.Errorf("s.Mean(): 50.5 != %v\n", mean)
+	}
+	if sum := s.Sum(); 5050 != sum {
+		t.Errorf("s.Sum(): 5050 != %v\n", sum)
+	}
+	if p50 := s.Percentile(0.5); 1 < math.Abs(50.5-p50) {
+		t.Errorf("s.Percentile(0.5): 50.5 != %v\n", p50)
+	}
+}
+
+func TestTDigestSampleAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := NewTDigestSample(100)
+	for i := 0; i < 1000000; i++ {
+		s.Update(r.Int63n(1000000))
+	}
+	if size := s.Size(); 500 < size {
+		t.Errorf("s.Size(): %v centroids\n", size)
+	}
+	ps := s.Percentiles([]float64{0.5, 0.99, 0.999})
+	for i, want := range []float64{500000, 990000, 999000} {
+		if 2000 < math.Abs(ps[i]-want) {
+			t.Errorf("ps[%v]: %v not within 2000 of %v\n", i, ps[i], want)
+		}
+	}
+}
+
+func TestTDigestSampleMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	shards := []*TDigestSample{
+		NewTDigestSample(100).(*TDigestSample),
+		NewTDigestSample(100).(*TDigestSample),
+		NewTDigestSample(100).(*TDigestSample),
+	}
+	for i := 0; i < 300000; i++ {
+		shards[i%3].Update(r.Int63n(1000000))
+	}
+	s := NewTDigestSample(100).(*TDigestSample)
+	for _, shard := range shards {
+		s.Merge(shard.Snapshot().(*TDigestSampleSnapshot).Digest())
+	}
+	if count := s.Count(); 300000 != count {
+		t.Errorf("s.Count(): 300000 != %v\n", count)
+	}
+	if p99 := s.Percentile(0.99); 3000 < math.Abs(990000-p99) {
+		t.Errorf("s.Percentile(0.99): 990000 != %v\n", p99)
+	}
+}
+
+func TestTDigestSampleMergeExtremes(t *testing.T) {
+	shard := NewTDigestSample(1).(*TDigestSample)
+	for i := int64(1); i <= 1000; i++ {
+		shard.Update(i)
+	}
+	b, err := json.Marshal(shard.Digest())
+	if nil != err {
+		t.Fatal(err)
+	}
+	var d Digest
+	if err := json.Unmarshal(b, &d); nil != err {
+		t.Fatal(err)
+	}
+	if 1 == d.Centroids[0].Mean {
+		t.Fatal("the extreme centroids are exact")
+	}
+	s := NewTDigestSample(100).(*TDigestSample)
+	s.Update(500)
+	s.Merge(d)
+	if min, max := s.Min(), s.Max(); 1 != min || 1000 != max {
+		t.Errorf("s.Min(), s.Max(): %v, %v\n", min, max)
+	}
+}
+
+func TestTDigestSampleMergeEmpty(t *testing.T) {
+	s := NewTDigestSample(100).(*TDigestSample)
+	s.Update(3)
+	s.Update(7)
+	s.Merge(Digest{})
+	if count, min, max := s.Count(), s.Min(), s.Max(); 2 != count || 3 != min || 7 != max {
+		t.Errorf("s.Count(), s.Min(), s.Max(): %v, %v, %v\n", count, min, max)
+	}
+	s.Merge(Digest{Centroids: []Centroid{{Mean: 5, Count: 1}}})
+	if count, min, max := s.Count(), s.Min(), s.Max(); 3 != count || 3 != min || 7 != max {
+		t.Errorf("s.Count(), s.Min(), s.Max() without extremes: %v, %v, %v\n", count, min, max)
+	}
+}
+
+func TestTDigestSampleSnapshot(t *testing.T) {
+	tm := NewCustomTimer(NewHistogram(NewTDigestSample(100)), NewMeter())
+	defer tm.Stop()
+	tm.Update(time.Millisecond)
+	snapshot := tm.Snapshot()
+	tm.Update(time.Second)
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+	if max := snapshot.Max(); int64(time.Millisecond) != max {
+		t.Errorf("snapshot.Max(): %v != %v\n", int64(time.Millisecond), max)
+	}
+	if max := tm.Max(); int64(time.Second) != max {
+		t.Errorf("tm.Max(): %v != %v\n", int64(time.Second), max)
+	}
+}
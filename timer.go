@@ -18,7 +18,9 @@ type Timer interface {
 	Rate15() float64
 	RateMean() float64
 	Snapshot() Timer
+	SnapshotAndClear() Timer
 	StdDev() float64
+	Stop()
 	Sum() int64
 	Time(func())
 	Update(time.Duration)
@@ -37,10 +39,17 @@ func GetOrRegisterTimer(name string, r Registry) Timer {
 
 // NewCustomTimer constructs a new StandardTimer from a Histogram and a Meter.
 func NewCustomTimer(h Histogram, m Meter) Timer {
+	return NewCustomTimerWithClock(h, m, SystemClock)
+}
+
+// NewCustomTimerWithClock constructs a new StandardTimer from a Histogram and
+// a Meter which measures durations with the given Clock.
+func NewCustomTimerWithClock(h Histogram, m Meter, c Clock) Timer {
 	if UseNilMetrics {
 		return NilTimer{}
 	}
 	return &StandardTimer{
+		clock:     c,
 		histogram: h,
 		meter:     m,
 	}
@@ -59,12 +68,19 @@ func NewRegisteredTimer(name string, r Registry) Timer {
 // NewTimer constructs a new StandardTimer using an exponentially-decaying
 // sample with the same reservoir size and alpha as UNIX load averages.
 func NewTimer() Timer {
+	return NewTimerWithClock(SystemClock)
+}
+
+// NewTimerWithClock is just like NewTimer, but its sample, its meter and the
+// timer itself take the time from the given Clock.
+func NewTimerWithClock(c Clock) Timer {
 	if UseNilMetrics {
 		return NilTimer{}
 	}
 	return &StandardTimer{
-		histogram: NewHistogram(NewExpDecaySample(1028, 0.015)),
-		meter:     NewMeter(),
+		clock:     c,
+		histogram: NewHistogram(NewExpDecaySampleWithClock(1028, 0.015, c)),
+		meter:     NewMeterWithClock(c),
 	}
 }
 
@@ -77,6 +93,9 @@ type NilTimer struct {
 // Count is a no-op.
 func (NilTimer) Count() int64 { return 0 }
 
+// Exemplar is a no-op.
+func (NilTimer) Exemplar() *Exemplar { return nil }
+
 // Max is a no-op.
 func (NilTimer) Max() int64 { return 0 }
 
@@ -109,9 +128,15 @@ func (NilTimer) RateMean() float64 { return 0.0 }
 // Snapshot is a no-op.
 func (NilTimer) Snapshot() Timer { return NilTimer{} }
 
+// SnapshotAndClear is a no-op.
+func (NilTimer) SnapshotAndClear() Timer { return NilTimer{} }
+
 // StdDev is a no-op.
 func (NilTimer) StdDev() float64 { return 0.0 }
 
+// Stop is a no-op.
+func (NilTimer) Stop() {}
+
 // Sum is a no-op.
 func (NilTimer) Sum() int64 { return 0 }
 
@@ -124,12 +149,16 @@ func (NilTimer) Update(time.Duration) {}
 // UpdateSince is a no-op.
 func (NilTimer) UpdateSince(time.Time) {}
 
+// UpdateWithExemplar is a no-op.
+func (NilTimer) UpdateWithExemplar(time.Duration, Tags) {}
+
 // Variance is a no-op.
 func (NilTimer) Variance() float64 { return 0.0 }
 
 // StandardTimer is the standard implementation of a Timer and uses a Histogram
 // and Meter.
 type StandardTimer struct {
+	clock     Clock
 	histogram Histogram
 	meter     Meter
 	mutex     sync.Mutex
@@ -140,6 +169,12 @@ func (t *StandardTimer) Count() int64 {
 	return t.histogram.Count()
 }
 
+// Exemplar returns the exemplar recorded by the last call to
+// UpdateWithExemplar, in nanoseconds, or nil.
+func (t *StandardTimer) Exemplar() *Exemplar {
+	return exemplarOf(t.histogram)
+}
+
 // Max returns the maximum value in the sample.
 func (t *StandardTimer) Max() int64 {
 	return t.histogram.Max()
@@ -196,11 +231,29 @@ func (t *StandardTimer) Snapshot() Timer {
 	}
 }
 
+// SnapshotAndClear returns a read-only copy of the timer and clears its
+// histogram, without losing the durations recorded in between.  The meter is
+// left alone since its rates don't accumulate.
+func (t *StandardTimer) SnapshotAndClear() Timer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return &TimerSnapshot{
+		histogram: t.histogram.SnapshotAndClear().(*HistogramSnapshot),
+		meter:     t.meter.Snapshot().(*MeterSnapshot),
+	}
+}
+
 // StdDev returns the standard deviation of the values in the sample.
 func (t *StandardTimer) StdDev() float64 {
 	return t.histogram.StdDev()
 }
 
+// Stop stops the timer's meter, detaching it from the goroutine which ticks
+// its moving averages.
+func (t *StandardTimer) Stop() {
+	t.meter.Stop()
+}
+
 // Sum returns the sum in the sample.
 func (t *StandardTimer) Sum() int64 {
 	return t.histogram.Sum()
@@ -208,9 +261,9 @@ func (t *StandardTimer) Sum() int64 {
 
 // Record the duration of the execution of the given function.
 func (t *StandardTimer) Time(f func()) {
-	ts := time.Now()
+	ts := t.clock.Now()
 	f()
-	t.Update(time.Since(ts))
+	t.Update(t.clock.Now().Sub(ts))
 }
 
 // Record the duration of an event.
@@ -225,7 +278,22 @@ func (t *StandardTimer) Update(d time.Duration) {
 func (t *StandardTimer) UpdateSince(ts time.Time) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	t.histogram.Update(int64(time.Since(ts)))
+	t.histogram.Update(int64(t.clock.Now().Sub(ts)))
+	t.meter.Mark(1)
+}
+
+// Record the duration of an event along with labels, such as a trace ID,
+// which identify it as the timer's exemplar.
+func (t *StandardTimer) UpdateWithExemplar(d time.Duration, labels Tags) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if h, ok := t.histogram.(interface {
+		UpdateWithExemplar(int64, Tags)
+	}); ok {
+		h.UpdateWithExemplar(int64(d), labels)
+	} else {
+		t.histogram.Update(int64(d))
+	}
 	t.meter.Mark(1)
 }
 
@@ -234,6 +302,40 @@ func (t *StandardTimer) Variance() float64 {
 	return t.histogram.Variance()
 }
 
+// checkpoint returns the count and start time of the timer's meter along
+// with the state of its histogram's sample, or nil if neither is persisted.
+func (t *StandardTimer) checkpoint() *persistedState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	m, mOK := t.meter.(persistent)
+	h, hOK := t.histogram.(persistent)
+	if !mOK && !hOK {
+		return nil
+	}
+	s := &persistedState{}
+	if mOK {
+		s = m.checkpoint()
+	}
+	if hOK {
+		if hs := h.checkpoint(); nil != hs {
+			s.Sample = hs.Sample
+		}
+	}
+	return s
+}
+
+// restore restores the timer's meter and histogram.
+func (t *StandardTimer) restore(s *persistedState) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if m, ok := t.meter.(persistent); ok {
+		m.restore(s)
+	}
+	if h, ok := t.histogram.(persistent); ok {
+		h.restore(s)
+	}
+}
+
 // TimerSnapshot is a read-only copy of another Timer.
 type TimerSnapshot struct {
 	histogram *HistogramSnapshot
@@ -244,12 +346,26 @@ type TimerSnapshot struct {
 // taken.
 func (t *TimerSnapshot) Count() int64 { return t.histogram.Count() }
 
+// Exemplar returns the last exemplar recorded at the time the snapshot was
+// taken, or nil.
+func (t *TimerSnapshot) Exemplar() *Exemplar { return t.histogram.Exemplar() }
+
 // Max returns the maximum value at the time the snapshot was taken.
 func (t *TimerSnapshot) Max() int64 { return t.histogram.Max() }
 
 // Mean returns the mean value at the time the snapshot was taken.
 func (t *TimerSnapshot) Mean() float64 { return t.histogram.Mean() }
 
+// Merge returns a snapshot of the durations recorded by both this snapshot
+// and another Timer, whose rates are the sums of theirs.
+func (t *TimerSnapshot) Merge(o Timer) *TimerSnapshot {
+	s := timerSnapshot(o)
+	return &TimerSnapshot{
+		histogram: t.histogram.Merge(s.histogram),
+		meter:     t.meter.Merge(s.meter),
+	}
+}
+
 // Min returns the minimum value at the time the snapshot was taken.
 func (t *TimerSnapshot) Min() int64 { return t.histogram.Min() }
 
@@ -284,10 +400,18 @@ func (t *TimerSnapshot) RateMean() float64 { return t.meter.RateMean() }
 // Snapshot returns the snapshot.
 func (t *TimerSnapshot) Snapshot() Timer { return t }
 
+// SnapshotAndClear panics.
+func (*TimerSnapshot) SnapshotAndClear() Timer {
+	panic("SnapshotAndClear called on a TimerSnapshot")
+}
+
 // StdDev returns the standard deviation of the values at the time the snapshot
 // was taken.
 func (t *TimerSnapshot) StdDev() float64 { return t.histogram.StdDev() }
 
+// Stop is a no-op.
+func (t *TimerSnapshot) Stop() {}
+
 // Sum returns the sum at the time the snapshot was taken.
 func (t *TimerSnapshot) Sum() int64 { return t.histogram.Sum() }
 
@@ -306,6 +430,28 @@ func (*TimerSnapshot) UpdateSince(time.Time) {
 	panic("UpdateSince called on a TimerSnapshot")
 }
 
+// UpdateWithExemplar panics.
+func (*TimerSnapshot) UpdateWithExemplar(time.Duration, Tags) {
+	panic("UpdateWithExemplar called on a TimerSnapshot")
+}
+
 // Variance returns the variance of the values at the time the snapshot was
 // taken.
 func (t *TimerSnapshot) Variance() float64 { return t.histogram.Variance() }
+
+// timerSnapshot returns a TimerSnapshot of any Timer.
+func timerSnapshot(t Timer) *TimerSnapshot {
+	if s, ok := t.Snapshot().(*TimerSnapshot); ok {
+		return s
+	}
+	return &TimerSnapshot{
+		histogram: &HistogramSnapshot{sample: NewSampleSnapshot(t.Count(), nil), exemplar: exemplarOf(t)},
+		meter: &MeterSnapshot{
+			count:    t.Count(),
+			rate1:    t.Rate1(),
+			rate5:    t.Rate5(),
+			rate15:   t.Rate15(),
+			rateMean: t.RateMean(),
+		},
+	}
+}
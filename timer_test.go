@@ -87,3 +87,62 @@ func ExampleGetOrRegisterTimer() {
 	t.Update(47)
 	fmt.Println(t.Max()) // Output: 47
 }
+
+func TestTimerSnapshotMerge(t *testing.T) {
+	a, b := NewTimer(), NewTimer()
+	defer a.Stop()
+	defer b.Stop()
+	a.Update(time.Second)
+	b.Update(3 * time.Second)
+	s := a.Snapshot().(*TimerSnapshot).Merge(b)
+	if count := s.Count(); 2 != count {
+		t.Errorf("s.Count(): 2 != %v\n", count)
+	}
+	if mean := s.Mean(); float64(2*time.Second) != mean {
+		t.Errorf("s.Mean(): %v != %v\n", float64(2*time.Second), mean)
+	}
+	if max := s.Max(); int64(3*time.Second) != max {
+		t.Errorf("s.Max(): %v != %v\n", int64(3*time.Second), max)
+	}
+}
+
+func TestTimerSnapshotAndClear(t *testing.T) {
+	tm := NewTimer()
+	defer tm.Stop()
+	tm.Update(time.Second)
+	snapshot := tm.SnapshotAndClear()
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+	if count := tm.Count(); 0 != count {
+		t.Errorf("tm.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestTimerExemplar(t *testing.T) {
+	tm := NewTimer().(*StandardTimer)
+	defer tm.Stop()
+	tm.UpdateWithExemplar(time.Second, Tags{"trace_id": "abc"})
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+	e := tm.Snapshot().(*TimerSnapshot).Exemplar()
+	if nil == e || float64(time.Second) != e.Value || "abc" != e.Labels["trace_id"] {
+		t.Fatalf("tm.Snapshot().Exemplar(): %v\n", e)
+	}
+}
+
+func TestTimerExemplarCustomHistogram(t *testing.T) {
+	// Embedding the interface hides UpdateWithExemplar and Exemplar.
+	h := struct{ Histogram }{NewHistogram(NewUniformSample(100))}
+	m := NewMeter()
+	defer m.Stop()
+	tm := NewCustomTimer(h, m).(*StandardTimer)
+	tm.UpdateWithExemplar(time.Second, Tags{"trace_id": "abc"})
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+	if e := tm.Exemplar(); nil != e {
+		t.Errorf("tm.Exemplar(): %v\n", e)
+	}
+}
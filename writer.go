@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sort"
@@ -10,14 +11,48 @@ import (
 // Write sorts writes each metric in the given registry periodically to the
 // given io.Writer.
 func Write(r Registry, d time.Duration, w io.Writer) {
-	for _ = range time.Tick(d) {
-		WriteOnce(r, w)
-	}
+	WriteContext(context.Background(), r, d, w, nil)
+}
+
+// WriteContext is just like Write, but it returns after a final write once
+// ctx is done and passes each failed write to onError instead of logging it.
+func WriteContext(ctx context.Context, r Registry, d time.Duration, w io.Writer, onError func(error)) {
+	WriteContextWithOptions(ctx, r, d, w, OutputOptions{}, onError)
 }
 
 // WriteOnce sorts and writes metrics in the given registry to the given
 // io.Writer.
 func WriteOnce(r Registry, w io.Writer) {
+	WriteOnceWithOptions(r, w, OutputOptions{})
+}
+
+// WriteContextWithOptions is just like WriteContext, but it writes the
+// percentiles and fields chosen by o and timings in o.DurationUnit.
+func WriteContextWithOptions(ctx context.Context, r Registry, d time.Duration, w io.Writer, o OutputOptions, onError func(error)) {
+	RunReporter(ctx, d, func() error { return WriteOnceWithOptions(r, w, o) }, onError)
+}
+
+// WriteOnceWithOptions is just like WriteOnce, but it writes the percentiles
+// and fields chosen by o and timings in o.DurationUnit and returns the first
+// error returned by w.
+func WriteOnceWithOptions(r Registry, w io.Writer, o OutputOptions) error {
+	ew := &errWriter{w: w}
+	w = ew
+	o = o.WithDefaults()
+	du := float64(o.DurationUnit)
+	printf := func(f Fields, format string, v ...interface{}) {
+		if o.Has(f) {
+			fmt.Fprintf(w, format, v...)
+		}
+	}
+	percentiles := func(s interface{ Percentiles([]float64) []float64 }, div float64) {
+		if o.Has(FieldPercentiles) {
+			for i, p := range s.Percentiles(o.Percentiles) {
+				fmt.Fprintf(w, "  %-13s%12.2f\n", PercentileLabel(o.Percentiles[i])+":", p/div)
+			}
+		}
+	}
+
 	var namedMetrics namedMetricSlice
 	r.Each(func(name string, i interface{}) {
 		namedMetrics = append(namedMetrics, namedMetric{name, i})
@@ -41,46 +76,51 @@ func WriteOnce(r Registry, w io.Writer) {
 			fmt.Fprintf(w, "  error:       %v\n", metric.Error())
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
 			fmt.Fprintf(w, "histogram %s\n", namedMetric.name)
-			fmt.Fprintf(w, "  count:       %9d\n", h.Count())
-			fmt.Fprintf(w, "  min:         %9d\n", h.Min())
-			fmt.Fprintf(w, "  max:         %9d\n", h.Max())
-			fmt.Fprintf(w, "  mean:        %12.2f\n", h.Mean())
-			fmt.Fprintf(w, "  stddev:      %12.2f\n", h.StdDev())
-			fmt.Fprintf(w, "  median:      %12.2f\n", ps[0])
-			fmt.Fprintf(w, "  75%%:         %12.2f\n", ps[1])
-			fmt.Fprintf(w, "  95%%:         %12.2f\n", ps[2])
-			fmt.Fprintf(w, "  99%%:         %12.2f\n", ps[3])
-			fmt.Fprintf(w, "  99.9%%:       %12.2f\n", ps[4])
+			printf(FieldCount, "  count:       %9d\n", h.Count())
+			printf(FieldMin, "  min:         %9d\n", h.Min())
+			printf(FieldMax, "  max:         %9d\n", h.Max())
+			printf(FieldMean, "  mean:        %12.2f\n", h.Mean())
+			printf(FieldStdDev, "  stddev:      %12.2f\n", h.StdDev())
+			percentiles(h, 1)
+		case HistogramFloat64:
+			h := metric.Snapshot()
+			fmt.Fprintf(w, "histogram %s\n", namedMetric.name)
+			printf(FieldCount, "  count:       %9d\n", h.Count())
+			printf(FieldMin, "  min:         %12.2f\n", h.Min())
+			printf(FieldMax, "  max:         %12.2f\n", h.Max())
+			printf(FieldMean, "  mean:        %12.2f\n", h.Mean())
+			printf(FieldStdDev, "  stddev:      %12.2f\n", h.StdDev())
+			percentiles(h, 1)
 		case Meter:
 			m := metric.Snapshot()
 			fmt.Fprintf(w, "meter %s\n", namedMetric.name)
-			fmt.Fprintf(w, "  count:       %9d\n", m.Count())
-			fmt.Fprintf(w, "  1-min rate:  %12.2f\n", m.Rate1())
-			fmt.Fprintf(w, "  5-min rate:  %12.2f\n", m.Rate5())
-			fmt.Fprintf(w, "  15-min rate: %12.2f\n", m.Rate15())
-			fmt.Fprintf(w, "  mean rate:   %12.2f\n", m.RateMean())
+			printf(FieldCount, "  count:       %9d\n", m.Count())
+			printf(FieldRates, "  1-min rate:  %12.2f\n", m.Rate1())
+			printf(FieldRates, "  5-min rate:  %12.2f\n", m.Rate5())
+			printf(FieldRates, "  15-min rate: %12.2f\n", m.Rate15())
+			printf(FieldRates, "  mean rate:   %12.2f\n", m.RateMean())
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
 			fmt.Fprintf(w, "timer %s\n", namedMetric.name)
-			fmt.Fprintf(w, "  count:       %9d\n", t.Count())
-			fmt.Fprintf(w, "  min:         %9d\n", t.Min())
-			fmt.Fprintf(w, "  max:         %9d\n", t.Max())
-			fmt.Fprintf(w, "  mean:        %12.2f\n", t.Mean())
-			fmt.Fprintf(w, "  stddev:      %12.2f\n", t.StdDev())
-			fmt.Fprintf(w, "  median:      %12.2f\n", ps[0])
-			fmt.Fprintf(w, "  75%%:         %12.2f\n", ps[1])
-			fmt.Fprintf(w, "  95%%:         %12.2f\n", ps[2])
-			fmt.Fprintf(w, "  99%%:         %12.2f\n", ps[3])
-			fmt.Fprintf(w, "  99.9%%:       %12.2f\n", ps[4])
-			fmt.Fprintf(w, "  1-min rate:  %12.2f\n", t.Rate1())
-			fmt.Fprintf(w, "  5-min rate:  %12.2f\n", t.Rate5())
-			fmt.Fprintf(w, "  15-min rate: %12.2f\n", t.Rate15())
-			fmt.Fprintf(w, "  mean rate:   %12.2f\n", t.RateMean())
+			printf(FieldCount, "  count:       %9d\n", t.Count())
+			if 1 == du {
+				printf(FieldMin, "  min:         %9d\n", t.Min())
+				printf(FieldMax, "  max:         %9d\n", t.Max())
+			} else {
+				printf(FieldMin, "  min:         %12.2f\n", float64(t.Min())/du)
+				printf(FieldMax, "  max:         %12.2f\n", float64(t.Max())/du)
+			}
+			printf(FieldMean, "  mean:        %12.2f\n", t.Mean()/du)
+			printf(FieldStdDev, "  stddev:      %12.2f\n", t.StdDev()/du)
+			percentiles(t, du)
+			printf(FieldRates, "  1-min rate:  %12.2f\n", t.Rate1())
+			printf(FieldRates, "  5-min rate:  %12.2f\n", t.Rate5())
+			printf(FieldRates, "  15-min rate: %12.2f\n", t.Rate15())
+			printf(FieldRates, "  mean rate:   %12.2f\n", t.RateMean())
 		}
 	}
+	return ew.err
 }
 
 type namedMetric struct {
@@ -98,3 +138,19 @@ func (nms namedMetricSlice) Swap(i, j int) { nms[i], nms[j] = nms[j], nms[i] }
 func (nms namedMetricSlice) Less(i, j int) bool {
 	return nms[i].name < nms[j].name
 }
+
+// errWriter remembers the first error returned by the underlying io.Writer
+// and discards everything written after it.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if nil != w.err {
+		return 0, w.err
+	}
+	var n int
+	n, w.err = w.w.Write(p)
+	return n, w.err
+}
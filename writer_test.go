@@ -1,8 +1,10 @@
 package metrics
 
 import (
+	"bytes"
 	"sort"
 	"testing"
+	"time"
 )
 
 func TestMetricsSorting(t *testing.T) {
@@ -20,3 +22,64 @@ func TestMetricsSorting(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteOnceWithOptionsError(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	w := &failingConn{}
+	if err := WriteOnceWithOptions(r, w, OutputOptions{}); errFailingConn != err {
+		t.Fatal(err)
+	}
+	if 2 != w.writes {
+		t.Errorf("writes: 2 != %v\n", w.writes)
+	}
+}
+
+func TestWriteOnceWithOptions(t *testing.T) {
+	r := NewRegistry()
+	tm := NewRegisteredTimer("latency", r)
+	defer tm.Stop()
+	tm.Update(2 * time.Millisecond)
+	m := NewRegisteredMeter("events", r)
+	defer m.Stop()
+	var b bytes.Buffer
+	err := WriteOnceWithOptions(r, &b, OutputOptions{
+		Percentiles:  []float64{0.9, 0.9999},
+		DurationUnit: time.Millisecond,
+		Fields:       FieldCount | FieldMin | FieldPercentiles,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	expected := "meter events\n" +
+		"  count:               0\n" +
+		"timer latency\n" +
+		"  count:               1\n" +
+		"  min:                 2.00\n" +
+		"  90%:                 2.00\n" +
+		"  99.99%:              2.00\n"
+	if s := b.String(); expected != s {
+		t.Fatalf("\n%s", s)
+	}
+}
+
+func TestWriteOnceDefaults(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredHistogram("size", r, NewUniformSample(100)).Update(10)
+	var b bytes.Buffer
+	WriteOnce(r, &b)
+	expected := "histogram size\n" +
+		"  count:               1\n" +
+		"  min:                10\n" +
+		"  max:                10\n" +
+		"  mean:               10.00\n" +
+		"  stddev:              0.00\n" +
+		"  median:             10.00\n" +
+		"  75%:                10.00\n" +
+		"  95%:                10.00\n" +
+		"  99%:                10.00\n" +
+		"  99.9%:              10.00\n"
+	if s := b.String(); expected != s {
+		t.Fatalf("\n%s", s)
+	}
+}